@@ -0,0 +1,159 @@
+package captcha
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// find the solution of the challenge, as the browser does
+func solve(t *testing.T, challenge Challenge) string {
+	t.Helper()
+	for nonce := 0; nonce < 1<<20; nonce++ {
+		if solution := strconv.Itoa(nonce); Solves(challenge.Token, solution, challenge.Difficulty) {
+			return solution
+		}
+	}
+	t.Fatal("no solution found")
+	return ""
+}
+
+// the token with its payload changed by edit, keeping the signature of the original
+func tamper(t *testing.T, token string, edit func(fields []string)) string {
+	t.Helper()
+	encoded, signature, _ := strings.Cut(token, ".")
+	raw, err := encoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(string(raw), "|")
+	edit(fields)
+	return encoding.EncodeToString([]byte(strings.Join(fields, "|"))) + "." + signature
+}
+
+func TestVerify(t *testing.T) {
+	issuer := New("key", 8, time.Minute)
+
+	tests := []struct {
+		name string
+		// the token and the solution sent with the form
+		sent func() (token, solution string)
+		want error
+	}{
+		{"solved", func() (string, string) {
+			challenge := issuer.Issue("signup")
+			return challenge.Token, solve(t, challenge)
+		}, nil},
+		{"no token", func() (string, string) { return "", "1" }, ErrMissing},
+		{"no solution", func() (string, string) { return issuer.Issue("signup").Token, "" }, ErrMissing},
+		{"not a token", func() (string, string) { return "garbage", "1" }, ErrInvalid},
+		{"wrong solution", func() (string, string) {
+			challenge := issuer.Issue("signup")
+			solution := solve(t, challenge)
+			for Solves(challenge.Token, solution, challenge.Difficulty) {
+				solution += "0"
+			}
+			return challenge.Token, solution
+		}, ErrWrong},
+		{"issued for another form", func() (string, string) {
+			challenge := issuer.Issue("login")
+			return challenge.Token, solve(t, challenge)
+		}, ErrInvalid},
+		{"signed with another key", func() (string, string) {
+			challenge := New("other key", 8, time.Minute).Issue("signup")
+			return challenge.Token, solve(t, challenge)
+		}, ErrInvalid},
+		{"tampered signature", func() (string, string) {
+			challenge := issuer.Issue("signup")
+			solution := solve(t, challenge)
+			token := []byte(challenge.Token)
+			if token[len(token)-2] == 'A' {
+				token[len(token)-2] = 'B'
+			} else {
+				token[len(token)-2] = 'A'
+			}
+			return string(token), solution
+		}, ErrInvalid},
+		{"lowered difficulty", func() (string, string) {
+			token := tamper(t, issuer.Issue("signup").Token, func(fields []string) { fields[2] = "0" })
+			return token, "1"
+		}, ErrInvalid},
+		{"extended expiry", func() (string, string) {
+			expired := New("key", 0, -time.Minute).Issue("signup")
+			token := tamper(t, expired.Token, func(fields []string) {
+				fields[1] = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+			})
+			return token, "1"
+		}, ErrInvalid},
+		{"expired", func() (string, string) {
+			// the same key, the challenge expired a minute ago
+			challenge := New("key", 8, -time.Minute).Issue("signup")
+			return challenge.Token, solve(t, challenge)
+		}, ErrExpired},
+	}
+	for _, test := range tests {
+		token, solution := test.sent()
+		if err := issuer.Verify("signup", token, solution); err != test.want {
+			t.Errorf("%s: %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestVerifyOnce(t *testing.T) {
+	issuer := New("", 8, time.Minute)
+	challenge := issuer.Issue("login")
+	solution := solve(t, challenge)
+	if err := issuer.Verify("login", challenge.Token, solution); err != nil {
+		t.Fatal(err)
+	}
+	if err := issuer.Verify("login", challenge.Token, solution); err != ErrReplayed {
+		t.Errorf("the solved challenge sent again: %v, want %v", err, ErrReplayed)
+	}
+	// another challenge is still accepted
+	next := issuer.Issue("login")
+	if err := issuer.Verify("login", next.Token, solve(t, next)); err != nil {
+		t.Errorf("a new challenge after the replay: %v", err)
+	}
+
+	// the spent challenges are forgotten once expired, they cannot be solved anymore anyway
+	issuer.spent["old"] = time.Now().Add(-time.Second)
+	fresh := issuer.Issue("login")
+	if err := issuer.Verify("login", fresh.Token, solve(t, fresh)); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := issuer.spent["old"]; found {
+		t.Error("an expired challenge is still remembered")
+	}
+}
+
+func TestBypass(t *testing.T) {
+	issuer := New("key", 30, time.Minute)
+	issuer.Bypass = "bypass-for-tests"
+	challenge := issuer.Issue("signup")
+
+	tests := []struct {
+		name            string
+		token, solution string
+		want            error
+	}{
+		{"with a challenge", challenge.Token, issuer.Bypass, nil},
+		// the bypass is never spent, tests send it as often as they need
+		{"with the same challenge again", challenge.Token, issuer.Bypass, nil},
+		{"without a challenge", "", issuer.Bypass, nil},
+		{"another solution", challenge.Token, "bypass", ErrWrong},
+		{"a longer solution", challenge.Token, issuer.Bypass + "x", ErrWrong},
+		{"no solution", challenge.Token, "", ErrMissing},
+	}
+	for _, test := range tests {
+		if err := issuer.Verify("signup", test.token, test.solution); err != test.want {
+			t.Errorf("%s: %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// without a bypass set, an empty solution is not one
+	issuer.Bypass = ""
+	if err := issuer.Verify("signup", challenge.Token, ""); err != ErrMissing {
+		t.Errorf("an empty solution without a bypass: %v, want %v", err, ErrMissing)
+	}
+}
@@ -0,0 +1,25 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type csrfTokenKey struct{}
+
+// WithCSRFToken sets the token the forms and the HTMX requests of the page send back
+func WithCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfTokenKey{}, token)
+}
+
+// the CSRF token of the visitor, empty when none was set
+func csrfToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// the hx-headers of the pages, HTMX sends the token with each of their requests
+func csrfHeaders(ctx context.Context) string {
+	headers, _ := json.Marshal(map[string]string{"X-CSRF-Token": csrfToken(ctx)})
+	return string(headers)
+}
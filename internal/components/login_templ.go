@@ -8,8 +8,13 @@ package components
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import (
+	"github.com/taewony/go-fullstack-webapp/internal/captcha"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc"
+)
+
 // {{ define "content" }}
-func LoginFormTempl() templ.Component {
+func LoginFormTempl(providers []*oidc.Provider, challenge *captcha.Challenge) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -30,7 +35,31 @@ func LoginFormTempl() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<form class=\"form-signin center\" role=\"form\" action=\"/authenticate\" method=\"post\"><h2 class=\"form-signin-heading\"><i class=\"fa fa-comments-o\">[ChitChat]</i></h2><input type=\"email\" name=\"email\" class=\"form-control\" placeholder=\"Email address\" required autofocus> <input type=\"password\" name=\"password\" class=\"form-control\" placeholder=\"Password\" required><br><button class=\"btn btn-lg btn-primary btn-block\" hx-post=\"/signup\" hx-trigger=\"clcik\" hx-target=\"body\" type=\"submit\">Sign in</button><br></form>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<form class=\"form-signin center\" role=\"form\" action=\"/authenticate\" method=\"post\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = CSRFTempl().Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<h2 class=\"form-signin-heading\"><i class=\"fa fa-comments-o\">[ChitChat]</i></h2><input type=\"email\" name=\"email\" class=\"form-control\" placeholder=\"Email address\" required autofocus> <input type=\"password\" name=\"password\" class=\"form-control\" placeholder=\"Password\" required>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = CaptchaTempl(challenge).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<br><button class=\"btn btn-lg btn-primary btn-block\" hx-post=\"/signup\" hx-trigger=\"clcik\" hx-target=\"body\" type=\"submit\">Sign in</button><br>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = ProviderButtonsTempl(providers).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<a href=\"/password/forgot\">Forgot your password?</a></form>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -8,8 +8,10 @@ package components
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import "github.com/taewony/go-fullstack-webapp/internal/captcha"
+
 // {{ define "content" }}
-func SignupFormTempl() templ.Component {
+func SignupFormTempl(challenge *captcha.Challenge) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -30,7 +32,23 @@ func SignupFormTempl() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<form class=\"form-signin\" role=\"form\" action=\"/signup\" method=\"post\"><h2 class=\"form-signin-heading\"><i class=\"fa fa-comments-o\">[ChitChat]</i></h2><div class=\"lead\">Sign up for an account below</div><input id=\"name\" type=\"text\" name=\"name\" class=\"form-control\" placeholder=\"Name\" required autofocus> <input type=\"email\" name=\"email\" class=\"form-control\" placeholder=\"Email address\" required> <input type=\"password\" name=\"password\" class=\"form-control\" placeholder=\"Password\" required> <button class=\"btn btn-lg btn-primary btn-block\" hx-post=\"/signup\" hx-trigger=\"click\" hx-target=\"body\" type=\"submit\">Sign up</button></form>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<form class=\"form-signin\" role=\"form\" action=\"/signup\" method=\"post\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = CSRFTempl().Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<h2 class=\"form-signin-heading\"><i class=\"fa fa-comments-o\">[ChitChat]</i></h2><div class=\"lead\">Sign up for an account below</div><input id=\"name\" type=\"text\" name=\"name\" class=\"form-control\" placeholder=\"Name\" required autofocus> <input type=\"text\" name=\"handle\" class=\"form-control\" placeholder=\"Username (letters, digits and _)\" pattern=\"@?[A-Za-z0-9_]{3,32}\" required> <input type=\"email\" name=\"email\" class=\"form-control\" placeholder=\"Email address\" required> <input type=\"password\" name=\"password\" class=\"form-control\" placeholder=\"Password\" required>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = CaptchaTempl(challenge).Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<button class=\"btn btn-lg btn-primary btn-block\" hx-post=\"/signup\" hx-trigger=\"click\" hx-target=\"body\" type=\"submit\">Sign up</button></form>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,31 @@
+package components
+
+import (
+	"context"
+	"time"
+)
+
+type locationKey struct{}
+
+// WithLocation sets the zone the dates of the page are shown in
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// the zone of the visitor, the server zone when none was set
+func location(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.Local
+}
+
+// the date and time in the zone of the visitor, like the CreatedAtDate methods of the models
+func localTime(ctx context.Context, t time.Time) string {
+	return t.In(location(ctx)).Format("Jan 2, 2006 at 3:04pm")
+}
+
+// the day in the zone of the visitor
+func localDate(ctx context.Context, t time.Time) string {
+	return t.In(location(ctx)).Format("Jan 2, 2006")
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
+)
+
+// exports allowed per user, an archive reads every file of the user
+var ExportRate = ratelimit.Rate{Burst: 3, Every: time.Hour}
+
+// GET /account/delete
+// Show the export of the data and the deletion of the account
+func AccountDataHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AccountDataTempl(user)).Render(request.Context(), writer)
+}
+
+// GET /account/export
+// Download a zip archive of the data of the user: data.json, the avatar and the attachments
+func ExportHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if limited(writer, request, ratelimit.Key("export", "user", user.Uuid), ExportRate) {
+		return
+	}
+	export, err := user.Export()
+	if err != nil {
+		danger(err, "Cannot export data of", user.Email)
+		error_message(writer, request, "Cannot export your data")
+		return
+	}
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("Content-Disposition", `attachment; filename="chitchat-`+user.Handle+`.zip"`)
+	archive := zip.NewWriter(writer)
+	defer archive.Close()
+
+	// the files first, so data.json can leave out the ones that are missing from the storage
+	if user.HasAvatar() {
+		if err := addToArchive(archive, export.Account.Avatar, user.AvatarKey); err != nil {
+			danger(err, "Cannot export avatar of", user.Email)
+			export.Account.Avatar = ""
+		}
+	}
+	for i, att := range export.Attachments {
+		if err := addToArchive(archive, att.File, att.StorageKey); err != nil {
+			danger(err, "Cannot export attachment", att.Uuid)
+			export.Attachments[i].File = ""
+		}
+	}
+	file, err := archive.Create("data.json")
+	if err != nil {
+		danger(err, "Cannot write export of", user.Email)
+		return
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		danger(err, "Cannot write export of", user.Email)
+		return
+	}
+	info("User", user.Email, "exported the data of the account")
+}
+
+// Copies the stored file into the archive
+func addToArchive(archive *zip.Writer, name, key string) (err error) {
+	src, err := Storage.Get(key)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := archive.Create(path.Clean(name))
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(dst, src)
+	return
+}
+
+// POST /account/delete
+// Ask to delete the account, the other sessions are logged out and the user is told by mail
+func RequestDeletionHandler(writer http.ResponseWriter, request *http.Request) {
+	sess, err := session(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := sess.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	if !passwordConfirmed(writer, request, user) {
+		return
+	}
+	if err := user.RequestDeletion(models.DeletionMode(request.PostFormValue("mode"))); err != nil {
+		if err == models.ErrInvalidDeletionMode {
+			error_message(writer, request, err.Error())
+			return
+		}
+		danger(err, "Cannot request deletion")
+		error_message(writer, request, "Cannot delete your account")
+		return
+	}
+	if _, err := user.DeleteOtherSessions(sess.Uuid); err != nil {
+		danger(err, "Cannot delete sessions")
+	}
+	info("User", user.Email, "asked to delete the account,", user.DeletionMode)
+	due := user.DeletionDueAt().In(user.Location()).Format("Jan 2, 2006")
+	link := BaseURL + "/account/delete"
+	text := "You asked to delete your ChitChat account. It will be deleted on " + due + ".\n\n" +
+		"Changed your mind? Log in and keep your account before then:\n" + link + "\n\n" +
+		"If you did not ask for this, change your password right away.\n"
+	if err := sendMail(request.Context(), user.Email, "Your account will be deleted", components.DeletionRequestedEmailTempl(due, link), text); err != nil {
+		danger(err, "Cannot queue deletion notice")
+	}
+	http.Redirect(writer, request, "/account/delete", 302)
+}
+
+// POST /account/delete/cancel
+// Keep the account
+func CancelDeletionHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := user.CancelDeletion(); err != nil && err != models.ErrNoDeletionPending {
+		danger(err, "Cannot cancel deletion")
+		error_message(writer, request, "Cannot keep your account")
+		return
+	}
+	info("User", user.Email, "kept the account")
+	http.Redirect(writer, request, "/account/delete", 302)
+}
+
+// Purges the accounts whose grace period is over and deletes their files
+func PurgeDeletedAccounts() (count int, err error) {
+	users, err := models.AccountsDueForPurge()
+	if err != nil {
+		return
+	}
+	for _, user := range users {
+		keys, err := models.PurgeAccount(user)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys {
+			if err := Storage.Delete(key); err != nil {
+				danger(err, "Cannot delete file", key, "of deleted account")
+			}
+		}
+		info("Purged account", user.Email, "with", len(keys), "files,", user.DeletionMode)
+		count++
+	}
+	return
+}
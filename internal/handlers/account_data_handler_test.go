@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/storage"
+)
+
+// the changes asking for the current password tell accounts without one how to get one
+func TestPasswordConfirmed(t *testing.T) {
+	setupDB(t)
+	local := createUser(t, "local", true)
+	external, err := models.CreateExternalUser("External", "external@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		user     models.User
+		password string
+		// the error shown, empty when the deletion is asked
+		problem string
+	}{
+		{"wrong password", local, "wrong", "The password is not correct"},
+		{"right password", local, "password", ""},
+		{"no password", external, "", "no password yet"},
+		// nothing hashes to the empty password of the account
+		{"no password, anything typed", external, "password", "no password yet"},
+	}
+	for _, test := range tests {
+		response := httptest.NewRecorder()
+		form := url.Values{"password": {test.password}, "mode": {string(models.DeleteAnonymize)}}
+		RequestDeletionHandler(response, formRequest(newSession(t, test.user), form))
+		message, _ := url.QueryUnescape(response.Header().Get("Location"))
+		if test.problem == "" && isErrorPage(response) || !strings.Contains(message, test.problem) {
+			t.Errorf("%s: answered %s, want %q", test.name, message, test.problem)
+		}
+		user, _ := models.UserById(test.user.Id)
+		if user.DeletionPending() != (test.problem == "") {
+			t.Errorf("%s: deletion pending %v", test.name, user.DeletionPending())
+		}
+	}
+
+	// the page links to the password reset instead of the form
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/account/delete", nil)
+	request.AddCookie(formRequest(newSession(t, external), nil).Cookies()[0])
+	AccountDataHandler(response, request)
+	if body := response.Body.String(); !strings.Contains(body, `href="/password/forgot"`) || strings.Contains(body, `name="password"`) {
+		t.Error("the deletion page of an account without a password asks for it")
+	}
+
+	// a password set with a reset is asked from then on
+	token, err := external.CreatePasswordReset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.ResetPassword(token, "chosen"); err != nil {
+		t.Fatal(err)
+	}
+	external, _ = models.UserById(external.Id)
+	if !external.HasPassword() {
+		t.Error("no password after the reset")
+	}
+}
+
+// the archive holds data.json with the stored files next to it, a file missing from the storage is left out
+func TestExport(t *testing.T) {
+	setupDB(t)
+	defer func(store storage.Storage) { Storage = store }(Storage)
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	Storage = local
+	user := createUser(t, "alice", true)
+	if err := local.Put("avatars/alice.png", []byte("avatar"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.SetAvatar("avatars/alice.png"); err != nil {
+		t.Fatal(err)
+	}
+	board := models.Category{Slug: "general", Name: "General"}
+	if err := board.Create(); err != nil {
+		t.Fatal(err)
+	}
+	thread, err := user.CreateThread(board, "Thread", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := user.CreatePost(thread, "With files", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := models.Attachment{Uuid: models.NewAttachmentUUID(), PostId: post.Id, UserId: user.Id, Filename: "../notes.txt",
+		ContentType: "text/plain", StorageKey: "attachments/stored"}
+	missing := models.Attachment{Uuid: models.NewAttachmentUUID(), PostId: post.Id, UserId: user.Id, Filename: "lost.txt",
+		ContentType: "text/plain", StorageKey: "attachments/missing"}
+	for _, att := range []*models.Attachment{&stored, &missing} {
+		if err := att.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := local.Put(stored.StorageKey, []byte("notes"), stored.ContentType); err != nil {
+		t.Fatal(err)
+	}
+
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/account/export", nil)
+	request.AddCookie(formRequest(newSession(t, user), nil).Cookies()[0])
+	ExportHandler(response, request)
+	if content := response.Header().Get("Content-Type"); content != "application/zip" {
+		t.Fatalf("answered %d %s", response.Code, content)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		src, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(src)
+		src.Close()
+		files[file.Name] = string(data)
+	}
+	notes := "attachments/" + stored.Uuid + "/notes.txt"
+	if len(files) != 3 || files["avatar.png"] != "avatar" || files[notes] != "notes" {
+		t.Errorf("the archive holds %v", files)
+	}
+
+	var export models.Export
+	if err := json.Unmarshal([]byte(files["data.json"]), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Account.Handle != "alice" || export.Account.Avatar != "avatar.png" {
+		t.Errorf("account %+v", export.Account)
+	}
+	if len(export.Threads) != 1 || len(export.Posts) != 1 || len(export.Attachments) != 2 {
+		t.Fatalf("%d threads, %d posts, %d attachments", len(export.Threads), len(export.Posts), len(export.Attachments))
+	}
+	for _, att := range export.Attachments {
+		if want := map[string]string{stored.Uuid: notes, missing.Uuid: ""}[att.Uuid]; att.File != want {
+			t.Errorf("attachment %s: file %q, want %q", att.Filename, att.File, want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// configuration shown on /admin/config, set by main with the secrets masked
+var Settings []components.Setting
+
+// version of the server shown on /admin/config
+var Version string
+
+// when the server started
+var startedAt = time.Now()
+
+// days of signups and posts charted on the dashboard
+const statsDays = 14
+
+// most users, sessions, threads and posts listed on one admin page
+const adminListLimit = 100
+
+// the bulk actions on threads and posts, as told in the notice once done
+var bulkDone = map[string]string{
+	"delete":  "Deleted",
+	"restore": "Restored",
+	"lock":    "Locked",
+	"unlock":  "Unlocked",
+}
+
+// the audit events of the bulk actions
+var bulkAudit = map[string]models.AuditKind{
+	"delete":  models.AuditContentDeleted,
+	"restore": models.AuditContentRestored,
+	"lock":    models.AuditThreadState,
+	"unlock":  models.AuditThreadState,
+}
+
+// GET /admin
+// Show the site statistics
+func AdminDashboardHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	stats, err := models.Stats(statsDays, user.Location())
+	if err != nil {
+		danger(err, "Cannot get site statistics")
+		error_message(writer, request, "Cannot get site statistics")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AdminDashboardTempl(stats)).Render(request.Context(), writer)
+}
+
+// GET /admin/config
+// Show the configuration the server runs with
+func AdminConfigHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	content := components.AdminConfigTempl(Settings, Version, startedAt)
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// GET /admin/users?q=
+// Show the users matching the search with their roles, HTMX only gets the table
+func AdminUsersHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	query := request.URL.Query().Get("q")
+	users, err := models.SearchUsers(query, adminListLimit)
+	if err != nil {
+		danger(err, "Cannot search users")
+		error_message(writer, request, "Cannot get users")
+		return
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		components.AdminUsersTableTempl(users, user).Render(request.Context(), writer)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AdminUsersTempl(users, query, user)).Render(request.Context(), writer)
+}
+
+// Shows the changed user, HTMX swaps the row of the table and a plain form goes back to the list
+func adminUserChanged(writer http.ResponseWriter, request *http.Request, user models.User, admin models.User) {
+	if request.Header.Get("HX-Request") == "true" {
+		components.AdminUserRowTempl(user, admin).Render(request.Context(), writer)
+		return
+	}
+	http.Redirect(writer, request, "/admin/users", 302)
+}
+
+// POST /admin/users/{id}/role
+// Change the role of a user
+func UpdateUserRoleHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	role, err := models.ParseRole(request.PostFormValue("role"))
+	if err != nil {
+		error_message(writer, request, "Unknown role")
+		return
+	}
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	if user.Id == admin.Id && role != models.RoleAdmin {
+		error_message(writer, request, "You cannot remove your own admin role")
+		return
+	}
+	previous := user.Role
+	if err := user.SetRole(role); err != nil {
+		danger(err, "Cannot change role")
+		error_message(writer, request, "Cannot change role")
+		return
+	}
+	info("User", user.Email, "is now", role, "set by", admin.Email)
+	if previous != role {
+		audit(request, models.AuditRoleChanged, admin, user.Id, "", string(previous)+" -> "+string(role))
+	}
+	adminUserChanged(writer, request, user, admin)
+}
+
+// Gets the user of the path who may be suspended or banned, admins have to be demoted first
+func sanctionedUser(writer http.ResponseWriter, request *http.Request, admin models.User) (user models.User, ok bool) {
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil || user.IsDeleted() {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	if user.Id == admin.Id || user.HasRole(models.RoleAdmin) {
+		error_message(writer, request, "Admins cannot be suspended or banned, change their role first")
+		return
+	}
+	return user, true
+}
+
+// POST /admin/users/{id}/suspend
+// Suspend a user for a number of days, they are logged out and cannot log in until then
+func SuspendUserHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, ok := sanctionedUser(writer, request, admin)
+	if !ok {
+		return
+	}
+	days, _ := strconv.Atoi(request.PostFormValue("days"))
+	err = user.Suspend(days, request.PostFormValue("reason"), origin(request, admin))
+	if err == models.ErrInvalidSuspension || err == models.ErrReasonTooLong {
+		error_message(writer, request, err.Error())
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot suspend user")
+		error_message(writer, request, "Cannot suspend user")
+		return
+	}
+	info("User", user.Email, "suspended for", days, "days by", admin.Email)
+	adminUserChanged(writer, request, user, admin)
+}
+
+// POST /admin/users/{id}/ban
+// Ban a user for good, they are logged out and cannot log in again
+func BanUserHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, ok := sanctionedUser(writer, request, admin)
+	if !ok {
+		return
+	}
+	err = user.Ban(request.PostFormValue("reason"), origin(request, admin))
+	if err == models.ErrReasonTooLong {
+		error_message(writer, request, err.Error())
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot ban user")
+		error_message(writer, request, "Cannot ban user")
+		return
+	}
+	info("User", user.Email, "banned by", admin.Email)
+	adminUserChanged(writer, request, user, admin)
+}
+
+// POST /admin/users/{id}/reinstate
+// Lift the suspension or the ban of a user
+func ReinstateUserHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	if err := user.Reinstate(origin(request, admin)); err != nil && err != models.ErrNotSanctioned {
+		danger(err, "Cannot reinstate user")
+		error_message(writer, request, "Cannot reinstate user")
+		return
+	}
+	info("User", user.Email, "reinstated by", admin.Email)
+	adminUserChanged(writer, request, user, admin)
+}
+
+// POST /admin/users/{id}/2fa/reset
+// Turn off the 2FA of a user who lost both the app and the recovery codes
+func ResetTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	if err := user.ResetTwoFactor(); err != nil {
+		danger(err, "Cannot reset two-factor authentication")
+		error_message(writer, request, "Cannot reset two-factor authentication")
+		return
+	}
+	info("Two-factor authentication of", user.Email, "reset by", admin.Email)
+	audit(request, models.AuditTwoFactorReset, admin, user.Id, "", "")
+	adminUserChanged(writer, request, user, admin)
+}
+
+// POST /admin/users/{id}/sessions/revoke
+// Log the user out on every device, for a stolen account or a departing member
+func RevokeUserSessionsHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	count, err := user.DeleteSessions()
+	if err != nil {
+		danger(err, "Cannot delete sessions")
+		error_message(writer, request, "Cannot log the user out")
+		return
+	}
+	info("Logged", user.Email, "out of", count, "sessions by", admin.Email)
+	audit(request, models.AuditSessionsRevoked, admin, user.Id, "", strconv.FormatInt(count, 10)+" sessions")
+	adminUserChanged(writer, request, user, admin)
+}
+
+// GET /admin/sessions
+// Show the logged in sessions of every user
+func AdminSessionsHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	sessions, err := models.AllSessions(adminListLimit)
+	if err != nil {
+		danger(err, "Cannot get sessions")
+		error_message(writer, request, "Cannot get sessions")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AdminSessionsTempl(sessions)).Render(request.Context(), writer)
+}
+
+// POST /admin/sessions/{id}/revoke
+// Log out one session of any user, HTMX removes its row
+func AdminRevokeSessionHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find session")
+		return
+	}
+	userId, err := models.DeleteSessionById(id)
+	if err != nil {
+		danger(err, "Cannot delete session")
+		error_message(writer, request, "Cannot log the session out")
+		return
+	}
+	info("Session", id, "logged out by", admin.Email)
+	if userId != 0 {
+		audit(request, models.AuditSessionRevoked, admin, userId, "session:"+strconv.Itoa(id), "")
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		return
+	}
+	http.Redirect(writer, request, "/admin/sessions", 302)
+}
+
+// GET /admin/content
+// Show the newest threads and posts of every board, deleted ones included
+func AdminContentHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	threads, err := models.NewestThreads(adminListLimit)
+	if err != nil {
+		danger(err, "Cannot get threads")
+		error_message(writer, request, "Cannot get threads")
+		return
+	}
+	posts, err := models.NewestPosts(adminListLimit)
+	if err != nil {
+		danger(err, "Cannot get posts")
+		error_message(writer, request, "Cannot get posts")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AdminContentTempl(threads, posts)).Render(request.Context(), writer)
+}
+
+// POST /admin/threads/bulk
+// Delete, restore, lock or unlock the checked threads
+func BulkThreadsHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	request.ParseForm()
+	action := request.PostFormValue("action")
+	if _, ok := bulkDone[action]; !ok {
+		error_message(writer, request, "Unknown action")
+		return
+	}
+	count := 0
+	for _, uuid := range request.PostForm["id"] {
+		thread, err := models.ThreadByUUID(uuid)
+		if err != nil {
+			continue
+		}
+		detail := ""
+		switch action {
+		case "delete":
+			err = thread.Delete()
+		case "restore":
+			err = thread.Restore()
+		case "lock", "unlock":
+			err = thread.SetState(models.StateLocked, action == "lock", admin)
+			detail = stateDetail(models.StateLocked, action == "lock")
+		}
+		// threads already in the state, or removed with their author, are left as they are
+		if err == models.ErrStateUnchanged || err == models.ErrNotRestorable {
+			continue
+		}
+		if err != nil {
+			danger(err, "Cannot", action, "thread", thread.Uuid)
+			continue
+		}
+		info("Thread", thread.Uuid, action, "by", admin.Email)
+		audit(request, bulkAudit[action], admin, thread.UserId, "thread:"+thread.Uuid, detail)
+		count++
+	}
+	if request.Header.Get("HX-Request") != "true" {
+		http.Redirect(writer, request, "/admin/content", 302)
+		return
+	}
+	threads, err := models.NewestThreads(adminListLimit)
+	if err != nil {
+		danger(err, "Cannot get threads")
+		error_message(writer, request, "Cannot get threads")
+		return
+	}
+	notice := fmt.Sprintf("%s %d of %d threads", bulkDone[action], count, len(request.PostForm["id"]))
+	components.AdminThreadsTableTempl(threads, notice).Render(request.Context(), writer)
+}
+
+// POST /admin/posts/bulk
+// Delete or restore the checked posts
+func BulkPostsHandler(writer http.ResponseWriter, request *http.Request) {
+	admin, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	request.ParseForm()
+	action := request.PostFormValue("action")
+	if action != "delete" && action != "restore" {
+		error_message(writer, request, "Unknown action")
+		return
+	}
+	count := 0
+	for _, uuid := range request.PostForm["id"] {
+		post, err := models.PostByUUID(uuid)
+		if err != nil {
+			continue
+		}
+		switch action {
+		case "delete":
+			err = post.Delete()
+		case "restore":
+			err = post.Restore()
+		}
+		if err == models.ErrNotRestorable {
+			continue
+		}
+		if err != nil {
+			danger(err, "Cannot", action, "post", post.Uuid)
+			continue
+		}
+		info("Post", post.Uuid, action, "by", admin.Email)
+		audit(request, bulkAudit[action], admin, post.UserId, "post:"+post.Uuid, "")
+		count++
+	}
+	if request.Header.Get("HX-Request") != "true" {
+		http.Redirect(writer, request, "/admin/content", 302)
+		return
+	}
+	posts, err := models.NewestPosts(adminListLimit)
+	if err != nil {
+		danger(err, "Cannot get posts")
+		error_message(writer, request, "Cannot get posts")
+		return
+	}
+	notice := fmt.Sprintf("%s %d of %d posts", bulkDone[action], count, len(request.PostForm["id"]))
+	components.AdminPostsTableTempl(posts, notice).Render(request.Context(), writer)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// the bulk actions count and audit only the threads they changed
+func TestBulkThreads(t *testing.T) {
+	setupDB(t)
+	admin := createUser(t, "admin", true)
+	if err := admin.SetRole(models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	session := newSession(t, admin)
+	thread, err := admin.CreateThread(models.Category{Id: 1}, "Thread", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blanked, err := admin.CreateThread(models.Category{Id: 1}, "Blanked", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as the purge of the account of the author leaves it
+	if _, err := models.Db.Exec("update threads set topic = '', deleted_at = current_timestamp where id = $1", blanked.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		action string
+		// the threads sent, and the audit entries of the action after it
+		ids     []string
+		audited int
+	}{
+		{"lock", []string{thread.Uuid}, 1},
+		{"lock", []string{thread.Uuid}, 1},
+		{"unlock", []string{thread.Uuid}, 2},
+		{"restore", []string{blanked.Uuid}, 0},
+		{"delete", []string{thread.Uuid}, 1},
+		{"restore", []string{thread.Uuid, blanked.Uuid}, 1},
+	}
+	for i, test := range tests {
+		BulkThreadsHandler(httptest.NewRecorder(), formRequest(session, url.Values{"action": {test.action}, "id": test.ids}))
+		events, err := models.AuditEvents(models.AuditFilter{Kind: bulkAudit[test.action]}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != test.audited {
+			t.Errorf("%d %s: %d entries audited, want %d", i+1, test.action, len(events), test.audited)
+		}
+	}
+}
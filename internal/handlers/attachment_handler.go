@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/taewony/go-fullstack-webapp/internal/media"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/storage"
+)
+
+// where attachments are kept, set up by main from the configuration
+var Storage storage.Storage
+
+// upload limits, set up by main from the configuration
+var (
+	MaxUploadSize  int64 = 5 << 20
+	MaxAttachments       = 5
+	ThumbnailSize        = 240
+)
+
+// a validated file waiting for its post to be created
+type upload struct {
+	filename    string
+	contentType string
+	data        []byte
+	thumb       []byte
+	thumbType   string
+}
+
+// Reads, validates and cleans the files of the "attachments" form field,
+// nothing is stored yet so a rejected file does not leave a half-made post
+func readUploads(request *http.Request) (uploads []upload, err error) {
+	if request.MultipartForm == nil {
+		return
+	}
+	headers := request.MultipartForm.File["attachments"]
+	if len(headers) > MaxAttachments {
+		err = fmt.Errorf("You can attach at most %d files", MaxAttachments)
+		return
+	}
+	for _, header := range headers {
+		var up upload
+		if up, err = readUpload(header); err != nil {
+			return
+		}
+		uploads = append(uploads, up)
+	}
+	return
+}
+
+func readUpload(header *multipart.FileHeader) (up upload, err error) {
+	name := filepath.Base(header.Filename)
+	if header.Size > MaxUploadSize {
+		err = fmt.Errorf("%s is larger than %d MB", name, MaxUploadSize>>20)
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+	if err != nil {
+		return
+	}
+	if int64(len(data)) > MaxUploadSize {
+		err = fmt.Errorf("%s is larger than %d MB", name, MaxUploadSize>>20)
+		return
+	}
+	contentType, err := media.Sniff(data)
+	if err != nil {
+		err = fmt.Errorf("%s is not an allowed file type", name)
+		return
+	}
+	if data, err = media.StripMetadata(contentType, data); err != nil {
+		err = fmt.Errorf("%s is not a valid image", name)
+		return
+	}
+	up = upload{filename: name, contentType: contentType, data: data}
+	if media.IsImage(contentType) {
+		if up.thumb, up.thumbType, err = media.Thumbnail(contentType, data, ThumbnailSize); err == media.ErrTooLarge {
+			err = fmt.Errorf("%s has too many pixels", name)
+			return
+		} else if err != nil {
+			err = fmt.Errorf("%s is not a valid image", name)
+			return
+		}
+	}
+	return
+}
+
+// Writes the uploads to the storage and records them against the post
+func storeUploads(user models.User, post models.Post, uploads []upload) (err error) {
+	for _, up := range uploads {
+		att := models.Attachment{
+			Uuid:        models.NewAttachmentUUID(),
+			PostId:      post.Id,
+			UserId:      user.Id,
+			Filename:    up.filename,
+			ContentType: up.contentType,
+			Size:        int64(len(up.data)),
+		}
+		att.StorageKey = "attachments/" + att.Uuid
+		if err = Storage.Put(att.StorageKey, up.data, up.contentType); err != nil {
+			return
+		}
+		if up.thumb != nil {
+			att.ThumbKey = "thumbnails/" + att.Uuid
+			if err = Storage.Put(att.ThumbKey, up.thumb, up.thumbType); err != nil {
+				return
+			}
+		}
+		if err = att.Create(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Checks that the visitor may see the attachment, files of deleted posts
+// and threads are only served to moderators
+func attachmentAllowed(writer http.ResponseWriter, request *http.Request, att models.Attachment) bool {
+	post, err := att.Post()
+	if err != nil {
+		return false
+	}
+	thread, err := post.Thread()
+	if err != nil || !canReadThread(writer, request, thread) {
+		return false
+	}
+	if post.IsDeleted() || post.IsHidden() || thread.IsDeleted() || thread.IsHidden() {
+		user, err := currentUser(writer, request)
+		return err == nil && user.Can(models.PermModerateContent)
+	}
+	return true
+}
+
+// GET /attachments/{id}
+// Serve an attached file
+func GetAttachmentHandler(writer http.ResponseWriter, request *http.Request) {
+	serveAttachment(writer, request, false)
+}
+
+// GET /attachments/{id}/thumb
+// Serve the thumbnail of an attached image
+func GetAttachmentThumbHandler(writer http.ResponseWriter, request *http.Request) {
+	serveAttachment(writer, request, true)
+}
+
+func serveAttachment(writer http.ResponseWriter, request *http.Request, thumb bool) {
+	att, err := models.AttachmentByUUID(request.PathValue("id"))
+	if err != nil || (thumb && !att.HasThumbnail()) {
+		http.NotFound(writer, request)
+		return
+	}
+	if !attachmentAllowed(writer, request, att) {
+		http.Error(writer, "Forbidden", http.StatusForbidden)
+		return
+	}
+	key, contentType := att.StorageKey, att.ContentType
+	if thumb {
+		key = att.ThumbKey
+		if contentType != "image/jpeg" {
+			contentType = "image/png"
+		}
+	}
+	file, err := Storage.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(writer, request)
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot read attachment", att.Uuid)
+		http.Error(writer, "Cannot read attachment", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	header := writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Cache-Control", "private, max-age=3600")
+	if !thumb {
+		header.Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	}
+	disposition := "attachment"
+	if media.IsImage(att.ContentType) {
+		disposition = "inline"
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": att.Filename}))
+	io.Copy(writer, file)
+}
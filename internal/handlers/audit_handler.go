@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// most audit events listed on the audit page, the export has them all
+const auditListLimit = 200
+
+// Gets who sent the request and from where, for the audit log
+func origin(request *http.Request, actor models.User) models.Origin {
+	return models.Origin{ActorId: actor.Id, IP: clientIP(request), RequestId: requestID(request)}
+}
+
+// Records an audit event caused by the request, actor is the zero User for anonymous visitors.
+// A failure is logged and does not stop the request, the action it records is already done.
+func audit(request *http.Request, kind models.AuditKind, actor models.User, userId int, target, detail string) {
+	if err := models.RecordAudit(kind, origin(request, actor), userId, target, detail); err != nil {
+		danger(err, "Cannot record audit event", kind)
+	}
+}
+
+// the detail of a thread state change in the audit log, like "locked" or "not locked"
+func stateDetail(state models.ThreadState, enabled bool) string {
+	if enabled {
+		return string(state)
+	}
+	return "not " + string(state)
+}
+
+// Reads the filter of the audit page, the dates are days in the zone of the admin
+func auditFilter(request *http.Request, loc *time.Location) (filter models.AuditFilter) {
+	query := request.URL.Query()
+	filter.Kind = models.AuditKind(query.Get("kind"))
+	filter.User = query.Get("user")
+	filter.IP = query.Get("ip")
+	if day, err := time.ParseInLocation(time.DateOnly, query.Get("from"), loc); err == nil {
+		filter.Since = day
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, query.Get("to"), loc); err == nil {
+		filter.Until = day.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// GET /admin/audit?kind=&user=&ip=&from=&to=
+// Show the latest audit events matching the filter and whether the hash chain holds
+func AdminAuditHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	filter := auditFilter(request, user.Location())
+	events, err := models.AuditEvents(filter, auditListLimit)
+	if err != nil {
+		danger(err, "Cannot get audit events")
+		error_message(writer, request, "Cannot get audit events")
+		return
+	}
+	var chain components.AuditChain
+	chain.Count, chain.Broken, chain.Head, err = models.VerifyAuditChain()
+	if err != nil {
+		danger(err, "Cannot verify audit chain")
+		error_message(writer, request, "Cannot verify the audit log")
+		return
+	}
+	if chain.Broken != 0 {
+		warning("Audit chain broken at event", chain.Broken)
+	}
+	content := components.AdminAuditTempl(events, request.URL.Query(), chain)
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// an audit event as exported, with the emails of the users since their ids mean nothing outside
+type auditRecord struct {
+	Id        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	ActorId   int64     `json:"actor_id,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	UserId    int64     `json:"user_id,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	IP        string    `json:"ip"`
+	RequestId string    `json:"request_id"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// GET /admin/audit/export?format=csv|json&kind=&user=&ip=&from=&to=
+// Download the audit events matching the filter, the oldest first so the hash chain reads in order
+func AuditExportHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	format := request.URL.Query().Get("format")
+	if format != "csv" && format != "json" {
+		error_message(writer, request, "Unknown export format")
+		return
+	}
+	events, err := models.AuditEvents(auditFilter(request, user.Location()), 0)
+	if err != nil {
+		danger(err, "Cannot get audit events")
+		error_message(writer, request, "Cannot get audit events")
+		return
+	}
+	slices.Reverse(events)
+	records := make([]auditRecord, len(events))
+	for i, event := range events {
+		records[i] = auditRecord{
+			Id:        event.Id,
+			Kind:      string(event.Kind),
+			ActorId:   event.ActorId.Int64,
+			Actor:     event.ActorEmail,
+			UserId:    event.UserId.Int64,
+			User:      event.UserEmail,
+			Target:    event.Target,
+			IP:        event.IP,
+			RequestId: event.RequestId,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt.UTC(),
+			PrevHash:  event.PrevHash,
+			Hash:      event.Hash,
+		}
+	}
+	info("Audit log exported as", format, "by", user.Email)
+	filename := "audit-" + time.Now().Format("20060102-150405") + "." + format
+	writer.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		writer.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(records); err != nil {
+			danger(err, "Cannot write audit export")
+		}
+		return
+	}
+	writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	out := csv.NewWriter(writer)
+	out.Write([]string{"id", "kind", "actor_id", "actor", "user_id", "user", "target", "ip", "request_id", "detail", "created_at", "prev_hash", "hash"})
+	for _, r := range records {
+		out.Write([]string{strconv.Itoa(r.Id), r.Kind, optionalId(r.ActorId), csvCell(r.Actor), optionalId(r.UserId), csvCell(r.User),
+			csvCell(r.Target), csvCell(r.IP), csvCell(r.RequestId), csvCell(r.Detail), r.CreatedAt.Format(time.RFC3339Nano), r.PrevHash, r.Hash})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		danger(err, "Cannot write audit export")
+	}
+}
+
+// an id of the export, empty when there is none
+func optionalId(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// the text for a cell of the export, quoted so that spreadsheets do not take it for a formula.
+// Visitors choose some of the text, like the email of a failed login.
+func csvCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
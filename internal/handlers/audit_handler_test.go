@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"alice@example.com", "alice@example.com"},
+		{"", ""},
+		{`=HYPERLINK("http://evil.example","click")`, `'=HYPERLINK("http://evil.example","click")`},
+		{"+1+1", "'+1+1"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, test := range tests {
+		if got := csvCell(test.text); got != test.want {
+			t.Errorf("csvCell(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+// the text a visitor typed in the login form is exported as text
+func TestAuditExportQuotesFormulas(t *testing.T) {
+	setupDB(t)
+	admin := createUser(t, "admin", true)
+	if err := admin.SetRole(models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	const typed = `=HYPERLINK("http://evil.example","click")`
+	if err := models.RecordAudit(models.AuditLoginFailed, models.Origin{IP: "127.0.0.1"}, 0, "", typed); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest("GET", "/admin/audit/export?format=csv", nil)
+	request.AddCookie(&http.Cookie{Name: "_cookie", Value: newSession(t, admin).Uuid})
+	response := httptest.NewRecorder()
+	AuditExportHandler(response, request)
+	records, err := csv.NewReader(response.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d rows exported, want the header and one entry", len(records))
+	}
+	if detail := records[1][9]; detail != "'"+typed {
+		t.Errorf("detail exported as %q", detail)
+	}
+}
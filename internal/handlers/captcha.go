@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/captcha"
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+)
+
+// the proof-of-work challenge of the signup and login forms, set up by main, nil asks none
+var Captcha *captcha.Issuer
+
+// ask for the challenge on signup
+var CaptchaSignup bool
+
+// failed logins of an email in a row after which logging in with it needs the challenge,
+// 0 never asks
+var CaptchaLoginFailures int
+
+// what the challenges are for, a solution only counts for the form it was issued to
+const (
+	captchaSignup = "signup"
+	captchaLogin  = "login"
+)
+
+// whether the form of the purpose shows a challenge. The login form always shows one when
+// it can be asked, the email it is needed for is only known once the form is sent.
+func captchaShown(purpose string) bool {
+	if Captcha == nil {
+		return false
+	}
+	switch purpose {
+	case captchaSignup:
+		return CaptchaSignup
+	case captchaLogin:
+		return CaptchaLoginFailures > 0
+	}
+	return false
+}
+
+// a new challenge for the form of the purpose, nil when it shows none
+func challenge(purpose string) *captcha.Challenge {
+	if !captchaShown(purpose) {
+		return nil
+	}
+	c := Captcha.Issue(purpose)
+	return &c
+}
+
+// the challenge rendered for the pages made with html/template
+func challengeHTML(ctx context.Context, purpose string) template.HTML {
+	return componentHTML(ctx, components.CaptchaTempl(challenge(purpose)))
+}
+
+// Checks the challenge solved in the form of the purpose, answering with an error when it
+// is not solved
+func solvedCaptcha(writer http.ResponseWriter, request *http.Request, purpose string) bool {
+	err := Captcha.Verify(purpose, request.PostFormValue("captcha"), request.PostFormValue("captcha_solution"))
+	if err != nil {
+		warning("Failed", purpose, "challenge from", clientIP(request), err)
+		error_message(writer, request, "Cannot check that you are not a bot, "+err.Error()+", please try again")
+		return false
+	}
+	return true
+}
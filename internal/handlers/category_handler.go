@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /c/{slug}?page=
+// Show the threads of a board
+func CategoryHandler(writer http.ResponseWriter, request *http.Request) {
+	cat, err := models.CategoryBySlug(request.PathValue("slug"))
+	if err != nil {
+		error_message(writer, request, "Cannot find board")
+		return
+	}
+	user, _ := currentUser(writer, request)
+	if !user.CanRead(cat) {
+		error_message(writer, request, "You are not allowed to read this board")
+		return
+	}
+	readable, err := models.ReadableCategories(user)
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
+	}
+	var children []models.Category
+	for _, child := range readable {
+		if child.ParentId.Valid && int(child.ParentId.Int64) == cat.Id {
+			children = append(children, child)
+		}
+	}
+	page := pageNumber(request)
+	threads, more, err := models.Threads(models.ThreadFilter{CategoryIds: []int{cat.Id}, Page: page})
+	if err != nil {
+		error_message(writer, request, "Cannot get threads")
+		return
+	}
+	content := components.CategoryTempl(cat, children, threads, readMarks(writer, request, threads), pager(request, page, more), user.CanPost(cat))
+	components.PageTempl(navbar(writer, request), content).Render(request.Context(), writer)
+}
+
+// GET /admin/categories
+// Show all the boards with the form to add one
+func AdminCategoriesHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	cats, err := models.Categories()
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AdminCategoriesTempl(cats)).Render(request.Context(), writer)
+}
+
+// POST /admin/categories
+// Add a board
+func CreateCategoryHandler(writer http.ResponseWriter, request *http.Request) {
+	cat := models.Category{
+		Slug:        request.PostFormValue("slug"),
+		Name:        request.PostFormValue("name"),
+		Description: request.PostFormValue("description"),
+	}
+	cat.Position, _ = strconv.Atoi(request.PostFormValue("position"))
+	if slug := request.PostFormValue("parent"); slug != "" {
+		parent, err := models.CategoryBySlug(slug)
+		if err != nil {
+			error_message(writer, request, "Cannot find parent board")
+			return
+		}
+		cat.ParentId = sql.NullInt64{Int64: int64(parent.Id), Valid: true}
+	}
+	if name := request.PostFormValue("read_role"); name != "" {
+		role, err := models.ParseRole(name)
+		if err != nil {
+			error_message(writer, request, "Unknown role")
+			return
+		}
+		cat.ReadRole = role
+	}
+	role, err := models.ParseRole(request.PostFormValue("post_role"))
+	if err != nil {
+		error_message(writer, request, "Unknown role")
+		return
+	}
+	cat.PostRole = role
+	if err := cat.Create(); err != nil {
+		danger(err, "Cannot create board")
+		error_message(writer, request, "Cannot create board: "+err.Error())
+		return
+	}
+	http.Redirect(writer, request, "/admin/categories", 302)
+}
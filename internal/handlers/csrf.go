@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+)
+
+// Every request changing something must send back the CSRF token of the visitor, in the
+// csrf_token field of its form or in the X-CSRF-Token header HTMX adds. A logged in visitor
+// has the token of the session, made with it and gone with it. Anonymous visitors, and the
+// sessions made before the tokens, have the one of the _csrf cookie, for the login and
+// signup forms.
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfCookie = "_csrf"
+)
+
+// Refuses the requests changing something without the CSRF token of the visitor, and gives
+// the pages the token for their forms
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token := csrfToken(writer, request)
+		request = request.WithContext(components.WithCSRFToken(request.Context(), token))
+		switch request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(writer, request)
+			return
+		}
+		sent := request.Header.Get(csrfHeader)
+		if sent == "" {
+			// the field of a multipart form is only read with the whole form, read within the
+			// size of the largest upload, the handlers check their own limits on the files
+			if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+				request.Body = http.MaxBytesReader(writer, request.Body, MaxUploadSize*int64(MaxAttachments)+1<<20)
+				if err := request.ParseMultipartForm(MaxUploadSize); err != nil {
+					danger(err, "Cannot parse form")
+					error_message(writer, request, "The attachments are too large")
+					return
+				}
+			}
+			sent = request.PostFormValue(csrfField)
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			warning("Refused", request.Method, request.URL.Path, "from", clientIP(request), "without the CSRF token")
+			error_message(writer, request, "This page has expired, please reload it and try again")
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// the token of the session of the visitor, or of its _csrf cookie, set when it has none
+func csrfToken(writer http.ResponseWriter, request *http.Request) string {
+	if sess, err := session(writer, request); err == nil && sess.CSRFToken != "" {
+		return sess.CSRFToken
+	}
+	if cookie, err := request.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(writer, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secureCookies(request),
+	})
+	return token
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// a session of the user, as the browser holds it after logging in
+func newSession(t *testing.T, user models.User) models.Session {
+	t.Helper()
+	session, err := user.CreateSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestCSRF(t *testing.T) {
+	setupDB(t)
+	alice, bob := newSession(t, createUser(t, "alice", true)), newSession(t, createUser(t, "bob", true))
+	reached := false
+	handler := CSRF(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true }))
+
+	form := func(token string) *http.Request {
+		request := httptest.NewRequest("POST", "/thread/create", strings.NewReader(url.Values{"csrf_token": {token}, "topic": {"hi"}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return request
+	}
+	header := func(token string) *http.Request {
+		request := httptest.NewRequest("POST", "/post/preview", nil)
+		request.Header.Set("HX-Request", "true")
+		request.Header.Set("X-CSRF-Token", token)
+		return request
+	}
+	upload := func(token string) *http.Request {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("csrf_token", token)
+		part, _ := writer.CreateFormFile("attachments", "a.txt")
+		part.Write([]byte("hello"))
+		writer.Close()
+		request := httptest.NewRequest("POST", "/thread/post", &body)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		return request
+	}
+	withSession := func(request *http.Request, session models.Session) *http.Request {
+		request.AddCookie(&http.Cookie{Name: "_cookie", Value: session.Uuid})
+		return request
+	}
+	anonymous := &http.Cookie{Name: "_csrf", Value: "anonymous-token"}
+	withAnonymous := func(request *http.Request) *http.Request {
+		request.AddCookie(anonymous)
+		return request
+	}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		ok      bool
+	}{
+		{"read", withSession(httptest.NewRequest("GET", "/thread/new", nil), alice), true},
+		{"form with the token of the session", withSession(form(alice.CSRFToken), alice), true},
+		{"HTMX header with the token of the session", withSession(header(alice.CSRFToken), alice), true},
+		{"upload with the token of the session", withSession(upload(alice.CSRFToken), alice), true},
+		{"anonymous form with the token of the cookie", withAnonymous(form(anonymous.Value)), true},
+		{"form without a token", withSession(form(""), alice), false},
+		{"HTMX request without a token", withSession(header(""), alice), false},
+		{"upload without a token", withSession(upload(""), alice), false},
+		{"form with the token of another session", withSession(form(bob.CSRFToken), alice), false},
+		{"logged in form with the token of the cookie", withAnonymous(withSession(form(anonymous.Value), alice)), false},
+		{"anonymous form with another token", withAnonymous(form(alice.CSRFToken)), false},
+		{"anonymous form without a cookie", form(""), false},
+		{"token in the query only", withSession(httptest.NewRequest("POST", "/thread/create?csrf_token="+alice.CSRFToken, nil), alice), false},
+	}
+	for _, test := range tests {
+		reached = false
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, test.request)
+		if reached != test.ok {
+			t.Errorf("%s: reached the handler %v, want %v", test.name, reached, test.ok)
+		}
+		if !test.ok && !isErrorPage(response) {
+			t.Errorf("%s: answered %d without the error page", test.name, response.Code)
+		}
+	}
+
+	// an anonymous visitor gets a token in a cookie, it goes with the pages
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/login", nil))
+	cookie := responseCookie(response, "_csrf")
+	if cookie == nil || len(cookie.Value) < 32 || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("anonymous token cookie %+v", cookie)
+	}
+	reached = false
+	request := form(cookie.Value)
+	request.AddCookie(cookie)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if !reached {
+		t.Error("the form with the token of the new cookie was refused")
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice", true)
+	defer func(base string) { BaseURL = base }(BaseURL)
+	tests := []struct {
+		name    string
+		baseURL string
+		tls     bool
+		secure  bool
+	}{
+		{"plain HTTP", "http://localhost:8080", false, false},
+		{"served over HTTPS", "http://localhost:8080", true, true},
+		{"behind an HTTPS proxy", "https://chitchat.example", false, true},
+	}
+	for _, test := range tests {
+		BaseURL = test.baseURL
+		request := httptest.NewRequest("POST", "/authenticate", nil)
+		if test.tls {
+			request.TLS = &tls.ConnectionState{}
+		}
+		response := httptest.NewRecorder()
+		startSession(response, request, user, "password")
+		cookie := responseCookie(response, "_cookie")
+		if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Secure != test.secure {
+			t.Errorf("%s: session cookie %+v, want HttpOnly, SameSite=Lax and Secure %v", test.name, cookie, test.secure)
+		}
+	}
+}
+
+// logging out is a change like the others, another site cannot do it for the user
+func TestLogout(t *testing.T) {
+	setupDB(t)
+	handler := CSRF(http.HandlerFunc(LogoutHandler))
+	session := newSession(t, createUser(t, "alice", true))
+
+	tests := []struct {
+		name      string
+		form      url.Values
+		loggedOut bool
+	}{
+		{"without the token", url.Values{}, false},
+		{"with the token of the session", url.Values{"csrf_token": {session.CSRFToken}}, true},
+	}
+	for _, test := range tests {
+		handler.ServeHTTP(httptest.NewRecorder(), formRequest(session, test.form))
+		if valid, _ := session.Check(); valid == test.loggedOut {
+			t.Errorf("%s: logged out %v, want %v", test.name, !valid, test.loggedOut)
+		}
+	}
+}
+
+// a user banned while logged in cannot post with the session left over
+func TestCreateChecksTheBan(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice", true)
+	session := newSession(t, user)
+	thread, err := user.CreateThread(models.Category{Id: 1}, "before the ban", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Db.Exec("update users set banned_at = current_timestamp where id = $1", user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		form    url.Values
+	}{
+		{"thread", CreateThreadHandler, url.Values{"topic": {"after the ban"}, "category": {"general"}}},
+		{"post", CreatePostHandler, url.Values{"body": {"after the ban"}, "uuid": {thread.Uuid}}},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(test.form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(&http.Cookie{Name: "_cookie", Value: session.Uuid})
+		response := httptest.NewRecorder()
+		test.handler(response, request)
+		if location := response.Header().Get("Location"); location != "/login" {
+			t.Errorf("%s: answered %d to %s, want the login page", test.name, response.Code, location)
+		}
+	}
+	var count int
+	models.Db.QueryRow("SELECT (SELECT count(*) FROM threads WHERE user_id = $1) + (SELECT count(*) FROM posts WHERE user_id = $1)", user.Id).Scan(&count)
+	if count != 1 {
+		t.Errorf("the banned user has %d threads and posts, want the one from before the ban", count)
+	}
+}
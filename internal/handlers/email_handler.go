@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// Emails the user a link confirming the address, either the signup address or a new one
+func sendEmailVerification(ctx context.Context, user models.User, email string) (err error) {
+	token, err := user.CreateEmailVerification(email)
+	if err != nil {
+		return
+	}
+	link := BaseURL + "/email/verify/" + token
+	text := "Please confirm that " + email + " is the address of your ChitChat account by opening this link:\n" +
+		link + "\n\nThe link works for a day. If you did not ask for it, ignore this email.\n"
+	return sendMail(ctx, email, "Confirm your email address", components.VerifyEmailTempl(email, link), text)
+}
+
+// GET /email/verify/{token}
+// Confirm the address of the link, an email change is applied and the old address is told
+func VerifyEmailHandler(writer http.ResponseWriter, request *http.Request) {
+	user, oldEmail, err := models.VerifyEmail(request.PathValue("token"))
+	if err != nil {
+		if err != models.ErrInvalidVerification && err != models.ErrEmailTaken {
+			danger(err, "Cannot verify email")
+			err = models.ErrInvalidVerification
+		}
+		error_message(writer, request, err.Error())
+		return
+	}
+	if oldEmail != "" {
+		info("Email of", user.Handle, "changed from", oldEmail, "to", user.Email)
+		text := "The email address of your ChitChat account was changed to " + user.Email + ".\n\n" +
+			"If you did not make this change, reset your password and contact the administrators.\n"
+		if err := sendMail(request.Context(), oldEmail, "Your email address was changed", components.EmailChangedTempl(user.Email), text); err != nil {
+			danger(err, "Cannot queue email change notice")
+		}
+	}
+	http.Redirect(writer, request, "/account/email?verified=1", 302)
+}
+
+// GET /account/email
+// Show the email of the user, whether it is verified and the form to change it
+func AccountEmailHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	notice := ""
+	switch {
+	case request.URL.Query().Get("verified") != "":
+		notice = "Your email address is verified."
+	case request.URL.Query().Get("sent") != "":
+		notice = "A confirmation link is on its way, check your inbox."
+	}
+	content := components.AccountEmailTempl(user, user.PendingEmail(), notice)
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// POST /account/email
+// Ask to change the email, the change waits until the new address is confirmed
+func ChangeEmailHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	if !passwordConfirmed(writer, request, user) {
+		return
+	}
+	email := request.PostFormValue("email")
+	if email == "" || email == user.Email {
+		http.Redirect(writer, request, "/account/email", 302)
+		return
+	}
+	if err := sendEmailVerification(request.Context(), user, email); err != nil {
+		verificationError(writer, request, err)
+		return
+	}
+	http.Redirect(writer, request, "/account/email?sent=1", 302)
+}
+
+// POST /account/email/resend
+// Send the confirmation link again, for the pending change or else the unverified email
+func ResendVerificationHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	email := user.PendingEmail()
+	if email == "" {
+		email = user.Email
+	}
+	if err := sendEmailVerification(request.Context(), user, email); err != nil {
+		verificationError(writer, request, err)
+		return
+	}
+	http.Redirect(writer, request, "/account/email?sent=1", 302)
+}
+
+// shows the errors meant for the user, and a generic message for the others
+func verificationError(writer http.ResponseWriter, request *http.Request, err error) {
+	switch err {
+	case models.ErrEmailTaken, models.ErrTooManyVerifications, models.ErrEmailAlreadyConfirmed:
+		error_message(writer, request, err.Error())
+	default:
+		danger(err, "Cannot send verification email")
+		error_message(writer, request, "Cannot send verification email")
+	}
+}
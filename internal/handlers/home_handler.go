@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
 
@@ -17,44 +17,67 @@ func ErrorHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("HX-Request") == "true" {
 		components.ErrorTempl(encodedMsg).Render(r.Context(), w)
 	} else {
+		data := struct {
+			Message string
+			CSRF    template.HTML
+		}{encodedMsg, componentHTML(r.Context(), components.CSRFTempl())}
 		_, err := session(w, r)
 		if err != nil {
-			generateHTML(w, encodedMsg, "layout", "public.navbar", "error")
+			generateHTML(w, data, "layout", "public.navbar", "error")
 		} else {
-			generateHTML(w, encodedMsg, "layout", "private.navbar", "error")
+			generateHTML(w, data, "layout", "private.navbar", "error")
 		}
 	}
 }
 
+// GET /index?sort=&page=
+// Show the threads of every board the visitor may read, only the thread list for HTMX requests
 func IndexHandler(writer http.ResponseWriter, request *http.Request) {
-	if request.Header.Get("HX-Request") == "true" {
-		fmt.Println("HX-Request")
-	} else {
-		fmt.Println("HTML-Request")
+	user, _ := currentUser(writer, request)
+	ids, err := models.ReadableCategoryIds(user)
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
 	}
-	threads, err := models.Threads()
+	sort := models.ParseThreadSort(request.URL.Query().Get("sort"))
+	page := pageNumber(request)
+	threads, more, err := models.Threads(models.ThreadFilter{CategoryIds: ids, Sort: sort, Page: page})
 	if err != nil {
 		error_message(writer, request, "Cannot get threads")
 		return
 	}
-	_, err = session(writer, request)
-	if err != nil {
-		components.LayoutTempl(components.PublicNavbarTempl(), threads).Render(request.Context(), writer)
-	} else {
-		components.LayoutTempl(components.PrivateNavbarTempl(), threads).Render(request.Context(), writer)
+	marks := readMarks(writer, request, threads)
+	if request.Header.Get("HX-Request") == "true" {
+		components.ThreadItemsTempl(threads, marks, pager(request, page, more)).Render(request.Context(), writer)
+		return
 	}
+	components.LayoutTempl(navbar(writer, request), threads, sort, marks, pager(request, page, more)).Render(request.Context(), writer)
 }
 
+// GET /
+// Show the boards with their latest activity
 func HomeHandler(writer http.ResponseWriter, request *http.Request) {
-	threads, err := models.Threads()
+	user, _ := currentUser(writer, request)
+	summaries, err := models.CategorySummaries(user)
 	if err != nil {
-		error_message(writer, request, "Cannot get threads")
+		error_message(writer, request, "Cannot get boards")
 		return
 	}
-	_, err = session(writer, request)
+	components.PageTempl(navbar(writer, request), components.CategoriesTempl(summaries)).Render(request.Context(), writer)
+}
+
+// POST /threads/read
+// Mark every thread as read
+func MarkAllReadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
 	if err != nil {
-		generateHTML(writer, threads, "layout", "public.navbar", "index")
-	} else {
-		generateHTML(writer, threads, "layout", "private.navbar", "index")
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := user.MarkAllRead(); err != nil {
+		danger(err, "Cannot mark threads as read")
+		error_message(writer, request, "Cannot mark threads as read")
+		return
 	}
+	http.Redirect(writer, request, "/index", 302)
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/a-h/templ"
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// set up by main from the configuration
+var (
+	// address of the site, links in emails are made absolute with it
+	BaseURL = "http://localhost:8080"
+	// serve the /dev/mailbox pages, only in development
+	DevMailbox bool
+)
+
+// Renders the email and queues it in the outbox, the delivery worker sends it
+func sendMail(ctx context.Context, to, subject string, content templ.Component, text string) error {
+	var html bytes.Buffer
+	if err := components.EmailTempl(content).Render(ctx, &html); err != nil {
+		return err
+	}
+	return models.QueueMail(to, subject, text, html.String())
+}
+
+// GET /dev/mailbox
+// Show the mails of the outbox
+func MailboxHandler(writer http.ResponseWriter, request *http.Request) {
+	mails, err := models.OutboxMails(100)
+	if err != nil {
+		danger(err, "Cannot get mails")
+		error_message(writer, request, "Cannot get mails")
+		return
+	}
+	components.PageTempl(navbar(writer, request), components.MailboxTempl(mails)).Render(request.Context(), writer)
+}
+
+// GET /dev/mailbox/{id}
+// Show a mail of the outbox
+func MailHandler(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.Atoi(request.PathValue("id"))
+	var m models.OutboxMail
+	if err == nil {
+		m, err = models.OutboxMailById(id)
+	}
+	if err != nil {
+		error_message(writer, request, "Cannot find mail")
+		return
+	}
+	components.PageTempl(navbar(writer, request), components.MailTempl(m)).Render(request.Context(), writer)
+}
+
+// POST /dev/mailbox/test
+// Queue a test email
+func TestMailHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	to, note := request.PostFormValue("to"), request.PostFormValue("note")
+	text := "This is a test email.\n\n" + note
+	if err := sendMail(request.Context(), to, "Test email", components.TestEmailTempl(note), text); err != nil {
+		danger(err, "Cannot queue mail")
+		error_message(writer, request, "Cannot queue mail")
+		return
+	}
+	http.Redirect(writer, request, "/dev/mailbox", 302)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
+)
+
+// Only lets users holding the given role (or a more privileged one) through,
+// anonymous visitors are sent to the login page
+func RequireRole(role models.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		user, err := currentUser(writer, request)
+		if err != nil {
+			http.Redirect(writer, request, "/login", http.StatusFound)
+			return
+		}
+		if !user.HasRole(role) {
+			warning("User", user.Email, "denied access to", request.URL.Path)
+			error_message(writer, request, "You are not allowed to access this page")
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// Limits the requests of each address to the route, over the limit the answer is 429
+func RateLimit(route string, rate ratelimit.Rate, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if limited(writer, request, ratelimit.Key(route, "ip", clientIP(request)), rate) {
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// Shows the dates of the pages in the timezone chosen by the logged in user
+func LocalTime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user, err := currentUser(writer, request); err == nil && user.Timezone != "" {
+			request = request.WithContext(components.WithLocation(request.Context(), user.Location()))
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+type requestIdKey struct{}
+
+// Gives every request an id, sent back in the X-Request-Id header and kept with the audit events
+// it causes, so that an event can be matched with what the user saw
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id := hex.EncodeToString(b)
+		writer.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), requestIdKey{}, id)))
+	})
+}
+
+// Gets the id the RequestID middleware gave the request
+func requestID(request *http.Request) string {
+	id, _ := request.Context().Value(requestIdKey{}).(string)
+	return id
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+func TestRequireRole(t *testing.T) {
+	setupDB(t)
+	member := createUser(t, "member", true)
+	moderator, admin := createUser(t, "moderator", true), createUser(t, "admin", true)
+	if err := moderator.SetRole(models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.SetRole(models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// the session cookie sent, none for a visitor
+		user    *models.User
+		role    models.Role
+		allowed bool
+		// where a refused request is sent
+		location string
+	}{
+		{"visitor", nil, models.RoleMember, false, "/login"},
+		{"member to a moderator page", &member, models.RoleModerator, false, "/err?"},
+		{"member to an admin page", &member, models.RoleAdmin, false, "/err?"},
+		{"moderator to an admin page", &moderator, models.RoleAdmin, false, "/err?"},
+		{"member to a member page", &member, models.RoleMember, true, ""},
+		{"moderator to a moderator page", &moderator, models.RoleModerator, true, ""},
+		// a higher role holds the lower ones
+		{"admin to a moderator page", &admin, models.RoleModerator, true, ""},
+	}
+	for _, test := range tests {
+		reached := false
+		handler := RequireRole(test.role, func(http.ResponseWriter, *http.Request) { reached = true })
+		request := httptest.NewRequest("GET", "/admin", nil)
+		if test.user != nil {
+			request.AddCookie(&http.Cookie{Name: "_cookie", Value: newSession(t, *test.user).Uuid})
+		}
+		response := httptest.NewRecorder()
+		handler(response, request)
+		if reached != test.allowed {
+			t.Errorf("%s: reached %v, want %v", test.name, reached, test.allowed)
+		}
+		if location := response.Header().Get("Location"); !test.allowed && !strings.HasPrefix(location, test.location) {
+			t.Errorf("%s: sent to %q, want %q", test.name, location, test.location)
+		}
+	}
+}
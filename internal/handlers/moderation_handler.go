@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /mod
+// Show the latest posts with moderation actions
+func ModerationHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	posts, err := models.RecentPosts(50)
+	if err != nil {
+		error_message(writer, request, "Cannot get posts")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.ModerationTempl(posts)).Render(request.Context(), writer)
+}
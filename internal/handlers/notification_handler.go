@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /notifications
+// Show the latest notifications of the user
+func NotificationsHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	notifs, err := user.Notifications(100)
+	if err != nil {
+		error_message(writer, request, "Cannot get notifications")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.NotificationsTempl(notifs)).Render(request.Context(), writer)
+}
+
+// GET /notifications/count
+// Render the unread count of the bell, polled by HTMX
+func NotificationCountHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	count, err := user.UnreadNotifications()
+	if err != nil {
+		danger(err, "Cannot count notifications")
+	}
+	components.NotificationCountTempl(count).Render(request.Context(), writer)
+}
+
+// GET /notifications/{id}
+// Mark the notification as read and go to the post it is about
+func OpenNotificationHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	notif, ok := userNotification(writer, request, user)
+	if !ok {
+		return
+	}
+	if err := notif.MarkRead(); err != nil {
+		danger(err, "Cannot mark notification as read")
+	}
+	http.Redirect(writer, request, notif.Target(), 302)
+}
+
+// POST /notifications/{id}/read
+// Mark a notification as read
+func ReadNotificationHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	notif, ok := userNotification(writer, request, user)
+	if !ok {
+		return
+	}
+	if err := notif.MarkRead(); err != nil {
+		danger(err, "Cannot mark notification as read")
+		error_message(writer, request, "Cannot mark notification as read")
+		return
+	}
+	http.Redirect(writer, request, "/notifications", 302)
+}
+
+// POST /notifications/read
+// Mark all the notifications as read
+func ReadAllNotificationsHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := user.MarkNotificationsRead(); err != nil {
+		danger(err, "Cannot mark notifications as read")
+		error_message(writer, request, "Cannot mark notifications as read")
+		return
+	}
+	http.Redirect(writer, request, "/notifications", 302)
+}
+
+// GET /notifications/preferences
+// Show which events notify the user
+func NotificationPreferencesHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.NotificationPreferencesTempl(user)).Render(request.Context(), writer)
+}
+
+// POST /notifications/preferences
+// Save which events notify the user, unchecked kinds are turned off
+func UpdateNotificationPreferencesHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	for _, kind := range models.NotificationKinds() {
+		if err := user.SetNotifies(kind, request.PostFormValue(string(kind)) == "on"); err != nil {
+			danger(err, "Cannot save notification preferences")
+			error_message(writer, request, "Cannot save notification preferences")
+			return
+		}
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		components.NotificationPreferencesFormTempl(user, "Your preferences are saved.").Render(request.Context(), writer)
+		return
+	}
+	http.Redirect(writer, request, "/notifications/preferences", 302)
+}
+
+// POST /thread/{id}/watch
+// Notify the user of every reply to the thread
+func WatchThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !canReadThread(writer, request, thread) {
+		error_message(writer, request, "You are not allowed to read this thread")
+		return
+	}
+	if err := user.Watch(thread); err != nil {
+		danger(err, "Cannot watch thread")
+		error_message(writer, request, "Cannot watch thread")
+		return
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// POST /thread/{id}/unwatch
+// Stop notifying the user of the replies to the thread
+func UnwatchThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if err := user.Unwatch(thread); err != nil {
+		danger(err, "Cannot unwatch thread")
+		error_message(writer, request, "Cannot unwatch thread")
+		return
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// Gets the notification of the {id} path value, redirecting to the error page if the user does not own it
+func userNotification(writer http.ResponseWriter, request *http.Request, user models.User) (notif models.Notification, ok bool) {
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err == nil {
+		notif, err = user.Notification(id)
+	}
+	if err != nil {
+		error_message(writer, request, "Cannot find notification")
+		return
+	}
+	return notif, true
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc"
+)
+
+// identity providers users can log in with, set up by main from the configuration
+var (
+	Providers []*oidc.Provider
+	// providers whose users get an account on their first login, by name
+	OpenSignup = map[string]bool{}
+)
+
+// Gets the provider of the {provider} path value
+func provider(request *http.Request) (p *oidc.Provider, ok bool) {
+	for _, p := range Providers {
+		if p.Name == request.PathValue("provider") {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Saves a login attempt and sends the user to the provider, the state is also kept in a
+// cookie so the callback only completes in the browser that started the login
+func startProviderLogin(writer http.ResponseWriter, request *http.Request, p *oidc.Provider, linkUserId sql.NullInt64) {
+	attempt := oidc.NewAttempt()
+	err := models.CreateLoginAttempt(attempt.State, models.LoginAttempt{Provider: p.Name, Nonce: attempt.Nonce, Verifier: attempt.Verifier, LinkUserId: linkUserId})
+	if err != nil {
+		danger(err, "Cannot save login attempt")
+		error_message(writer, request, "Cannot log in with "+p.Label)
+		return
+	}
+	url, err := p.AuthURL(request.Context(), attempt)
+	if err != nil {
+		danger(err, "Cannot reach provider", p.Name)
+		error_message(writer, request, "Cannot reach "+p.Label+", please try again later")
+		return
+	}
+	http.SetCookie(writer, &http.Cookie{
+		Name:     "_oidc_state",
+		Value:    attempt.State,
+		Path:     "/auth/" + p.Name,
+		MaxAge:   int(models.LoginAttemptTTL.Seconds()),
+		HttpOnly: true,
+		// the provider redirects back with a top-level GET, which Lax still sends the cookie with
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secureCookies(request),
+	})
+	http.Redirect(writer, request, url, http.StatusFound)
+}
+
+// GET /auth/{provider}/login
+// Send the visitor to log in at the provider
+func ProviderLoginHandler(writer http.ResponseWriter, request *http.Request) {
+	p, ok := provider(request)
+	if !ok {
+		http.NotFound(writer, request)
+		return
+	}
+	startProviderLogin(writer, request, p, sql.NullInt64{})
+}
+
+// POST /account/logins/{provider}/link
+// Send the user to the provider to link an account of it
+func LinkProviderHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	p, ok := provider(request)
+	if !ok {
+		http.NotFound(writer, request)
+		return
+	}
+	startProviderLogin(writer, request, p, sql.NullInt64{Int64: int64(user.Id), Valid: true})
+}
+
+// GET /auth/{provider}/callback
+// Finish the login at the provider: log in the linked user, link the account of the same
+// verified email, or create an account when the provider allows it
+func ProviderCallbackHandler(writer http.ResponseWriter, request *http.Request) {
+	p, ok := provider(request)
+	if !ok {
+		http.NotFound(writer, request)
+		return
+	}
+	query := request.URL.Query()
+	if query.Get("error") != "" {
+		warning("Login with", p.Name, "failed:", query.Get("error"), query.Get("error_description"))
+		error_message(writer, request, "The login with "+p.Label+" was cancelled")
+		return
+	}
+	state := query.Get("state")
+	cookie, err := request.Cookie("_oidc_state")
+	if err != nil || state == "" || cookie.Value != state {
+		error_message(writer, request, models.ErrInvalidLoginAttempt.Error())
+		return
+	}
+	http.SetCookie(writer, &http.Cookie{Name: "_oidc_state", Value: "", Path: "/auth/" + p.Name, MaxAge: -1, HttpOnly: true})
+	attempt, err := models.TakeLoginAttempt(p.Name, state)
+	if err != nil {
+		error_message(writer, request, models.ErrInvalidLoginAttempt.Error())
+		return
+	}
+	claims, err := p.Exchange(request.Context(), query.Get("code"), oidc.Attempt{State: state, Nonce: attempt.Nonce, Verifier: attempt.Verifier})
+	if err != nil {
+		danger(err, "Cannot finish login with", p.Name)
+		error_message(writer, request, "Cannot log in with "+p.Label)
+		return
+	}
+
+	// linking from the account page, the user must still be the one who started it
+	if attempt.LinkUserId.Valid {
+		user, err := currentUser(writer, request)
+		if err != nil || int64(user.Id) != attempt.LinkUserId.Int64 {
+			error_message(writer, request, models.ErrInvalidLoginAttempt.Error())
+			return
+		}
+		if err := user.LinkIdentity(p.Name, claims.Subject, claims.Email); err != nil {
+			if err != models.ErrIdentityLinked {
+				danger(err, "Cannot link identity")
+				err = models.ErrInvalidLoginAttempt
+			}
+			error_message(writer, request, err.Error())
+			return
+		}
+		info("User", user.Email, "linked", p.Name, "account", claims.Subject)
+		http.Redirect(writer, request, "/account/logins", 302)
+		return
+	}
+
+	if user, err := models.UserByIdentity(p.Name, claims.Subject); err == nil {
+		logIn(writer, request, user, p.Name)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		error_message(writer, request, p.Label+" did not confirm your email address, log in with your password and link it from your account")
+		return
+	}
+	user, err := models.UserByEmail(claims.Email)
+	if err != nil && !OpenSignup[p.Name] {
+		error_message(writer, request, "No account uses the email address of your "+p.Label+" account")
+		return
+	}
+	if err != nil {
+		if user, err = models.CreateExternalUser(claims.Name, claims.Email); err != nil {
+			danger(err, "Cannot create user from", p.Name)
+			error_message(writer, request, "Cannot create account")
+			return
+		}
+		info("Created account", user.Email, "from", p.Name)
+	} else if !user.IsVerified() {
+		// whoever created the account never proved owning the address, it must not be taken over
+		error_message(writer, request, "An account uses this email address but it is not verified, log in with your password and link "+p.Label+" from your account")
+		return
+	}
+	if err := user.LinkIdentity(p.Name, claims.Subject, claims.Email); err != nil {
+		danger(err, "Cannot link identity")
+		error_message(writer, request, "Cannot log in with "+p.Label)
+		return
+	}
+	logIn(writer, request, user, p.Name)
+}
+
+// GET /account/logins
+// Show the provider accounts linked to the user
+func AccountLoginsHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	identities, err := user.Identities()
+	if err != nil {
+		danger(err, "Cannot get identities")
+		error_message(writer, request, "Cannot get linked accounts")
+		return
+	}
+	content := components.AccountLoginsTempl(identities, Providers)
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// POST /account/logins/{id}/unlink
+// Unlink a provider account, the user can still log in with the password
+func UnlinkProviderHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err == nil {
+		err = user.UnlinkIdentity(id)
+	}
+	if err != nil {
+		error_message(writer, request, "Cannot find linked account")
+		return
+	}
+	http.Redirect(writer, request, "/account/logins", 302)
+}
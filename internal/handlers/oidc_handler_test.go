@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc/oidctest"
+)
+
+// a provider named "test" backed by a provider running in the process
+func setupProvider(t *testing.T) *oidctest.Server {
+	t.Helper()
+	server, err := oidctest.NewServer("chitchat", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Providers = []*oidc.Provider{oidc.NewProvider("test", "Test", server.URL, "chitchat", "secret", []string{"email"}, "http://chitchat.example/auth/test/callback")}
+	t.Cleanup(func() {
+		server.Close()
+		Providers, OpenSignup = nil, map[string]bool{}
+	})
+	return server
+}
+
+// starts a login at the provider and returns the callback request the provider sends the
+// browser back with, and the state cookie of the browser
+func startLogin(t *testing.T, server *oidctest.Server) (*http.Request, *http.Cookie) {
+	t.Helper()
+	request := httptest.NewRequest("GET", "/auth/test/login", nil)
+	request.SetPathValue("provider", "test")
+	response := httptest.NewRecorder()
+	ProviderLoginHandler(response, request)
+	cookie := responseCookie(response, "_oidc_state")
+	if response.Code != http.StatusFound || cookie == nil {
+		t.Fatalf("login answered %d with the cookie %v", response.Code, cookie)
+	}
+	callback, err := server.Authorize(response.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request = httptest.NewRequest("GET", callback.RequestURI(), nil)
+	request.SetPathValue("provider", "test")
+	return request, cookie
+}
+
+func TestProviderCallbackChecksTheState(t *testing.T) {
+	setupDB(t)
+	server := setupProvider(t)
+	createUser(t, "alice", true)
+	server.SetClaims(map[string]interface{}{"email": "alice@example.com", "email_verified": true})
+
+	tests := []struct {
+		name   string
+		cookie func(own *http.Cookie) *http.Cookie
+	}{
+		{"no state cookie", func(own *http.Cookie) *http.Cookie { return nil }},
+		{"state cookie of another login", func(own *http.Cookie) *http.Cookie {
+			_, other := startLogin(t, server)
+			return other
+		}},
+		{"empty state cookie", func(own *http.Cookie) *http.Cookie { return &http.Cookie{Name: "_oidc_state", Value: ""} }},
+	}
+	for _, test := range tests {
+		request, own := startLogin(t, server)
+		if cookie := test.cookie(own); cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		ProviderCallbackHandler(response, request)
+		if !isErrorPage(response) || responseCookie(response, "_cookie") != nil {
+			t.Errorf("%s: logged in, answered %d to %s", test.name, response.Code, response.Header().Get("Location"))
+		}
+	}
+
+	// the state of an attempt works once
+	request, cookie := startLogin(t, server)
+	request.AddCookie(cookie)
+	response := httptest.NewRecorder()
+	ProviderCallbackHandler(response, request)
+	if responseCookie(response, "_cookie") == nil {
+		t.Fatalf("the login failed: %s", response.Header().Get("Location"))
+	}
+	replay := httptest.NewRequest("GET", request.RequestURI, nil)
+	replay.SetPathValue("provider", "test")
+	replay.AddCookie(cookie)
+	response = httptest.NewRecorder()
+	ProviderCallbackHandler(response, replay)
+	if !isErrorPage(response) {
+		t.Errorf("the callback was replayed: %s", response.Header().Get("Location"))
+	}
+}
+
+func TestProviderCallbackLinksVerifiedEmailsOnly(t *testing.T) {
+	setupDB(t)
+	server := setupProvider(t)
+	verified := createUser(t, "verified", true)
+	createUser(t, "unverified", false)
+
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		openSignup bool
+		// the user logged in, 0 when the login is refused
+		want int
+	}{
+		{"email not verified by the provider", map[string]interface{}{"sub": "s1", "email": "verified@example.com", "email_verified": false}, false, 0},
+		{"email_verified missing", map[string]interface{}{"sub": "s2", "email": "verified@example.com"}, false, 0},
+		{"email verified as a string", map[string]interface{}{"sub": "s3", "email": "verified@example.com", "email_verified": "true"}, false, 0},
+		{"account not verified on the site", map[string]interface{}{"sub": "s4", "email": "unverified@example.com", "email_verified": true}, true, 0},
+		{"no account, closed signup", map[string]interface{}{"sub": "s5", "email": "new@example.com", "email_verified": true}, false, 0},
+		{"verified on both sides", map[string]interface{}{"sub": "s6", "email": "verified@example.com", "email_verified": true}, false, verified.Id},
+		{"linked account, email no longer verified", map[string]interface{}{"sub": "s6", "email": "changed@example.com", "email_verified": false}, false, verified.Id},
+	}
+	for _, test := range tests {
+		OpenSignup["test"] = test.openSignup
+		server.SetClaims(test.claims)
+		request, cookie := startLogin(t, server)
+		request.AddCookie(cookie)
+		response := httptest.NewRecorder()
+		ProviderCallbackHandler(response, request)
+
+		linked, err := models.UserByIdentity("test", test.claims["sub"].(string))
+		session := responseCookie(response, "_cookie")
+		if test.want == 0 {
+			if err == nil || session != nil {
+				t.Errorf("%s: linked to user %d, session %v", test.name, linked.Id, session)
+			}
+			continue
+		}
+		if err != nil || linked.Id != test.want || session == nil {
+			t.Errorf("%s: linked to user %d, %v, session %v, want user %d", test.name, linked.Id, err, session, test.want)
+			continue
+		}
+		sess := models.Session{Uuid: session.Value}
+		if ok, _ := sess.Check(); !ok || sess.UserId != test.want {
+			t.Errorf("%s: session of user %d, want %d", test.name, sess.UserId, test.want)
+		}
+	}
+
+	// an open signup creates a verified account for a new verified email
+	OpenSignup["test"] = true
+	server.SetClaims(map[string]interface{}{"sub": "s7", "email": "new@example.com", "email_verified": true, "name": "New"})
+	request, cookie := startLogin(t, server)
+	request.AddCookie(cookie)
+	ProviderCallbackHandler(httptest.NewRecorder(), request)
+	created, err := models.UserByIdentity("test", "s7")
+	if err != nil || created.Email != "new@example.com" || !created.IsVerified() {
+		t.Errorf("open signup created %+v, %v", created, err)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /password/forgot
+// Show the form asking for the email of the account
+func ForgotPasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	sent := request.URL.Query().Get("sent") != ""
+	components.PageTempl(navbar(writer, request), components.ForgotPasswordTempl(sent)).Render(request.Context(), writer)
+}
+
+// POST /password/forgot
+// Email a reset link if an account has the address, the answer is the same either way
+// so the form cannot tell which addresses have an account
+func SendPasswordResetHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	email := request.PostFormValue("email")
+	if user, err := models.UserByEmail(email); err == nil {
+		if token, err := user.CreatePasswordReset(); err != nil {
+			warning(err, "Cannot create password reset for", email)
+		} else {
+			link := BaseURL + "/password/reset/" + token
+			text := "Someone asked to reset the password of your ChitChat account.\n\n" +
+				"Open this link within the hour to choose a new one:\n" + link + "\n\n" +
+				"If it was not you, ignore this email, your password stays the same.\n"
+			if err := sendMail(request.Context(), user.Email, "Reset your password", components.PasswordResetEmailTempl(link), text); err != nil {
+				danger(err, "Cannot queue password reset mail")
+			}
+		}
+	}
+	http.Redirect(writer, request, "/password/forgot?sent=1", 302)
+}
+
+// GET /password/reset/{token}
+// Show the form choosing a new password
+func ResetPasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	token := request.PathValue("token")
+	if _, err := models.UserByResetToken(token); err != nil {
+		error_message(writer, request, err.Error())
+		return
+	}
+	components.PageTempl(navbar(writer, request), components.ResetPasswordTempl(token)).Render(request.Context(), writer)
+}
+
+// POST /password/reset/{token}
+// Set the new password and log the user out everywhere
+func UpdatePasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	password := request.PostFormValue("password")
+	if password == "" || password != request.PostFormValue("confirm") {
+		error_message(writer, request, "The passwords do not match")
+		return
+	}
+	user, err := models.ResetPassword(request.PathValue("token"), password)
+	if err != nil {
+		if err != models.ErrInvalidResetToken {
+			danger(err, "Cannot reset password")
+		}
+		error_message(writer, request, models.ErrInvalidResetToken.Error())
+		return
+	}
+	info("Password reset for", user.Email)
+	audit(request, models.AuditPasswordReset, models.User{}, user.Id, "", "with a mailed token")
+	if err := models.ClearLoginFailures(user.Email); err != nil {
+		danger(err, "Cannot clear login failures")
+	}
+	http.SetCookie(writer, &http.Cookie{Name: "_cookie", Value: "", MaxAge: -1, HttpOnly: true})
+	http.Redirect(writer, request, "/login", 302)
+}
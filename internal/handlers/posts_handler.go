@@ -4,33 +4,208 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/markdown"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
 )
 
 // POST /thread/post : Create the post based on form data {body, uuid, }
 func CreatePostHandler(writer http.ResponseWriter, request *http.Request) {
-	sess, err := session(writer, request)
+	user, err := currentUser(writer, request)
 	if err != nil {
 		http.Redirect(writer, request, "/login", 302)
 	} else {
-		err = request.ParseForm()
-		if err != nil {
+		request.Body = http.MaxBytesReader(writer, request.Body, MaxUploadSize*int64(MaxAttachments)+1<<20)
+		err = request.ParseMultipartForm(MaxUploadSize)
+		if err != nil && err != http.ErrNotMultipart {
 			danger(err, "Cannot parse form")
-		}
-		user, err := sess.User()
-		if err != nil {
-			danger(err, "Cannot get user from session")
+			error_message(writer, request, "The attachments are too large")
+			return
 		}
 		body := request.PostFormValue("body")
 		uuid := request.PostFormValue("uuid")
 		thread, err := models.ThreadByUUID(uuid)
 		if err != nil {
 			error_message(writer, request, "Cannot read thread")
+			return
+		}
+		// the same rule as the reply form
+		if !thread.AcceptsReplies() {
+			error_message(writer, request, "This thread is closed to new replies")
+			return
+		}
+		if !user.IsVerified() {
+			error_message(writer, request, "Please confirm your email address before posting")
+			return
+		}
+		if cat, err := thread.Category(); err != nil || !user.CanPost(cat) {
+			error_message(writer, request, "You are not allowed to reply in this board")
+			return
+		}
+		// the files are only decoded for the users who may post them
+		uploads, err := readUploads(request)
+		if err != nil {
+			error_message(writer, request, err.Error())
+			return
 		}
-		if _, err := user.CreatePost(thread, body); err != nil {
+		post, err := user.CreatePost(thread, body, checkContent(request, user, body))
+		if err != nil {
 			danger(err, "Cannot create post")
+		} else if err := storeUploads(user, post, uploads); err != nil {
+			danger(err, "Cannot store attachments")
+			error_message(writer, request, "Cannot store attachments")
+			return
+		} else if !post.IsHeld() {
+			// the watchers of held posts hear about them once a moderator approves them
+			if err := models.NotifyPost(thread, post); err != nil {
+				danger(err, "Cannot send notifications")
+			}
 		}
 		url := fmt.Sprintf("/thread/%s", uuid)
 		http.Redirect(writer, request, url, 302)
 	}
 }
+
+// GET /post/{id}/edit
+// Show the form to edit the post
+func EditPostHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	if !user.CanModifyPost(post) || post.IsDeleted() {
+		error_message(writer, request, "You are not allowed to edit this post")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.EditPostTempl(post)).Render(request.Context(), writer)
+}
+
+// POST /post/{id}/edit
+// Save the new post body as a revision, the spam checks may hold it for a moderator
+func UpdatePostHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	if !user.CanModifyPost(post) || post.IsDeleted() {
+		error_message(writer, request, "You are not allowed to edit this post")
+		return
+	}
+	thread, err := post.Thread()
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	body := request.PostFormValue("body")
+	if body != post.Body {
+		hold := checkContent(request, user, body)
+		if err := post.Edit(user, body, hold); err != nil {
+			danger(err, "Cannot edit post")
+			error_message(writer, request, "Cannot edit post")
+			return
+		}
+		// the users mentioned in a held edit hear about it once a moderator approves it
+		if !hold.Held {
+			if err := models.NotifyEdit(thread, post); err != nil {
+				danger(err, "Cannot send notifications")
+			}
+		}
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// POST /post/{id}/delete
+// Soft delete the post, leaving a tombstone
+func DeletePostHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	if !user.CanModifyPost(post) {
+		error_message(writer, request, "You are not allowed to delete this post")
+		return
+	}
+	thread, err := post.Thread()
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if err := post.Delete(); err != nil {
+		danger(err, "Cannot delete post")
+		error_message(writer, request, "Cannot delete post")
+		return
+	}
+	info("Post", post.Uuid, "deleted by", user.Email)
+	if post.UserId != user.Id {
+		audit(request, models.AuditContentDeleted, user, post.UserId, "post:"+post.Uuid, "")
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// GET /post/{id}/revisions?from=&to=
+// Show the revision history of the post
+func PostRevisionsHandler(writer http.ResponseWriter, request *http.Request) {
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	user, _ := currentUser(writer, request)
+	if (post.IsDeleted() || post.IsHidden()) && !user.Can(models.PermModerateContent) {
+		error_message(writer, request, "This post was deleted or hidden")
+		return
+	}
+	thread, err := post.Thread()
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !canReadThread(writer, request, thread) {
+		error_message(writer, request, "You are not allowed to read this thread")
+		return
+	}
+	revs, err := post.Revisions()
+	if err != nil || len(revs) == 0 {
+		error_message(writer, request, "Cannot read revisions")
+		return
+	}
+	from, to := revisionRange(request, len(revs))
+	chunks := models.Diff(revs[from-1].Body, revs[to-1].Body)
+	back := fmt.Sprintf("/thread/%s", thread.Uuid)
+	components.PageTempl(navbar(writer, request), components.RevisionsTempl(thread.DisplayTopic(), back, revs, from, to, chunks)).Render(request.Context(), writer)
+}
+
+// POST /post/preview
+// Render the markdown being written, returns an HTMX fragment
+func PreviewPostHandler(writer http.ResponseWriter, request *http.Request) {
+	_, err := session(writer, request)
+	if err != nil {
+		http.Error(writer, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	html, err := markdown.RenderWithMentions(request.PostFormValue("body"), models.ResolveHandle)
+	if err != nil {
+		danger(err, "Cannot render preview")
+		http.Error(writer, "Cannot render preview", http.StatusInternalServerError)
+		return
+	}
+	components.PreviewTempl(html).Render(request.Context(), writer)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// replies are only taken where the thread shows the reply form
+func TestCreatePostNeedsAnOpenThread(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice", true)
+	session := newSession(t, user)
+	board := models.Category{Slug: "general", Name: "General"}
+	if err := board.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// the columns set on the thread
+		set     string
+		replied bool
+	}{
+		{"open", "", true},
+		{"locked", "locked_at = current_timestamp", false},
+		{"archived", "archived_at = current_timestamp", false},
+		{"deleted", "deleted_at = current_timestamp", false},
+		{"hidden", "hidden_at = current_timestamp, hidden_reason = 'moderator'", false},
+		{"held", "hidden_at = current_timestamp, held_at = current_timestamp, hidden_reason = 'held'", false},
+	}
+	for _, test := range tests {
+		thread, err := user.CreateThread(board, test.name, models.Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.set != "" {
+			if _, err := models.Db.Exec("update threads set "+test.set+" where id = $1", thread.Id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		response := httptest.NewRecorder()
+		CreatePostHandler(response, formRequest(session, url.Values{"body": {"a reply"}, "uuid": {thread.Uuid}}))
+		var posts int
+		models.Db.QueryRow("SELECT count(*) FROM posts WHERE thread_id = $1", thread.Id).Scan(&posts)
+		if replied := posts == 1; replied != test.replied || isErrorPage(response) == test.replied {
+			t.Errorf("%s: %d posts, answered %s, want replied %v", test.name, posts, response.Header().Get("Location"), test.replied)
+		}
+	}
+}
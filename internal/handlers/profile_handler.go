@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/storage"
+)
+
+// threads and posts listed on a profile
+const profileActivity = 10
+
+// GET /u/{handle}
+// Show the profile of a user, the counts and the activity only cover the boards the visitor may read
+func ProfileHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := models.UserByHandle(request.PathValue("handle"))
+	if err != nil || user.IsDeleted() {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	visitor, _ := currentUser(writer, request)
+	ids, err := models.ReadableCategoryIds(visitor)
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
+	}
+	threads, err := user.RecentThreads(ids, profileActivity)
+	if err != nil {
+		danger(err, "Cannot get threads of", user.Handle)
+	}
+	posts, err := user.RecentPosts(ids, profileActivity)
+	if err != nil {
+		danger(err, "Cannot get posts of", user.Handle)
+	}
+	content := components.ProfileTempl(user, user.ThreadCount(ids), user.PostCount(ids), threads, posts)
+	components.PageTempl(navbar(writer, request), content).Render(request.Context(), writer)
+}
+
+// GET /u/{handle}/avatar
+// Serve the avatar image of a user
+func AvatarHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := models.UserByHandle(request.PathValue("handle"))
+	if err != nil || !user.HasAvatar() {
+		http.NotFound(writer, request)
+		return
+	}
+	file, err := Storage.Get(user.AvatarKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(writer, request)
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot read avatar of", user.Handle)
+		http.Error(writer, "Cannot read avatar", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	contentType := "image/png"
+	if strings.HasSuffix(user.AvatarKey, ".jpg") {
+		contentType = "image/jpeg"
+	}
+	header := writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// the URL carries the key of the image, a new avatar gets a new URL
+	header.Set("Cache-Control", "public, max-age=86400")
+	io.Copy(writer, file)
+}
+
+// GET /users/{id}
+// Redirect to the profile of the user with this UUID, mentions link here so they survive renames
+func UserLinkHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := models.UserByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find user")
+		return
+	}
+	http.Redirect(writer, request, "/u/"+user.Handle, 302)
+}
+
+// a mention being typed at the end of the body
+var trailingMention = regexp.MustCompile(`(?:^|[^\w@])@(\w{1,32})$`)
+
+// GET /mentions/suggest?body=
+// List the users matching the mention typed at the end of the body, an HTMX fragment
+func SuggestMentionsHandler(writer http.ResponseWriter, request *http.Request) {
+	if _, err := session(writer, request); err != nil {
+		http.Error(writer, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	var users []models.User
+	if match := trailingMention.FindStringSubmatch(request.URL.Query().Get("body")); match != nil {
+		var err error
+		if users, err = models.UsersWithHandlePrefix(match[1], 8); err != nil {
+			danger(err, "Cannot get users")
+		}
+	}
+	components.MentionSuggestionsTempl(users).Render(request.Context(), writer)
+}
+
+// POST /mentions/complete
+// Replace the mention typed at the end of the body with the chosen handle, returns the textarea
+func CompleteMentionHandler(writer http.ResponseWriter, request *http.Request) {
+	if _, err := session(writer, request); err != nil {
+		http.Error(writer, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	body := request.PostFormValue("body")
+	handle, err := models.NormalizeHandle(request.PostFormValue("handle"))
+	if loc := trailingMention.FindStringSubmatchIndex(body); loc != nil && err == nil {
+		// loc[2] is where the typed handle starts, right after the @
+		body = body[:loc[2]] + handle + " "
+	}
+	components.MentionCompletedTempl(body).Render(request.Context(), writer)
+}
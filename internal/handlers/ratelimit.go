@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
+)
+
+// where the rate limit buckets are kept, set up by main from the configuration
+var Limits ratelimit.Store = ratelimit.NewMemory()
+
+// requests allowed per address on each route, and per account for the logins
+var (
+	LoginRate        = ratelimit.Rate{Burst: 10, Every: time.Minute}
+	AccountLoginRate = ratelimit.Rate{Burst: 10, Every: 2 * time.Minute}
+	SignupRate       = ratelimit.Rate{Burst: 3, Every: 20 * time.Minute}
+	ForgotRate       = ratelimit.Rate{Burst: 5, Every: 3 * time.Minute}
+	ResetRate        = ratelimit.Rate{Burst: 10, Every: time.Minute}
+	TwoFactorRate    = ratelimit.Rate{Burst: 5, Every: 2 * time.Minute}
+)
+
+// Takes a token from the bucket of the key, answering 429 when it is empty. A store that
+// fails lets the request through, the limits must not take the site down.
+func limited(writer http.ResponseWriter, request *http.Request, key string, rate ratelimit.Rate) bool {
+	ok, retryAfter, err := Limits.Take(key, rate)
+	if err != nil {
+		danger(err, "Cannot check rate limit", key)
+		return false
+	}
+	if !ok {
+		warning("Rate limited", key)
+		tooManyRequests(writer, request, "Too many attempts", retryAfter)
+	}
+	return !ok
+}
+
+// Answers 429 with the time the client must wait
+func tooManyRequests(writer http.ResponseWriter, request *http.Request, msg string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writer.WriteHeader(http.StatusTooManyRequests)
+	msg = fmt.Sprintf("%s, please try again in %s", msg, waitText(seconds))
+	components.PageTempl(navbar(writer, request), components.ErrorTempl(msg)).Render(request.Context(), writer)
+}
+
+func waitText(seconds int) string {
+	switch {
+	case seconds <= 1:
+		return "a second"
+	case seconds < 120:
+		return strconv.Itoa(seconds) + " seconds"
+	}
+	return strconv.Itoa((seconds+59)/60) + " minutes"
+}
+
+// Gets the address of the visitor, without the port
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
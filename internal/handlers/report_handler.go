@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
+)
+
+// reports allowed per user, a few bad posts are reported in a row but not hundreds
+var ReportRate = ratelimit.Rate{Burst: 10, Every: 5 * time.Minute}
+
+// most reported threads and posts, and resolutions, listed in the queue
+const reportQueueLimit = 50
+
+// Shows the report form, HTMX only gets the form
+func reportForm(writer http.ResponseWriter, request *http.Request, user models.User, what string, path string) {
+	if request.Header.Get("HX-Request") == "true" {
+		components.ReportFormTempl(path, "").Render(request.Context(), writer)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.ReportPageTempl(what, path)).Render(request.Context(), writer)
+}
+
+// Shows a problem with the report, HTMX gets the form back with it
+func reportProblem(writer http.ResponseWriter, request *http.Request, path string, problem string) {
+	if request.Header.Get("HX-Request") == "true" {
+		components.ReportFormTempl(path, problem).Render(request.Context(), writer)
+		return
+	}
+	error_message(writer, request, problem)
+}
+
+// Shows the outcome of a report, HTMX swaps the form and a plain form goes back to the content
+func reportDone(writer http.ResponseWriter, request *http.Request, path string, back string, err error) {
+	message := "Thanks, the moderators will look at it."
+	switch {
+	case err == models.ErrAlreadyReported:
+		message = "You already reported this, the moderators will look at it."
+	case err == models.ErrDetailTooLong:
+		reportProblem(writer, request, path, err.Error())
+		return
+	case err != nil:
+		danger(err, "Cannot save report")
+		error_message(writer, request, "Cannot send the report")
+		return
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		components.ReportSentTempl(message).Render(request.Context(), writer)
+		return
+	}
+	http.Redirect(writer, request, back, 302)
+}
+
+// GET /thread/{id}/report
+// Show the form to report a thread
+func ReportThreadFormHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil || !canReadThread(writer, request, thread) {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	reportForm(writer, request, user, "the thread "+thread.DisplayTopic(), "/thread/"+thread.Uuid+"/report")
+}
+
+// POST /thread/{id}/report
+// Report a thread to the moderators, enough reports hide it until they decide
+func ReportThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil || !canReadThread(writer, request, thread) {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if thread.UserId == user.Id || thread.IsDeleted() {
+		error_message(writer, request, "You cannot report this thread")
+		return
+	}
+	if limited(writer, request, ratelimit.Key("report", "user", user.Uuid), ReportRate) {
+		return
+	}
+	path, back := "/thread/"+thread.Uuid+"/report", "/thread/"+thread.Uuid
+	reason, err := models.ParseReportReason(request.PostFormValue("reason"))
+	if err != nil {
+		reportProblem(writer, request, path, "Please choose a reason")
+		return
+	}
+	hidden, err := user.ReportThread(thread, reason, request.PostFormValue("detail"))
+	if err == nil {
+		info("Thread", thread.Uuid, "reported by", user.Email, "for", reason)
+	}
+	if hidden {
+		warning("Thread", thread.Uuid, "hidden after", models.ReportHideThreshold, "reports")
+	}
+	reportDone(writer, request, path, back, err)
+}
+
+// GET /post/{id}/report
+// Show the form to report a post
+func ReportPostFormHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	thread, err := post.Thread()
+	if err != nil || !canReadThread(writer, request, thread) {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	reportForm(writer, request, user, "a post in "+thread.DisplayTopic(), "/post/"+post.Uuid+"/report")
+}
+
+// POST /post/{id}/report
+// Report a post to the moderators, enough reports hide it until they decide
+func ReportPostHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	post, err := models.PostByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read post")
+		return
+	}
+	thread, err := post.Thread()
+	if err != nil || !canReadThread(writer, request, thread) {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if post.UserId == user.Id || post.IsDeleted() {
+		error_message(writer, request, "You cannot report this post")
+		return
+	}
+	if limited(writer, request, ratelimit.Key("report", "user", user.Uuid), ReportRate) {
+		return
+	}
+	path, back := "/post/"+post.Uuid+"/report", post.Link()
+	reason, err := models.ParseReportReason(request.PostFormValue("reason"))
+	if err != nil {
+		reportProblem(writer, request, path, "Please choose a reason")
+		return
+	}
+	hidden, err := user.ReportPost(post, reason, request.PostFormValue("detail"))
+	if err == nil {
+		info("Post", post.Uuid, "reported by", user.Email, "for", reason)
+	}
+	if hidden {
+		warning("Post", post.Uuid, "hidden after", models.ReportHideThreshold, "reports")
+	}
+	reportDone(writer, request, path, back, err)
+}
+
+// GET /mod/reports
+// Show the reported threads and posts, the most reported first, and the latest resolutions
+func ReportQueueHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	items, err := models.ReportQueue(reportQueueLimit)
+	if err != nil {
+		danger(err, "Cannot get reports")
+		error_message(writer, request, "Cannot get reports")
+		return
+	}
+	resolved, err := models.ResolvedReports(reportQueueLimit)
+	if err != nil {
+		danger(err, "Cannot get resolved reports")
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.ReportQueueTempl(items, resolved)).Render(request.Context(), writer)
+}
+
+// POST /mod/reports/{kind}/{id}/resolve
+// Dismiss the reports, hide or delete the content, or warn its author
+func ResolveReportsHandler(writer http.ResponseWriter, request *http.Request) {
+	moderator, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	resolution, err := models.ParseResolution(request.PostFormValue("action"))
+	if err != nil {
+		error_message(writer, request, "Unknown action")
+		return
+	}
+	kind := models.ReportTarget(request.PathValue("kind"))
+	if kind != models.TargetThread && kind != models.TargetPost {
+		error_message(writer, request, "Cannot find the reported content")
+		return
+	}
+	item, err := models.ReportedItemByUUID(kind, request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot find the reported content")
+		return
+	}
+	note := request.PostFormValue("note")
+	err = item.Resolve(resolution, moderator, note)
+	if err == models.ErrDetailTooLong {
+		error_message(writer, request, err.Error())
+		return
+	}
+	if err != nil && err != models.ErrNoOpenReports {
+		danger(err, "Cannot resolve reports")
+		error_message(writer, request, "Cannot resolve the reports")
+		return
+	}
+	info("Reports on", kind, item.Uuid(), resolution, "by", moderator.Email)
+	if err == nil {
+		audit(request, models.AuditReportsResolved, moderator, item.Author().Id, string(kind)+":"+item.Uuid(), string(resolution))
+	}
+	if resolution == models.ResolveWarn && err == nil {
+		warnAuthor(request, item, note)
+	}
+	if resolution != models.ResolveWarn && err == nil && reportedAsSpam(item) {
+		learn(item.Text(), resolution != models.ResolveDismiss)
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		components.ReportSentTempl("Reports on the "+string(kind)+" "+string(resolution)+".").Render(request.Context(), writer)
+		return
+	}
+	http.Redirect(writer, request, "/mod/reports", 302)
+}
+
+// Checks if any of the reports of the item calls it spam, the classifier learns from those
+func reportedAsSpam(item models.ReportedItem) bool {
+	for _, report := range item.Reports {
+		if report.Reason == models.ReasonSpam {
+			return true
+		}
+	}
+	return false
+}
+
+// Mails the warning of a moderator to the author of the reported content
+func warnAuthor(request *http.Request, item models.ReportedItem, note string) {
+	author := item.Author()
+	if author.IsDeleted() {
+		return
+	}
+	link := BaseURL + "/thread/" + item.Thread.Uuid
+	if item.Kind == models.TargetPost {
+		link = BaseURL + item.Post.Link()
+	}
+	topic := item.Thread.Topic
+	text := "A moderator reviewed reports about what you wrote in \"" + topic + "\" and is warning you about it.\n\n"
+	if note != "" {
+		text += note + "\n\n"
+	}
+	text += link + "\n\nPlease keep to the rules of the board, further reports may get your account suspended.\n"
+	content := components.WarningEmailTempl(topic, link, note)
+	if err := sendMail(request.Context(), author.Email, "A warning from the moderators", content, text); err != nil {
+		danger(err, "Cannot queue warning to", author.Email)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /account/sessions
+// Show the devices the user is logged in on
+func AccountSessionsHandler(writer http.ResponseWriter, request *http.Request) {
+	sess, err := session(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := sess.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	sessions, err := user.Sessions()
+	if err != nil {
+		danger(err, "Cannot get sessions")
+		error_message(writer, request, "Cannot get sessions")
+		return
+	}
+	content := components.AccountSessionsTempl(sessions, sess.Id)
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// POST /account/sessions/{id}/revoke
+// Log out one device, revoking the current session logs the user out here
+func RevokeSessionHandler(writer http.ResponseWriter, request *http.Request) {
+	sess, err := session(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := sess.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	id, err := strconv.Atoi(request.PathValue("id"))
+	ok := false
+	if err == nil {
+		ok, err = user.DeleteSession(id)
+	}
+	if err != nil {
+		danger(err, "Cannot delete session")
+	}
+	if !ok {
+		error_message(writer, request, "Cannot find session")
+		return
+	}
+	info("User", user.Email, "revoked session", id)
+	audit(request, models.AuditSessionRevoked, user, user.Id, "session:"+strconv.Itoa(id), "")
+	if id == sess.Id {
+		http.Redirect(writer, request, "/", 302)
+		return
+	}
+	http.Redirect(writer, request, "/account/sessions", 302)
+}
+
+// POST /account/sessions/revoke-others
+// Log out every device but this one
+func RevokeOtherSessionsHandler(writer http.ResponseWriter, request *http.Request) {
+	sess, err := session(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := sess.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	count, err := user.DeleteOtherSessions(sess.Uuid)
+	if err != nil {
+		danger(err, "Cannot delete sessions")
+		error_message(writer, request, "Cannot log out the other sessions")
+		return
+	}
+	info("User", user.Email, "logged out", count, "other sessions")
+	audit(request, models.AuditSessionsRevoked, user, user.Id, "", strconv.FormatInt(count, 10)+" other sessions")
+	http.Redirect(writer, request, "/account/sessions", 302)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// a user only logs out their own devices
+func TestRevokeSession(t *testing.T) {
+	setupDB(t)
+	alice, bob := createUser(t, "alice", true), createUser(t, "bob", true)
+	current, phone, bobs := newSession(t, alice), newSession(t, alice), newSession(t, bob)
+
+	tests := []struct {
+		name    string
+		id      string
+		revoked bool
+	}{
+		{"session of another user", strconv.Itoa(bobs.Id), false},
+		{"not a session", "phone", false},
+		{"own session", strconv.Itoa(phone.Id), true},
+	}
+	for _, test := range tests {
+		request := formRequest(current, nil)
+		request.SetPathValue("id", test.id)
+		response := httptest.NewRecorder()
+		RevokeSessionHandler(response, request)
+		if isErrorPage(response) == test.revoked {
+			t.Errorf("%s: answered %s", test.name, response.Header().Get("Location"))
+		}
+	}
+	if valid, _ := bobs.Check(); !valid {
+		t.Error("the session of another user was logged out")
+	}
+	if valid, _ := phone.Check(); valid {
+		t.Error("the revoked session still works")
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/media"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// avatar limits: the upload size, and the box the image is scaled down to
+var (
+	MaxAvatarSize int64 = 2 << 20
+	AvatarSize          = 160
+)
+
+// GET /account/profile
+// Show the profile settings
+func AccountProfileHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AccountProfileTempl(user)).Render(request.Context(), writer)
+}
+
+// POST /account/profile
+// Save the name, username, bio and timezone, HTMX gets the form back with the result
+func UpdateProfileHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	user.Name = request.PostFormValue("name")
+	user.Bio = request.PostFormValue("bio")
+	user.Timezone = request.PostFormValue("timezone")
+	// check the username first so a refused one saves nothing
+	handle, err := user.CheckHandle(request.PostFormValue("handle"))
+	if err == nil {
+		err = user.Update()
+	}
+	if err == nil && handle != user.Handle {
+		old := user.Handle
+		if err = user.SetHandle(handle); err == nil {
+			info("User", old, "renamed to", user.Handle)
+		}
+	}
+	if err != nil && !isProfileError(err) {
+		danger(err, "Cannot update profile")
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		if err != nil {
+			components.ProfileFormTempl(user, "", profileError(err)).Render(request.Context(), writer)
+			return
+		}
+		components.ProfileFormTempl(user, "Your profile is saved.", "").Render(request.Context(), writer)
+		return
+	}
+	if err != nil {
+		error_message(writer, request, profileError(err))
+		return
+	}
+	http.Redirect(writer, request, "/account/profile", 302)
+}
+
+// errors of the profile the user can fix, they are shown as they are
+func isProfileError(err error) bool {
+	switch err {
+	case models.ErrInvalidName, models.ErrBioTooLong, models.ErrInvalidTimezone, models.ErrInvalidHandle, models.ErrHandleTaken:
+		return true
+	}
+	return false
+}
+
+func profileError(err error) string {
+	if isProfileError(err) {
+		return err.Error()
+	}
+	return "Cannot save profile"
+}
+
+// POST /account/avatar
+// Replace the avatar with the uploaded image, scaled down and without its metadata
+func UploadAvatarHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, MaxAvatarSize+1<<20)
+	image, contentType, problem := readAvatar(request)
+	if problem == "" {
+		old := user.AvatarKey
+		key := "avatars/" + models.NewAttachmentUUID() + ".png"
+		if contentType == "image/jpeg" {
+			key = strings.TrimSuffix(key, ".png") + ".jpg"
+		}
+		if err = Storage.Put(key, image, contentType); err == nil {
+			err = user.SetAvatar(key)
+		}
+		if err != nil {
+			danger(err, "Cannot store avatar of", user.Handle)
+			problem = "Cannot store the avatar"
+		} else if old != "" {
+			if err := Storage.Delete(old); err != nil {
+				danger(err, "Cannot delete old avatar", old)
+			}
+		}
+	}
+	avatarResponse(writer, request, user, problem)
+}
+
+// Reads the "avatar" form field, problem says what is wrong with it
+func readAvatar(request *http.Request) (image []byte, contentType string, problem string) {
+	if err := request.ParseMultipartForm(MaxAvatarSize); err != nil || request.MultipartForm == nil || len(request.MultipartForm.File["avatar"]) == 0 {
+		return nil, "", "Please choose an image"
+	}
+	header := request.MultipartForm.File["avatar"][0]
+	if header.Size > MaxAvatarSize {
+		return nil, "", "The image is larger than 2 MB"
+	}
+	up, err := readUpload(header)
+	if err != nil || !media.IsImage(up.contentType) {
+		return nil, "", "The avatar must be a PNG, JPEG or GIF image"
+	}
+	image, contentType, err = media.Thumbnail(up.contentType, up.data, AvatarSize)
+	if err != nil {
+		return nil, "", "The avatar is not a valid image"
+	}
+	return
+}
+
+// POST /account/avatar/delete
+// Remove the avatar
+func DeleteAvatarHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	problem := ""
+	if old := user.AvatarKey; old != "" {
+		if err := user.SetAvatar(""); err != nil {
+			danger(err, "Cannot remove avatar of", user.Handle)
+			problem = "Cannot remove the avatar"
+		} else if err := Storage.Delete(old); err != nil {
+			danger(err, "Cannot delete avatar", old)
+		}
+	}
+	avatarResponse(writer, request, user, problem)
+}
+
+func avatarResponse(writer http.ResponseWriter, request *http.Request, user models.User, problem string) {
+	if request.Header.Get("HX-Request") == "true" {
+		components.AvatarFormTempl(user, problem).Render(request.Context(), writer)
+		return
+	}
+	if problem != "" {
+		error_message(writer, request, problem)
+		return
+	}
+	http.Redirect(writer, request, "/account/profile", 302)
+}
+
+// GET /account/password
+// Show the form changing the password
+func AccountPasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.AccountPasswordTempl(user)).Render(request.Context(), writer)
+}
+
+// POST /account/password
+// Change the password, the current one is required and the other sessions are logged out
+func ChangePasswordHandler(writer http.ResponseWriter, request *http.Request) {
+	sess, err := session(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	user, err := sess.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	problem := ""
+	password := request.PostFormValue("password")
+	if password != request.PostFormValue("confirm") {
+		problem = "The new passwords do not match"
+	} else if err := user.ChangePassword(request.PostFormValue("current"), password, sess.Uuid); err != nil {
+		switch err {
+		case models.ErrWrongPassword, models.ErrPasswordEmpty:
+			warning("Password change of", user.Email, "refused:", err)
+			problem = err.Error()
+		default:
+			danger(err, "Cannot change password")
+			problem = "Cannot change the password"
+		}
+	} else {
+		info("User", user.Email, "changed the password")
+		audit(request, models.AuditPasswordChanged, user, user.Id, "", "")
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		if problem != "" {
+			components.PasswordFormTempl("", problem).Render(request.Context(), writer)
+			return
+		}
+		components.PasswordFormTempl("Your password is changed.", "").Render(request.Context(), writer)
+		return
+	}
+	if problem != "" {
+		error_message(writer, request, problem)
+		return
+	}
+	http.Redirect(writer, request, "/account/password", 302)
+}
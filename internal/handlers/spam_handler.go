@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/spam"
+)
+
+// checks new threads and posts go through before they are saved, set by main.
+// The empty pipeline holds nothing.
+var ContentChecks = &spam.Pipeline{}
+
+// the classifier learning from the moderators, set by main, nil when there is none
+var Classifier *spam.Bayes
+
+// held threads and posts listed in the queue
+const heldQueueLimit = 50
+
+// Runs the spam checks on the text of the form, moderators are trusted and not checked.
+// A failing check is logged and the others decide.
+func checkContent(request *http.Request, user models.User, text string) models.Hold {
+	if user.Can(models.PermModerateContent) {
+		return models.Hold{}
+	}
+	verdict, err := ContentChecks.Run(spam.Content{Text: text, Honeypot: request.PostFormValue(spam.HoneypotField)})
+	if err != nil {
+		danger(err, "Cannot run spam checks")
+	}
+	if !verdict.Held {
+		return models.Hold{}
+	}
+	warning("Held content of", user.Email, "scoring", verdict.Score, "for", verdict.Reasons())
+	return models.Hold{Held: true, Score: verdict.Score, Reasons: verdict.Reasons()}
+}
+
+// Teaches the classifier what a moderator decided about the text
+func learn(text string, isSpam bool) {
+	if Classifier == nil {
+		return
+	}
+	if err := Classifier.Learn(text, isSpam); err != nil {
+		danger(err, "Cannot train spam classifier")
+	}
+}
+
+// GET /mod/held
+// Show the threads and posts the spam checks held, the longest waiting first
+func HeldQueueHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	items, err := models.HeldQueue(heldQueueLimit)
+	if err != nil {
+		danger(err, "Cannot get held content")
+		error_message(writer, request, "Cannot get held content")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.HeldQueueTempl(items)).Render(request.Context(), writer)
+}
+
+// POST /mod/held/{kind}/{id}/review
+// Approve held content or delete it as spam, the classifier learns from either
+func ReviewHeldHandler(writer http.ResponseWriter, request *http.Request) {
+	moderator, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	decision, err := models.ParseHoldDecision(request.PostFormValue("action"))
+	if err != nil {
+		error_message(writer, request, "Unknown action")
+		return
+	}
+	kind := models.ReportTarget(request.PathValue("kind"))
+	if kind != models.TargetThread && kind != models.TargetPost {
+		error_message(writer, request, "Cannot find the held content")
+		return
+	}
+	item, err := models.HeldItemByUUID(kind, request.PathValue("id"))
+	if err == nil {
+		err = item.Review(decision, moderator)
+	}
+	if err == models.ErrNotHeld {
+		error_message(writer, request, err.Error())
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot review held content")
+		error_message(writer, request, "Cannot review the held content")
+		return
+	}
+	info("Held", kind, item.Uuid(), decision, "by", moderator.Email)
+	audit(request, models.AuditHoldReviewed, moderator, item.Author().Id, string(kind)+":"+item.Uuid(), string(decision))
+	learn(item.Text(), decision == models.HoldSpam)
+	if decision == models.HoldApproved && kind == models.TargetPost {
+		notify := models.NotifyPost
+		// a held edit of a post shown before only tells the users it newly mentions
+		if item.IsEdit() {
+			notify = models.NotifyEdit
+		}
+		if err := notify(item.Thread, item.Post); err != nil {
+			danger(err, "Cannot send notifications")
+		}
+	}
+	if request.Header.Get("HX-Request") == "true" {
+		components.ReportSentTempl("The "+string(kind)+" is "+string(decision)+".").Render(request.Context(), writer)
+		return
+	}
+	http.Redirect(writer, request, "/mod/held", 302)
+}
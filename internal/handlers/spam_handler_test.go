@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/spam"
+)
+
+// an edit goes through the spam checks like new content does
+func TestEditIsChecked(t *testing.T) {
+	setupDB(t)
+	defer func(checks *spam.Pipeline) { ContentChecks = checks }(ContentChecks)
+	ContentChecks = &spam.Pipeline{Threshold: 0.9, Checks: []spam.Check{spam.Honeypot{}}}
+	user := createUser(t, "alice", true)
+	session := newSession(t, user)
+
+	tests := []struct {
+		name     string
+		honeypot string
+		held     bool
+	}{
+		{"clean edit", "", false},
+		{"edit of a bot", "http://spam.example", true},
+	}
+	for _, test := range tests {
+		thread, err := user.CreateThread(models.Category{Id: 1}, test.name, models.Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		post, err := user.CreatePost(thread, test.name, models.Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits := []struct {
+			kind    string
+			handler http.HandlerFunc
+			uuid    string
+			form    url.Values
+		}{
+			{"thread", UpdateThreadHandler, thread.Uuid, url.Values{"topic": {test.name + ", edited"}}},
+			{"post", UpdatePostHandler, post.Uuid, url.Values{"body": {test.name + ", edited"}}},
+		}
+		for _, edit := range edits {
+			edit.form.Set(spam.HoneypotField, test.honeypot)
+			request := httptest.NewRequest("POST", "/", strings.NewReader(edit.form.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.AddCookie(&http.Cookie{Name: "_cookie", Value: session.Uuid})
+			request.SetPathValue("id", edit.uuid)
+			response := httptest.NewRecorder()
+			edit.handler(response, request)
+			if isErrorPage(response) {
+				t.Fatalf("%s, %s: answered the error page", test.name, edit.kind)
+			}
+		}
+		thread, _ = models.ThreadByUUID(thread.Uuid)
+		post, _ = models.PostByUUID(post.Uuid)
+		if thread.IsHeld() != test.held || post.IsHeld() != test.held {
+			t.Errorf("%s: thread held %v, post held %v, want %v", test.name, thread.IsHeld(), post.IsHeld(), test.held)
+		}
+	}
+}
+
+// the watchers hear of a post held when it was written once it is approved, even after an edit
+func TestReviewHeldAnnouncesNewPosts(t *testing.T) {
+	setupDB(t)
+	board := models.Category{Slug: "general", Name: "General"}
+	if err := board.Create(); err != nil {
+		t.Fatal(err)
+	}
+	author, watcher := createUser(t, "author", true), createUser(t, "watcher", true)
+	moderator := createUser(t, "moderator", true)
+	if err := moderator.SetRole(models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	session := newSession(t, moderator)
+	thread, err := moderator.CreateThread(board, "Thread", models.Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Watch(thread); err != nil {
+		t.Fatal(err)
+	}
+	held := models.Hold{Held: true, Score: 1}
+
+	tests := []struct {
+		name string
+		// how the post was held
+		hold, editHold models.Hold
+		announced      bool
+	}{
+		{"held new post", held, models.Hold{}, true},
+		{"held new post, edited while held", held, held, true},
+		{"held edit of a shown post", models.Hold{}, held, false},
+	}
+	for _, test := range tests {
+		models.Db.Exec("delete from notifications")
+		post, err := author.CreatePost(thread, test.name, test.hold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := post.Edit(author, test.name+", edited", test.editHold); err != nil {
+			t.Fatal(err)
+		}
+		request := formRequest(session, url.Values{"action": {string(models.HoldApproved)}})
+		request.SetPathValue("kind", string(models.TargetPost))
+		request.SetPathValue("id", post.Uuid)
+		response := httptest.NewRecorder()
+		ReviewHeldHandler(response, request)
+		if isErrorPage(response) {
+			t.Fatalf("%s: answered %s", test.name, response.Header().Get("Location"))
+		}
+		if count, _ := watcher.UnreadNotifications(); (count == 1) != test.announced {
+			t.Errorf("%s: %d notifications, want announced %v", test.name, count, test.announced)
+		}
+	}
+}
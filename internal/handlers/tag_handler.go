@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// GET /tag/{names}?page=
+// Show the threads carrying the tags, "go+web" matches both tags and "go,web" either of them
+func TagHandler(writer http.ResponseWriter, request *http.Request) {
+	names, mode := request.PathValue("names"), models.TagsAll
+	sep := "+"
+	if strings.Contains(names, ",") {
+		sep, mode = ",", models.TagsAny
+	}
+	var tags []string
+	for _, name := range strings.Split(names, sep) {
+		tag, err := models.NormalizeTag(name)
+		if err != nil {
+			error_message(writer, request, "Cannot find tag")
+			return
+		}
+		// a tag named twice is matched once, "go+Go" is the go tag
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	user, _ := currentUser(writer, request)
+	ids, err := models.ReadableCategoryIds(user)
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
+	}
+	page := pageNumber(request)
+	threads, more, err := models.Threads(models.ThreadFilter{CategoryIds: ids, Tags: tags, TagMode: mode, Page: page})
+	if err != nil {
+		error_message(writer, request, "Cannot get threads")
+		return
+	}
+	content := components.TagTempl(tags, mode, threads, readMarks(writer, request, threads), pager(request, page, more))
+	components.PageTempl(navbar(writer, request), content).Render(request.Context(), writer)
+}
+
+// GET /tags/suggest?tags=
+// Complete the last tag typed in the tag field
+func SuggestTagsHandler(writer http.ResponseWriter, request *http.Request) {
+	// the tags already typed are kept in front of every suggestion
+	typed, last := "", request.URL.Query().Get("tags")
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		typed, last = last[:i+1]+" ", last[i+1:]
+	}
+	var names []string
+	if prefix := strings.TrimSpace(strings.ToLower(last)); prefix != "" {
+		var err error
+		if names, err = models.TagsWithPrefix(prefix, 10); err != nil {
+			danger(err, "Cannot get tags")
+		}
+	}
+	components.TagSuggestionsTempl(typed, names).Render(request.Context(), writer)
+}
+
+// GET /mod/tags
+// Show every tag with the forms to rename and merge them
+func ModerateTagsHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	tags, err := models.Tags()
+	if err != nil {
+		error_message(writer, request, "Cannot get tags")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.ModerateTagsTempl(tags)).Render(request.Context(), writer)
+}
+
+// POST /mod/tags/{name}/rename
+// Rename a tag on every thread carrying it
+func RenameTagHandler(writer http.ResponseWriter, request *http.Request) {
+	tag, err := models.TagByName(request.PathValue("name"))
+	if err != nil {
+		error_message(writer, request, "Cannot find tag")
+		return
+	}
+	old := tag.Name
+	if err := tag.Rename(request.PostFormValue("name")); err != nil {
+		danger(err, "Cannot rename tag")
+		error_message(writer, request, "Cannot rename tag, merge it if the new name is already used")
+		return
+	}
+	moderator, _ := currentUser(writer, request)
+	audit(request, models.AuditTagChanged, moderator, 0, "tag:"+old, "renamed to "+tag.Name)
+	http.Redirect(writer, request, "/mod/tags", 302)
+}
+
+// POST /mod/tags/{name}/merge
+// Move the threads of a tag to another tag and remove it
+func MergeTagHandler(writer http.ResponseWriter, request *http.Request) {
+	tag, err := models.TagByName(request.PathValue("name"))
+	if err != nil {
+		error_message(writer, request, "Cannot find tag")
+		return
+	}
+	into, err := models.TagByName(request.PostFormValue("into"))
+	if err != nil {
+		error_message(writer, request, "Cannot find tag to merge into")
+		return
+	}
+	if err := tag.MergeInto(into); err != nil {
+		danger(err, "Cannot merge tags")
+		error_message(writer, request, "Cannot merge tags")
+		return
+	}
+	moderator, _ := currentUser(writer, request)
+	audit(request, models.AuditTagChanged, moderator, 0, "tag:"+tag.Name, "merged into "+into.Name)
+	http.Redirect(writer, request, "/mod/tags", 302)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+func TestTagHandler(t *testing.T) {
+	setupDB(t)
+	board := models.Category{Slug: "general", Name: "General"}
+	if err := board.Create(); err != nil {
+		t.Fatal(err)
+	}
+	author := createUser(t, "author", true)
+	for topic, tags := range map[string][]string{"tagged go": {"go"}, "tagged go and web": {"go", "web"}, "tagged web": {"web"}} {
+		thread, err := author.CreateThread(board, topic, models.Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := thread.SetTags(tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		names string
+		want  []string
+	}{
+		{"go", []string{"tagged go", "tagged go and web"}},
+		{"go+web", []string{"tagged go and web"}},
+		{"go,web", []string{"tagged go", "tagged go and web", "tagged web"}},
+		// a tag named twice is one tag
+		{"go+go", []string{"tagged go", "tagged go and web"}},
+		{"go+Go", []string{"tagged go", "tagged go and web"}},
+		{"Web,web", []string{"tagged go and web", "tagged web"}},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/tag/"+test.names, nil)
+		request.SetPathValue("names", test.names)
+		response := httptest.NewRecorder()
+		TagHandler(response, request)
+		body := response.Body.String()
+		for _, topic := range []string{"tagged go", "tagged go and web", "tagged web"} {
+			// the topics are links, closed by the tag
+			listed := strings.Contains(body, topic+"<")
+			if want := strings.Contains(strings.Join(test.want, "|")+"|", topic+"|"); listed != want {
+				t.Errorf("%s: %q listed %v, want %v", test.names, topic, listed, want)
+			}
+		}
+	}
+}
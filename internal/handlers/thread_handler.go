@@ -4,24 +4,31 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/taewony/go-fullstack-webapp/internal/components"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
 )
 
-// GET /thread/new
+// GET /thread/new?category=
 // Show the new thread form page
 func NewThreadHandler(writer http.ResponseWriter, request *http.Request) {
-	_, err := session(writer, request)
+	user, err := currentUser(writer, request)
 	if err != nil {
 		http.Redirect(writer, request, "/login", 302)
-	} else {
-		generateHTML(writer, nil, "layout", "private.navbar", "new.thread")
+		return
+	}
+	cats, err := models.PostableCategories(user)
+	if err != nil {
+		error_message(writer, request, "Cannot get boards")
+		return
 	}
+	selected := request.URL.Query().Get("category")
+	components.PageTempl(components.PrivateNavbarTempl(user), components.NewThreadFormTempl(cats, selected)).Render(request.Context(), writer)
 }
 
 // POST /thread/create
 // Create a thread
 func CreateThreadHandler(writer http.ResponseWriter, request *http.Request) {
-	sess, err := session(writer, request)
+	user, err := currentUser(writer, request)
 	if err != nil {
 		http.Redirect(writer, request, "/login", 302)
 	} else {
@@ -29,20 +36,38 @@ func CreateThreadHandler(writer http.ResponseWriter, request *http.Request) {
 		if err != nil {
 			danger(err, "Cannot parse form")
 		}
-		user, err := sess.User()
+		cat, err := models.CategoryBySlug(request.PostFormValue("category"))
 		if err != nil {
-			danger(err, "Cannot get user from session")
+			error_message(writer, request, "Please choose a board")
+			return
+		}
+		if !user.IsVerified() {
+			error_message(writer, request, "Please confirm your email address before posting")
+			return
+		}
+		if !user.CanPost(cat) {
+			error_message(writer, request, "You are not allowed to start threads in this board")
+			return
+		}
+		tags, err := models.ParseTags(request.PostFormValue("tags"))
+		if err != nil {
+			error_message(writer, request, err.Error())
+			return
 		}
 		topic := request.PostFormValue("topic")
-		if _, err := user.CreateThread(topic); err != nil {
+		thread, err := user.CreateThread(cat, topic, checkContent(request, user, topic))
+		if err != nil {
 			danger(err, "Cannot create thread")
+		} else if err := thread.SetTags(tags); err != nil {
+			danger(err, "Cannot tag thread")
 		}
-		http.Redirect(writer, request, "/", 302)
+		http.Redirect(writer, request, "/c/"+cat.Slug, 302)
 	}
 }
 
 // GET /thread/{id}
-// Show the details of the thread, including the posts and the form to write a post
+// Show the details of the thread, including the posts and the form to write a post,
+// and mark the thread as read for logged-in users
 func GetAThreadHandler(writer http.ResponseWriter, request *http.Request) {
 	// vals := request.URL.Query()
 	// uuid := vals.Get("id")
@@ -50,42 +75,179 @@ func GetAThreadHandler(writer http.ResponseWriter, request *http.Request) {
 	thread, err := models.ThreadByUUID(uuid)
 	if err != nil {
 		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !canReadThread(writer, request, thread) {
+		error_message(writer, request, "You are not allowed to read this thread")
+		return
+	}
+	posts, err := thread.Posts()
+	if err != nil {
+		error_message(writer, request, "Cannot read posts")
+		return
+	}
+	user, err := currentUser(writer, request)
+	if err != nil {
+		components.PageTempl(components.PublicNavbarTempl(), components.PublicThreadTempl(thread, posts)).Render(request.Context(), writer)
 	} else {
-		_, err := session(writer, request)
+		// find the first unread post before moving the read marker past it
+		firstUnread, err := user.FirstUnreadPost(thread)
 		if err != nil {
-			generateHTML(writer, &thread, "layout", "public.navbar", "public.thread")
-		} else {
-			generateHTML(writer, &thread, "layout", "private.navbar", "private.thread")
+			danger(err, "Cannot get read marker")
+		}
+		lastPostId := 0
+		if len(posts) > 0 {
+			lastPostId = posts[len(posts)-1].Id
 		}
+		if err := user.MarkThreadRead(thread, lastPostId); err != nil {
+			danger(err, "Cannot mark thread as read")
+		}
+		components.PageTempl(components.PrivateNavbarTempl(user), components.PrivateThreadTemp(user, thread, posts, firstUnread)).Render(request.Context(), writer)
 	}
 }
 
-// POST /thread/post
-// Create the post
-func PostThread(writer http.ResponseWriter, request *http.Request) {
-	sess, err := session(writer, request)
+// GET /thread/{id}/edit
+// Show the form to edit the thread topic
+func EditThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
 	if err != nil {
 		http.Redirect(writer, request, "/login", 302)
-	} else {
-		err = request.ParseForm()
-		if err != nil {
-			danger(err, "Cannot parse form")
-		}
-		user, err := sess.User()
-		if err != nil {
-			danger(err, "Cannot get user from session")
-		}
-		body := request.PostFormValue("body")
-		uuid := request.PostFormValue("uuid")
-		thread, err := models.ThreadByUUID(uuid)
-		if err != nil {
-			error_message(writer, request, "Cannot read thread")
-		}
-		if _, err := user.CreatePost(thread, body); err != nil {
-			danger(err, "Cannot create post")
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !user.CanModifyThread(thread) || thread.IsDeleted() {
+		error_message(writer, request, "You are not allowed to edit this thread")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.EditThreadTempl(thread)).Render(request.Context(), writer)
+}
+
+// POST /thread/{id}/edit
+// Save the new thread topic as a revision and replace the tags, the spam checks may hold
+// the topic for a moderator
+func UpdateThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !user.CanModifyThread(thread) || thread.IsDeleted() {
+		error_message(writer, request, "You are not allowed to edit this thread")
+		return
+	}
+	tags, err := models.ParseTags(request.PostFormValue("tags"))
+	if err != nil {
+		error_message(writer, request, err.Error())
+		return
+	}
+	topic := request.PostFormValue("topic")
+	if topic != thread.Topic {
+		if err := thread.Edit(user, topic, checkContent(request, user, topic)); err != nil {
+			danger(err, "Cannot edit thread")
+			error_message(writer, request, "Cannot edit thread")
+			return
 		}
-		url := fmt.Sprintf("/thread/%s", uuid)
-		fmt.Println(url)
-		http.Redirect(writer, request, url, 302)
 	}
+	if err := thread.SetTags(tags); err != nil {
+		danger(err, "Cannot tag thread")
+		error_message(writer, request, "Cannot tag thread")
+		return
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// POST /thread/{id}/delete
+// Soft delete the thread, leaving a tombstone
+func DeleteThreadHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	if !user.CanModifyThread(thread) {
+		error_message(writer, request, "You are not allowed to delete this thread")
+		return
+	}
+	if err := thread.Delete(); err != nil {
+		danger(err, "Cannot delete thread")
+		error_message(writer, request, "Cannot delete thread")
+		return
+	}
+	info("Thread", thread.Uuid, "deleted by", user.Email)
+	if thread.UserId != user.Id {
+		audit(request, models.AuditContentDeleted, user, thread.UserId, "thread:"+thread.Uuid, "")
+	}
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// POST /thread/{id}/state
+// Pin, lock or archive the thread, or undo it
+func ThreadStateHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	state := models.ThreadState(request.PostFormValue("state"))
+	enabled := request.PostFormValue("enabled") == "true"
+	err = thread.SetState(state, enabled, user)
+	if err == models.ErrStateUnchanged {
+		http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+		return
+	}
+	if err != nil {
+		danger(err, "Cannot change thread state")
+		error_message(writer, request, "Cannot change thread state")
+		return
+	}
+	info("Thread", thread.Uuid, state, enabled, "set by", user.Email)
+	audit(request, models.AuditThreadState, user, thread.UserId, "thread:"+thread.Uuid, stateDetail(state, enabled))
+	http.Redirect(writer, request, fmt.Sprintf("/thread/%s", thread.Uuid), 302)
+}
+
+// GET /thread/{id}/revisions?from=&to=
+// Show the revision history of the thread topic
+func ThreadRevisionsHandler(writer http.ResponseWriter, request *http.Request) {
+	thread, err := models.ThreadByUUID(request.PathValue("id"))
+	if err != nil {
+		error_message(writer, request, "Cannot read thread")
+		return
+	}
+	user, _ := currentUser(writer, request)
+	if !canReadThread(writer, request, thread) {
+		error_message(writer, request, "You are not allowed to read this thread")
+		return
+	}
+	if (thread.IsDeleted() || thread.IsHidden()) && !user.Can(models.PermModerateContent) {
+		error_message(writer, request, "This thread was deleted or hidden")
+		return
+	}
+	revs, err := thread.Revisions()
+	if err != nil || len(revs) == 0 {
+		error_message(writer, request, "Cannot read revisions")
+		return
+	}
+	from, to := revisionRange(request, len(revs))
+	chunks := models.Diff(revs[from-1].Body, revs[to-1].Body)
+	back := fmt.Sprintf("/thread/%s", thread.Uuid)
+	components.PageTempl(navbar(writer, request), components.RevisionsTempl(thread.Topic, back, revs, from, to, chunks)).Render(request.Context(), writer)
 }
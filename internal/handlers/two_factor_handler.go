@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/taewony/go-fullstack-webapp/internal/components"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
+)
+
+// GET /login/2fa
+// Show the form asking for the code of the authenticator app
+func TwoFactorLoginHandler(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := partialSession(request); !ok {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	components.PageTempl(components.PublicNavbarTempl(), components.TwoFactorLoginTempl()).Render(request.Context(), writer)
+}
+
+// POST /login/2fa
+// Check the code of the app or a recovery code, and replace the partial session with a full one
+func VerifyTwoFactorLoginHandler(writer http.ResponseWriter, request *http.Request) {
+	partial, ok := partialSession(request)
+	if !ok {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	// a 6 digit code must not be guessable, the session ends when it runs out of tries
+	if ok, _, err := Limits.Take(ratelimit.Key("2fa", "session", partial.Uuid), TwoFactorRate); err == nil && !ok {
+		partial.DeleteByUUID()
+		error_message(writer, request, "Too many attempts, please log in again")
+		return
+	}
+	user, err := partial.User()
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	code, method := request.PostFormValue("code"), "two-factor code"
+	if err = user.VerifyTwoFactor(code); err == models.ErrInvalidTwoFactorCode {
+		// not a code of the app, it may be a recovery code
+		if err = user.UseRecoveryCode(code); err == nil {
+			info("User", user.Email, "logged in with a recovery code,", user.RecoveryCodesLeft(), "left")
+			method = "recovery code"
+		}
+	}
+	if err != nil {
+		if err != models.ErrInvalidTwoFactorCode {
+			danger(err, "Cannot verify code")
+		}
+		audit(request, models.AuditLoginFailed, models.User{}, user.Id, "", "wrong two-factor code")
+		error_message(writer, request, models.ErrInvalidTwoFactorCode.Error())
+		return
+	}
+	partial.DeleteByUUID()
+	startSession(writer, request, user, method)
+}
+
+// Gets the partial session of the cookie, waiting for the second step of the login
+func partialSession(request *http.Request) (sess models.Session, ok bool) {
+	cookie, err := request.Cookie("_cookie")
+	if err != nil {
+		return
+	}
+	sess, err = models.PartialSession(cookie.Value)
+	return sess, err == nil
+}
+
+// GET /account/2fa
+// Show whether 2FA is on, the enrollment in progress or the button starting it
+func TwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	content := components.TwoFactorTempl(user, user.HasTwoFactor(), user.PendingTwoFactorSecret())
+	components.PageTempl(components.PrivateNavbarTempl(user), content).Render(request.Context(), writer)
+}
+
+// POST /account/2fa/setup
+// Create the secret to enroll in the authenticator app
+func SetupTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if _, err := user.BeginTwoFactor(); err != nil {
+		danger(err, "Cannot set up two-factor authentication")
+		error_message(writer, request, "Cannot set up two-factor authentication")
+		return
+	}
+	http.Redirect(writer, request, "/account/2fa", 302)
+}
+
+// GET /account/2fa/qr.png
+// Render the QR code of the enrollment, scanned by the authenticator app
+func TwoFactorQRHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	secret := user.PendingTwoFactorSecret()
+	if secret == "" {
+		http.NotFound(writer, request)
+		return
+	}
+	png, err := qrcode.Encode(user.TwoFactorURI(secret), qrcode.Medium, 256)
+	if err != nil {
+		danger(err, "Cannot render QR code")
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the image holds the secret, it must not be kept by caches
+	writer.Header().Set("Content-Type", "image/png")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Write(png)
+}
+
+// POST /account/2fa/confirm
+// Turn 2FA on with a first code of the app, and show the recovery codes once
+func ConfirmTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	codes, err := user.ConfirmTwoFactor(request.PostFormValue("code"))
+	if err != nil {
+		if err != models.ErrInvalidTwoFactorCode && err != models.ErrNoTwoFactorSetup {
+			danger(err, "Cannot turn on two-factor authentication")
+			err = models.ErrNoTwoFactorSetup
+		}
+		error_message(writer, request, err.Error())
+		return
+	}
+	info("User", user.Email, "turned on two-factor authentication")
+	components.PageTempl(components.PrivateNavbarTempl(user), components.RecoveryCodesTempl(codes)).Render(request.Context(), writer)
+}
+
+// POST /account/2fa/recovery-codes
+// Replace the recovery codes, a code of the app proves the user still has it
+func RegenerateRecoveryCodesHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	if err := user.VerifyTwoFactor(request.PostFormValue("code")); err != nil {
+		error_message(writer, request, models.ErrInvalidTwoFactorCode.Error())
+		return
+	}
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		danger(err, "Cannot create recovery codes")
+		error_message(writer, request, "Cannot create recovery codes")
+		return
+	}
+	components.PageTempl(components.PrivateNavbarTempl(user), components.RecoveryCodesTempl(codes)).Render(request.Context(), writer)
+}
+
+// POST /account/2fa/disable
+// Turn 2FA off, with the password and a code of the app
+func DisableTwoFactorHandler(writer http.ResponseWriter, request *http.Request) {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		http.Redirect(writer, request, "/login", 302)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		danger(err, "Cannot parse form")
+	}
+	if !passwordConfirmed(writer, request, user) {
+		return
+	}
+	if err := user.VerifyTwoFactor(request.PostFormValue("code")); err != nil {
+		error_message(writer, request, models.ErrInvalidTwoFactorCode.Error())
+		return
+	}
+	if err := user.ResetTwoFactor(); err != nil {
+		danger(err, "Cannot turn off two-factor authentication")
+		error_message(writer, request, "Cannot turn off two-factor authentication")
+		return
+	}
+	info("User", user.Email, "turned off two-factor authentication")
+	audit(request, models.AuditTwoFactorReset, user, user.Id, "", "turned off by the user")
+	http.Redirect(writer, request, "/account/2fa", 302)
+}
@@ -1,20 +1,28 @@
 package handlers
 
 import (
+	"html/template"
 	"net/http"
+	"strconv"
 
 	"github.com/taewony/go-fullstack-webapp/internal/components"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
 )
 
 // GET /login
 // Show the login page
 func LoginHandler(writer http.ResponseWriter, request *http.Request) {
 	if request.Header.Get("HX-Request") == "true" {
-		components.LoginFormTempl().Render(request.Context(), writer)
+		components.LoginFormTempl(Providers, challenge(captchaLogin)).Render(request.Context(), writer)
 	} else {
 		t := parseTemplateFiles("login.layout", "public.navbar", "login")
-		t.Execute(writer, nil)
+		t.Execute(writer, struct {
+			Providers []*oidc.Provider
+			Captcha   template.HTML
+			CSRF      template.HTML
+		}{Providers, challengeHTML(request.Context(), captchaLogin), componentHTML(request.Context(), components.CSRFTempl())})
 	}
 }
 
@@ -22,9 +30,13 @@ func LoginHandler(writer http.ResponseWriter, request *http.Request) {
 // Show the signup page
 func SignupHandler(writer http.ResponseWriter, request *http.Request) {
 	if request.Header.Get("HX-Request") == "true" {
-		components.SignupFormTempl().Render(request.Context(), writer)
+		components.SignupFormTempl(challenge(captchaSignup)).Render(request.Context(), writer)
 	} else {
-		generateHTML(writer, nil, "login.layout", "public.navbar", "signup")
+		generateHTML(writer, struct {
+			Captcha template.HTML
+			CSRF    template.HTML
+		}{challengeHTML(request.Context(), captchaSignup), componentHTML(request.Context(), components.CSRFTempl())},
+			"login.layout", "public.navbar", "signup")
 	}
 }
 
@@ -35,45 +47,153 @@ func SignupAccountHandler(writer http.ResponseWriter, request *http.Request) {
 	if err != nil {
 		danger(err, "Cannot parse form")
 	}
+	if captchaShown(captchaSignup) && !solvedCaptcha(writer, request, captchaSignup) {
+		return
+	}
 	user := models.User{
 		Name:     request.PostFormValue("name"),
+		Handle:   request.PostFormValue("handle"),
 		Email:    request.PostFormValue("email"),
 		Password: request.PostFormValue("password"),
 	}
+	if user.Handle == "" {
+		error_message(writer, request, "Please choose a username")
+		return
+	}
 	if err := user.Create(); err != nil {
 		danger(err, "Cannot create user")
+		if err == models.ErrInvalidHandle || err == models.ErrHandleTaken {
+			error_message(writer, request, err.Error())
+		} else {
+			error_message(writer, request, "Cannot create account")
+		}
+		return
+	}
+	if err := sendEmailVerification(request.Context(), user, user.Email); err != nil {
+		danger(err, "Cannot send verification email")
 	}
 	http.Redirect(writer, request, "/login", http.StatusFound)
 }
 
 // POST /authenticate
-// Authenticate the user given the email and password
+// Authenticate the user given the email and password. After a few failures each one makes
+// the email wait longer before the next attempt, until it is locked out for a while, and
+// the challenge must be solved.
 func AuthenticateHandler(writer http.ResponseWriter, request *http.Request) {
 	err := request.ParseForm()
-	user, err := models.UserByEmail(request.PostFormValue("email"))
+	email := request.PostFormValue("email")
+	wait, locked, err := models.LoginWait(email)
+	if err != nil {
+		danger(err, "Cannot check login failures")
+	}
+	if locked {
+		tooManyRequests(writer, request, "This account is locked after too many failed logins", wait)
+		return
+	}
+	if wait > 0 {
+		tooManyRequests(writer, request, "Too many failed logins", wait)
+		return
+	}
+	if limited(writer, request, ratelimit.Key("login", "account", email), AccountLoginRate) {
+		return
+	}
+	if captchaShown(captchaLogin) && models.LoginFailures(email) >= CaptchaLoginFailures &&
+		!solvedCaptcha(writer, request, captchaLogin) {
+		return
+	}
+	user, err := models.UserByEmail(email)
 	if err != nil {
 		danger(err, "Cannot find user")
 	}
-	if user.Password == models.Encrypt(request.PostFormValue("password")) {
-		session, err := user.CreateSession()
+	if err == nil && user.Password == models.Encrypt(request.PostFormValue("password")) {
+		if err := models.ClearLoginFailures(email); err != nil {
+			danger(err, "Cannot clear login failures")
+		}
+		logIn(writer, request, user, "password")
+	} else {
+		locked, err := models.RecordLoginFailure(email)
 		if err != nil {
-			danger(err, "Cannot create session")
+			danger(err, "Cannot record login failure")
 		}
-		cookie := http.Cookie{
-			Name:     "_cookie",
-			Value:    session.Uuid,
-			HttpOnly: true,
+		audit(request, models.AuditLoginFailed, models.User{}, user.Id, "", email)
+		if locked {
+			warning("Locked out", email, "after too many failed logins from", clientIP(request))
+			audit(request, models.AuditAccountLocked, models.User{}, user.Id, "", email)
 		}
-		http.SetCookie(writer, &cookie)
-		http.Redirect(writer, request, "/", http.StatusFound)
-	} else {
 		http.Redirect(writer, request, "/login", http.StatusFound)
 	}
 
 }
 
-// GET /logout
-// Logs the user out
+// Logs the user in, users with 2FA get a partial session until they send a code of their app.
+// Suspended and banned users are told why instead. Method is how the user proved who they are.
+func logIn(writer http.ResponseWriter, request *http.Request, user models.User, method string) {
+	if !user.CanLogIn() {
+		info("Refused login of", user.Email, "who is suspended or banned")
+		audit(request, models.AuditLoginFailed, models.User{}, user.Id, "", "suspended or banned")
+		error_message(writer, request, loginRefusal(user))
+		return
+	}
+	if !user.HasTwoFactor() {
+		startSession(writer, request, user, method)
+		return
+	}
+	session, err := user.CreatePartialSession(userAgent(request), clientIP(request))
+	if err != nil {
+		danger(err, "Cannot create session")
+	}
+	setSessionCookie(writer, request, session)
+	http.Redirect(writer, request, "/login/2fa", http.StatusFound)
+}
+
+// the message shown to a suspended or banned user trying to log in
+func loginRefusal(user models.User) string {
+	msg := "This account is banned"
+	if !user.IsBanned() {
+		msg = "This account is suspended until " + user.SuspendedUntil.Time.In(user.Location()).Format("Jan 2, 2006 at 3:04pm")
+	}
+	if user.SanctionReason != "" {
+		msg += ": " + user.SanctionReason
+	}
+	return msg
+}
+
+// Creates the full session of the user and goes to the home page
+func startSession(writer http.ResponseWriter, request *http.Request, user models.User, method string) {
+	session, err := user.CreateSession(userAgent(request), clientIP(request))
+	if err != nil {
+		danger(err, "Cannot create session")
+	}
+	audit(request, models.AuditLogin, user, user.Id, "session:"+strconv.Itoa(session.Id), method)
+	setSessionCookie(writer, request, session)
+	http.Redirect(writer, request, "/", http.StatusFound)
+}
+
+// the user agent kept with a session, cut short since clients send what they want
+func userAgent(request *http.Request) string {
+	ua := request.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	return ua
+}
+
+func setSessionCookie(writer http.ResponseWriter, request *http.Request, session models.Session) {
+	// without a path the cookie would only be sent below the path of the request. Lax keeps
+	// the cookie out of the POSTs other sites make, the CSRF tokens check the rest.
+	cookie := http.Cookie{
+		Name:     "_cookie",
+		Value:    session.Uuid,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secureCookies(request),
+	}
+	http.SetCookie(writer, &cookie)
+}
+
+// POST /logout
+// Logs the user out, a form with the CSRF token so another site cannot do it with a link
 func LogoutHandler(writer http.ResponseWriter, request *http.Request) {
 	cookie, err := request.Cookie("_cookie")
 	if err != http.ErrNoCookie {
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -8,7 +10,11 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/a-h/templ"
+	"github.com/taewony/go-fullstack-webapp/internal/components"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
 )
 
@@ -43,11 +49,116 @@ func session(writer http.ResponseWriter, request *http.Request) (sess models.Ses
 		sess = models.Session{Uuid: cookie.Value}
 		if ok, _ := sess.Check(); !ok {
 			err = errors.New("Invalid session")
+		} else if err := sess.Touch(); err != nil {
+			danger(err, "Cannot update session")
 		}
 	}
 	return
 }
 
+// Gets the user of a valid session, if not err is not nil
+func currentUser(writer http.ResponseWriter, request *http.Request) (user models.User, err error) {
+	sess, err := session(writer, request)
+	if err != nil {
+		return
+	}
+	user, err = sess.User()
+	// the sessions go with the sanction, this only covers a session racing with it
+	if err == nil && !user.CanLogIn() {
+		err = errors.New("Suspended or banned user")
+	}
+	return
+}
+
+// Checks the current password sent with the form of an account change, answering with an error
+// when it is wrong or when the account has no password yet
+func passwordConfirmed(writer http.ResponseWriter, request *http.Request, user models.User) bool {
+	if !user.HasPassword() {
+		error_message(writer, request, "Your account has no password yet, set one with a password reset first")
+		return false
+	}
+	if user.Password != models.Encrypt(request.PostFormValue("password")) {
+		error_message(writer, request, "The password is not correct")
+		return false
+	}
+	return true
+}
+
+// Picks the navbar matching the visitor, logged-in users get the private one
+func navbar(writer http.ResponseWriter, request *http.Request) templ.Component {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		return components.PublicNavbarTempl()
+	}
+	return components.PrivateNavbarTempl(user)
+}
+
+// Checks that the visitor may read the board the thread belongs to
+func canReadThread(writer http.ResponseWriter, request *http.Request, thread models.Thread) bool {
+	cat, err := thread.Category()
+	if err != nil {
+		return false
+	}
+	user, _ := currentUser(writer, request)
+	return user.CanRead(cat)
+}
+
+// Gets the read marks of the threads for the visitor, nil when not logged in
+func readMarks(writer http.ResponseWriter, request *http.Request, threads []models.Thread) models.ReadMarks {
+	user, err := currentUser(writer, request)
+	if err != nil {
+		return nil
+	}
+	marks, err := user.ReadMarks(threads)
+	if err != nil {
+		danger(err, "Cannot get read marks")
+		return nil
+	}
+	return marks
+}
+
+// Reads the 1-based ?from=&to= revision numbers, defaulting to the last change
+func revisionRange(request *http.Request, count int) (from, to int) {
+	from, to = max(count-1, 1), count
+	if n, err := strconv.Atoi(request.URL.Query().Get("from")); err == nil && n >= 1 && n <= count {
+		from = n
+	}
+	if n, err := strconv.Atoi(request.URL.Query().Get("to")); err == nil && n >= 1 && n <= count {
+		to = n
+	}
+	return
+}
+
+// Reads the 1-based ?page= number of a list
+func pageNumber(request *http.Request) int {
+	if n, err := strconv.Atoi(request.URL.Query().Get("page")); err == nil && n >= 1 {
+		return n
+	}
+	return 1
+}
+
+// Links to the pages of the list around the page, keeping the other query parameters
+func pager(request *http.Request, page int, more bool) (links components.Pager) {
+	link := func(n int) string {
+		query := request.URL.Query()
+		query.Del("page")
+		if n > 1 {
+			query.Set("page", strconv.Itoa(n))
+		}
+		if len(query) == 0 {
+			return request.URL.Path
+		}
+		return request.URL.Path + "?" + query.Encode()
+	}
+	if page > 1 {
+		links.Previous = link(page - 1)
+	}
+	if more {
+		links.Next = link(page + 1)
+	}
+	return
+}
+
 // parse HTML templates
 // pass in a list of file names, and get a template
 func parseTemplateFiles(filenames ...string) (t *template.Template) {
@@ -71,6 +182,20 @@ func generateHTML(writer http.ResponseWriter, data interface{}, filenames ...str
 	templates.ExecuteTemplate(writer, "layout", data)
 }
 
+// a component rendered for the pages made with html/template
+func componentHTML(ctx context.Context, component templ.Component) template.HTML {
+	var html bytes.Buffer
+	if err := component.Render(ctx, &html); err != nil {
+		danger(err, "Cannot render component")
+	}
+	return template.HTML(html.String())
+}
+
+// whether the cookies are only sent over HTTPS, when the site is served over it
+func secureCookies(request *http.Request) bool {
+	return request.TLS != nil || strings.HasPrefix(BaseURL, "https://")
+}
+
 // for logging
 func info(args ...interface{}) {
 	logger.SetPrefix("INFO ")
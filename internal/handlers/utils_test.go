@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+// a fresh in-memory database for the test
+func setupDB(t *testing.T) {
+	t.Helper()
+	models.InitDB()
+	t.Cleanup(func() { models.Db.Close() })
+}
+
+// a user of the email, verified or not
+func createUser(t *testing.T, handle string, verified bool) models.User {
+	t.Helper()
+	user := models.User{Name: handle, Handle: handle, Email: handle + "@example.com", Password: "password"}
+	if err := user.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := user.MarkVerified(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err := models.UserById(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// the cookie of the name the response sets, nil when it sets none
+func responseCookie(response *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// whether the handler answered with the error page
+func isErrorPage(response *httptest.ResponseRecorder) bool {
+	return strings.HasPrefix(response.Header().Get("Location"), "/err?")
+}
+
+// a form posted in the session
+func formRequest(session models.Session, form url.Values) *http.Request {
+	request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: "_cookie", Value: session.Uuid})
+	return request
+}
@@ -0,0 +1,25 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir writes every message as an .eml file below a directory instead of sending it, for development
+type Dir struct {
+	Path string
+	From string
+}
+
+func NewDir(path, from string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0750); err != nil {
+		return nil, err
+	}
+	return &Dir{Path: path, From: from}, nil
+}
+
+func (d *Dir) Send(msg Message) error {
+	name := time.Now().Format("20060102-150405") + "-" + randomId() + ".eml"
+	return os.WriteFile(filepath.Join(d.Path, name), Build(d.From, msg), 0640)
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML version of the same content
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages, a failed delivery is retried later by the outbox worker
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Build encodes the message as a multipart/alternative MIME email
+func Build(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	domain := "localhost"
+	if _, host, ok := strings.Cut(from, "@"); ok {
+		domain = strings.Trim(host, "> ")
+	}
+
+	header := []string{
+		"From: " + from,
+		// line breaks in the address would let it inject headers
+		"To: " + strings.NewReplacer("\r", "", "\n", "").Replace(msg.To),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + randomId() + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary(),
+	}
+	var out bytes.Buffer
+	out.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	// plain text first, clients show the last part they understand
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	writer.Close()
+	out.Write(buf.Bytes())
+	return out.Bytes()
+}
+
+func randomId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
@@ -0,0 +1,139 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taewony/go-fullstack-webapp/internal/mail/mailtest"
+)
+
+var message = Message{
+	To:      "someone@example.com",
+	Subject: "Vérifiez votre adresse",
+	Text:    "Follow the link to verify your email.",
+	HTML:    "<p>Follow the <a href=\"https://example.com/verify\">link</a> to verify your email.</p>",
+}
+
+// checks the message is a multipart/alternative email with the text then the HTML version
+func checkMessage(t *testing.T, data []byte, want Message) {
+	t.Helper()
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to := parsed.Header.Get("To"); to != want.To {
+		t.Errorf("To = %q, want %q", to, want.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != want.Subject {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, want.Subject)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", want.Text},
+		{"text/html; charset=utf-8", want.HTML},
+	} {
+		p, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Header.Get("Content-Type") != part.contentType {
+			t.Errorf("part is %q, want %q", p.Header.Get("Content-Type"), part.contentType)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(p))
+		if string(body) != part.body {
+			t.Errorf("%s part = %q, want %q", part.contentType, body, part.body)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	checkMessage(t, Build("ChitChat <noreply@chitchat.example>", message), message)
+
+	injected := message
+	injected.To = "someone@example.com\r\nBcc: everyone@example.com"
+	data := Build("noreply@chitchat.example", injected)
+	if bytes.Contains(data, []byte("\r\nBcc:")) {
+		t.Error("a line break in the address added a header")
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		failing  bool
+		wantErr  bool
+	}{
+		{"without authentication", "", "", false, false},
+		{"with authentication", "chitchat", "secret", false, false},
+		{"wrong password", "chitchat", "wrong", false, true},
+		{"recipient refused", "", "", true, true},
+	}
+	for _, test := range tests {
+		server, err := mailtest.NewServer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.username != "" {
+			server.Username, server.Password = "chitchat", "secret"
+		}
+		server.SetFailing(test.failing)
+		s := NewSMTP(server.Host, server.Port, test.username, test.password, "noreply@chitchat.example")
+		err = s.Send(message)
+		received := server.Received()
+		server.Close()
+
+		if test.wantErr {
+			if err == nil || len(received) != 0 {
+				t.Errorf("%s: err = %v and %d messages, want an error and none", test.name, err, len(received))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(received) != 1 {
+			t.Errorf("%s: %d messages, want 1", test.name, len(received))
+			continue
+		}
+		if received[0].From != "noreply@chitchat.example" || strings.Join(received[0].To, ",") != message.To {
+			t.Errorf("%s: envelope %s -> %v", test.name, received[0].From, received[0].To)
+		}
+		checkMessage(t, received[0].Data, message)
+	}
+}
+
+func TestDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail")
+	dir, err := NewDir(path, "noreply@chitchat.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.Send(message); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("%d files, %v, want one .eml file", len(files), err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessage(t, data, message)
+}
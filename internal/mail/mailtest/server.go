@@ -0,0 +1,166 @@
+// Package mailtest runs an SMTP server in the process for the tests of the code sending mail
+package mailtest
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Received is a message the server accepted, with its envelope
+type Received struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// Server accepts the messages sent to it on a local port and keeps them. It offers PLAIN
+// authentication when Username is set, and refuses every recipient while it is failing.
+type Server struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	listener net.Listener
+	mu       sync.Mutex
+	failing  bool
+	received []Received
+}
+
+// NewServer starts a server listening on a free port of the loopback interface
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{Host: "127.0.0.1", Port: addr.Port, listener: listener}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// SetFailing makes the server refuse the recipients of the next messages, or accept them again
+func (s *Server) SetFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+// Received returns the messages accepted so far
+func (s *Server) Received() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.received...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks just enough SMTP for net/smtp: EHLO, AUTH PLAIN, MAIL, RCPT, DATA, RSET and QUIT
+func (s *Server) handle(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	var msg Received
+	authenticated := s.Username == ""
+	reply := func(code int, lines ...string) {
+		for i, line := range lines {
+			sep := "-"
+			if i == len(lines)-1 {
+				sep = " "
+			}
+			text.PrintfLine("%d%s%s", code, sep, line)
+		}
+	}
+	reply(220, "localhost ESMTP mailtest")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.Username != "" {
+				reply(250, "localhost", "AUTH PLAIN")
+			} else {
+				reply(250, "localhost")
+			}
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			credentials, err := base64.StdEncoding.DecodeString(initial)
+			if mechanism != "PLAIN" || err != nil || string(credentials) != "\x00"+s.Username+"\x00"+s.Password {
+				reply(535, "authentication failed")
+				continue
+			}
+			authenticated = true
+			reply(235, "authenticated")
+		case "MAIL":
+			if !authenticated {
+				reply(530, "authentication required")
+				continue
+			}
+			msg = Received{From: address(arg)}
+			reply(250, "ok")
+		case "RCPT":
+			s.mu.Lock()
+			failing := s.failing
+			s.mu.Unlock()
+			if failing {
+				reply(550, "mailbox unavailable")
+				continue
+			}
+			msg.To = append(msg.To, address(arg))
+			reply(250, "ok")
+		case "DATA":
+			if len(msg.To) == 0 {
+				reply(554, "no valid recipients")
+				continue
+			}
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = data
+			s.mu.Lock()
+			s.received = append(s.received, msg)
+			s.mu.Unlock()
+			msg = Received{}
+			reply(250, "ok: queued as "+strconv.Itoa(len(s.Received())))
+		case "RSET":
+			msg = Received{}
+			reply(250, "ok")
+		case "NOOP":
+			reply(250, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+// the address of a "FROM:<address>" or "TO:<address>" argument
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
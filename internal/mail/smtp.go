@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTP sends messages through an SMTP server, STARTTLS is used when the server offers it
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	return &SMTP{Host: host, Port: port, Username: username, Password: password, From: from}
+}
+
+func (s *SMTP) Send(msg Message) error {
+	var auth smtp.Auth
+	// PLAIN auth is refused over unencrypted connections, except to localhost
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	return smtp.SendMail(addr, auth, s.From, []string{msg.To}, Build(s.From, msg))
+}
@@ -0,0 +1,66 @@
+package markdown
+
+import (
+	"regexp"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// CommonMark plus the GFM extensions (tables, strikethrough, autolinks, task lists),
+// fenced code blocks are highlighted with CSS classes from /static/css/highlight.css
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle("github"),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(linkRel{}, 100)),
+		parser.WithInlineParsers(util.Prioritized(mentionParser{}, 500)),
+	),
+)
+
+// only what the markdown renderer produces is allowed through, raw HTML
+// typed by users is already escaped by goldmark
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^nofollow ugc$`)).OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^mention$`)).OnElements("a")
+	p.AllowElements("input")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}()
+
+// Render turns a post body into sanitized HTML, mentions are left as plain text
+func Render(source string) (string, error) {
+	return RenderWithMentions(source, nil)
+}
+
+// marks every link written by users as user generated content
+type linkRel struct{}
+
+func (linkRel) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.Link, *ast.AutoLink:
+			n.SetAttributeString("rel", []byte("nofollow ugc"))
+		}
+		return ast.WalkContinue, nil
+	})
+}
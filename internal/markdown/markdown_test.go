@@ -0,0 +1,50 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// parts the HTML must have, and must not have
+		want, unwanted []string
+	}{
+		{"script", "hi <script>alert(1)</script>", []string{"<p>hi"}, []string{"<script"}},
+		{"script block", "<script>alert(1)</script>", nil, []string{"<script"}},
+		{"javascript link", "[x](javascript:alert(1))", []string{">x</a>"}, []string{"href", "javascript"}},
+		{"javascript link in capitals", "[x](JaVaScRiPt:alert(1))", []string{">x</a>"}, []string{"href", "alert"}},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", []string{">x</a>"}, []string{"href", "data:"}},
+		{"event handler", `<img src=x onerror=alert(1)>`, nil, []string{"<img", "onerror"}},
+		{"event handler on a link", `<a href="https://example.com" onclick="steal()">a</a>`, nil, []string{"onclick", "<a"}},
+		{"raw HTML", "<b>bold</b> <div style=\"position:fixed\">over</div>", []string{"bold"}, []string{"<b>", "<div", "style"}},
+		{"external link", "[link](https://example.com)",
+			[]string{`<a href="https://example.com" rel="nofollow ugc">link</a>`}, nil},
+		{"autolink", "see https://example.com",
+			[]string{`<a href="https://example.com" rel="nofollow ugc">`}, nil},
+		{"image", "![alt](https://example.com/a.png)", []string{`<img src="https://example.com/a.png" alt="alt">`}, nil},
+		{"task list", "- [x] done", []string{`<input checked="" disabled="" type="checkbox">`}, nil},
+		{"highlighted code", "```go\nfunc main() {}\n```", []string{`<pre class="chroma">`, `<span class="kd">func</span>`}, nil},
+		{"code is not run", "`<script>`", []string{"<code>&lt;script&gt;</code>"}, []string{"<script>"}},
+		// without a resolver mentions stay text
+		{"mention", "hi @alice", []string{"<p>hi @alice</p>"}, []string{"<a"}},
+	}
+	for _, test := range tests {
+		html, err := Render(test.source)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, part := range test.want {
+			if !strings.Contains(html, part) {
+				t.Errorf("%s: %q has no %q", test.name, html, part)
+			}
+		}
+		for _, part := range test.unwanted {
+			if strings.Contains(strings.ToLower(html), part) {
+				t.Errorf("%s: %q has %q", test.name, html, part)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Resolver finds the link of a mentioned handle, ok is false for unknown handles
+// which are then left as plain text
+type Resolver func(handle string) (href string, ok bool)
+
+var resolverKey = parser.NewContextKey()
+
+var mentionPattern = regexp.MustCompile(`^@([A-Za-z0-9_]{3,32})`)
+
+// RenderWithMentions is Render with @handle mentions turned into links
+func RenderWithMentions(source string, resolve Resolver) (string, error) {
+	ctx := parser.NewContext()
+	if resolve != nil {
+		ctx.Set(resolverKey, resolve)
+	}
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Mentions lists the lowercased handles mentioned in a post body, mentions in code are ignored
+func Mentions(source string) (handles []string) {
+	seen := map[string]bool{}
+	ctx := parser.NewContext()
+	ctx.Set(resolverKey, Resolver(func(handle string) (string, bool) {
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+		return "", true
+	}))
+	md.Parser().Parse(text.NewReader([]byte(source)), parser.WithContext(ctx))
+	return
+}
+
+// parses @handle into a link with the mention class
+type mentionParser struct{}
+
+func (mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	resolve, _ := pc.Get(resolverKey).(Resolver)
+	if resolve == nil {
+		return nil
+	}
+	// an @ inside a word is part of an email address, not a mention
+	if prev := block.PrecendingCharacter(); prev == '_' || unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+		return nil
+	}
+	line, segment := block.PeekLine()
+	match := mentionPattern.FindSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	// longer words are not handles
+	if len(line) > len(match[0]) {
+		if next := rune(line[len(match[0])]); next == '_' || unicode.IsLetter(next) || unicode.IsDigit(next) {
+			return nil
+		}
+	}
+	href, ok := resolve(strings.ToLower(string(match[1])))
+	if !ok {
+		return nil
+	}
+	block.Advance(len(match[0]))
+	link := ast.NewLink()
+	link.Destination = []byte(href)
+	link.SetAttributeString("class", []byte("mention"))
+	link.AppendChild(link, ast.NewTextSegment(segment.WithStop(segment.Start+len(match[0]))))
+	return link
+}
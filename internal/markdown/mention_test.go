@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"hi @alice", []string{"alice"}},
+		{"@Alice and @bob, @ALICE again", []string{"alice", "bob"}},
+		{"(@alice) @bob.", []string{"alice", "bob"}},
+		{"write to alice@example.com", nil},
+		{"`@alice` in code", nil},
+		{"```\n@alice\n```", nil},
+		{"too short @al", nil},
+		{"too long @" + strings.Repeat("a", 33), nil},
+		{"@alice-smith", []string{"alice"}},
+		{"**@alice**", []string{"alice"}},
+	}
+	for _, test := range tests {
+		if handles := Mentions(test.source); !slices.Equal(handles, test.want) {
+			t.Errorf("%q: mentions %v, want %v", test.source, handles, test.want)
+		}
+	}
+}
+
+func TestRenderWithMentions(t *testing.T) {
+	resolve := func(handle string) (string, bool) {
+		if handle == "alice" {
+			return "/users/alice-uuid", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name, source, want string
+	}{
+		{"known user", "hi @Alice", `<p>hi <a href="/users/alice-uuid" class="mention" rel="nofollow ugc">@Alice</a></p>`},
+		{"unknown user", "hi @bob", "<p>hi @bob</p>"},
+		// the address is linked as an email, not as a mention
+		{"email address", "alice@example.com", `<p><a href="mailto:alice@example.com" rel="nofollow ugc">alice@example.com</a></p>`},
+		{"in code", "`@alice`", "<p><code>@alice</code></p>"},
+	}
+	for _, test := range tests {
+		html, err := RenderWithMentions(test.source, resolve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if html = strings.TrimSpace(html); html != test.want {
+			t.Errorf("%s: %s, want %s", test.name, html, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// content types accepted for attachments, sniffed from the data and never
+// taken from the file name or the browser
+var allowed = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"application/zip": true,
+}
+
+var ErrNotAllowed = errors.New("media: file type not allowed")
+
+var ErrTooLarge = errors.New("media: image too large")
+
+// MaxPixels is the largest image, width times height, thumbnails are made of. Decoding
+// takes memory for every pixel, and a small compressed file can claim a huge image.
+var MaxPixels = 25 << 20
+
+// Sniff detects the content type of the data and checks that it is allowed
+func Sniff(data []byte) (contentType string, err error) {
+	contentType, _, _ = strings.Cut(http.DetectContentType(data), ";")
+	if !allowed[contentType] {
+		err = ErrNotAllowed
+	}
+	return
+}
+
+// IsImage reports whether thumbnails can be made for the content type
+func IsImage(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/gif"
+}
+
+// StripMetadata removes EXIF, XMP and text metadata (camera, GPS position, ...)
+// from JPEG and PNG images without re-encoding them, other types are left as they are
+func StripMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	}
+	return data, nil
+}
+
+// JPEG segments are 0xFF marker, 2 bytes length, payload until the scan starts
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("media: not a JPEG image")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, errors.New("media: corrupt JPEG image")
+		}
+		marker := data[i+1]
+		// start of scan, the compressed image data follows up to the end
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errors.New("media: corrupt JPEG image")
+		}
+		// APP1 holds EXIF and XMP, APP13 holds IPTC, COM holds comments;
+		// JFIF (APP0), ICC profiles (APP2) and Adobe (APP14) are kept for the colors
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return nil, errors.New("media: truncated JPEG image")
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// chunks dropped from PNG images
+var pngMetadata = map[string]bool{"eXIf": true, "tEXt": true, "iTXt": true, "zTXt": true, "tIME": true}
+
+// PNG chunks are 4 bytes length, 4 bytes type, payload, 4 bytes CRC
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("media: not a PNG image")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		end := i + 12 + length
+		if end > len(data) {
+			return nil, errors.New("media: corrupt PNG image")
+		}
+		kind := string(data[i+4 : i+8])
+		if crc32.ChecksumIEEE(data[i+4:end-4]) != binary.BigEndian.Uint32(data[end-4:end]) {
+			return nil, errors.New("media: corrupt PNG image")
+		}
+		if !pngMetadata[kind] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if kind == "IEND" {
+			return out.Bytes(), nil
+		}
+	}
+	return nil, errors.New("media: truncated PNG image")
+}
+
+// Thumbnail scales the image down to fit in a size x size box, JPEG images
+// give a JPEG thumbnail, PNG and GIF a PNG one to keep the transparency
+func Thumbnail(contentType string, data []byte, size int) (thumb []byte, thumbType string, err error) {
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch contentType {
+	case "image/jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "image/png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case "image/gif":
+		decodeConfig, decode = gif.DecodeConfig, gif.Decode
+	default:
+		err = errors.New("media: not an image")
+		return
+	}
+	// the header tells the size before any pixel is decoded
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxPixels/config.Height {
+		err = ErrTooLarge
+		return
+	}
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	dst := scale(src, size)
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		thumbType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	} else {
+		thumbType = "image/png"
+		err = png.Encode(&buf, dst)
+	}
+	thumb = buf.Bytes()
+	return
+}
+
+// box filter: every thumbnail pixel is the average of the source pixels it covers
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.Set(x, y, color.NRGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,121 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// insert a chunk right after the IHDR chunk of the PNG
+func withChunk(data []byte, kind string, payload []byte) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	// signature (8) and IHDR (4 + 4 + 13 + 4)
+	at := 8 + 25
+	return append(append(append([]byte{}, data[:at]...), chunk...), data[at:]...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{"png", encodePNG(t, 1, 1), "image/png", nil},
+		{"pdf", []byte("%PDF-1.4\n"), "application/pdf", nil},
+		{"text", []byte("hello"), "text/plain", nil},
+		{"html", []byte("<html><script>alert(1)</script></html>"), "text/html", ErrNotAllowed},
+		{"exe", []byte("MZ\x90\x00\x03\x00\x00\x00"), "application/octet-stream", ErrNotAllowed},
+	}
+	for _, test := range tests {
+		got, err := Sniff(test.data)
+		if got != test.want || err != test.err {
+			t.Errorf("%s: Sniff = %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	data := withChunk(encodePNG(t, 4, 4), "tEXt", []byte("GPS\x0048.85,2.35"))
+	stripped, err := StripMetadata("image/png", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("tEXt")) || bytes.Contains(stripped, []byte("48.85")) {
+		t.Error("the text chunk is still there")
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("the stripped image does not decode: %v", err)
+	}
+	if _, err := StripMetadata("image/png", data[:len(data)-10]); err == nil {
+		t.Error("a truncated image was accepted")
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// an APP1 (EXIF) segment after the start of image
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x0B}, []byte("Exif\x00\x00GPS")...)
+	withExif := append(append(append([]byte{}, data[:2]...), exif...), data[2:]...)
+	stripped, err := StripMetadata("image/jpeg", withExif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("Exif")) {
+		t.Error("the EXIF segment is still there")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("the stripped image does not decode: %v", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	thumb, thumbType, err := Thumbnail("image/png", encodePNG(t, 400, 100), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbType != "image/png" || img.Bounds().Dx() != 200 || img.Bounds().Dy() != 50 {
+		t.Errorf("thumbnail is %s %v, want image/png 200x50", thumbType, img.Bounds())
+	}
+}
+
+func TestThumbnailRejectsDecompressionBomb(t *testing.T) {
+	// a valid PNG header claiming 100000 x 100000 pixels, 40 GB once decoded
+	data := encodePNG(t, 1, 1)
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, _, err := Thumbnail("image/png", data, 200); err != ErrTooLarge {
+		t.Errorf("err = %v, want ErrTooLarge", err)
+	}
+}
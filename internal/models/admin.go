@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNotRestorable = errors.New("this is not deleted, or was removed with the account of its author")
+
+// DayCount is the number of events of one day, in the zone the stats were asked in
+type DayCount struct {
+	Day   time.Time
+	Count int
+}
+
+// SiteStats is the health of the site shown on the admin dashboard
+type SiteStats struct {
+	Users   int
+	Threads int
+	Posts   int
+	// users who were seen or posted in the last day and the last week
+	ActiveDay  int
+	ActiveWeek int
+	// one entry per day, the oldest first and today last
+	Signups     []DayCount
+	PostsPerDay []DayCount
+}
+
+// Get the site statistics, with the signups and posts of the last days counted per day of loc
+func Stats(days int, loc *time.Location) (stats SiteStats, err error) {
+	for _, count := range []struct {
+		query string
+		dest  *int
+	}{
+		{"SELECT count(*) FROM users WHERE deleted_at IS NULL", &stats.Users},
+		{"SELECT count(*) FROM threads WHERE deleted_at IS NULL", &stats.Threads},
+		{"SELECT count(*) FROM posts WHERE deleted_at IS NULL", &stats.Posts},
+	} {
+		if err = Db.QueryRow(count.query).Scan(count.dest); err != nil {
+			return
+		}
+	}
+	now := time.Now()
+	if stats.ActiveDay, err = ActiveUsers(now.Add(-24 * time.Hour)); err != nil {
+		return
+	}
+	if stats.ActiveWeek, err = ActiveUsers(now.AddDate(0, 0, -7)); err != nil {
+		return
+	}
+	if stats.Signups, err = perDay("SELECT created_at FROM users WHERE created_at >= $1", days, loc); err != nil {
+		return
+	}
+	stats.PostsPerDay, err = perDay("SELECT created_at FROM posts WHERE created_at >= $1", days, loc)
+	return
+}
+
+// Count the users who used a session or wrote something since the given time
+func ActiveUsers(since time.Time) (count int, err error) {
+	err = Db.QueryRow(`SELECT count(DISTINCT user_id) FROM (
+		SELECT user_id FROM sessions WHERE last_seen_at >= $1 AND NOT partial
+		UNION SELECT user_id FROM threads WHERE created_at >= $2
+		UNION SELECT user_id FROM posts WHERE created_at >= $3) AS active`, since, since, since).Scan(&count)
+	return
+}
+
+// count the times returned by the query per day of loc, the query gets the start of the first day
+func perDay(query string, days int, loc *time.Location) (counts []DayCount, err error) {
+	now := time.Now().In(loc)
+	first := time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, loc)
+	counts = make([]DayCount, days)
+	// days are not always 24 hours long, so they are looked up by their date
+	index := map[string]int{}
+	for i := range counts {
+		counts[i].Day = first.AddDate(0, 0, i)
+		index[counts[i].Day.Format(time.DateOnly)] = i
+	}
+	rows, err := Db.Query(query, first)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at time.Time
+		if err = rows.Scan(&at); err != nil {
+			return
+		}
+		if i, ok := index[at.In(loc).Format(time.DateOnly)]; ok {
+			counts[i].Count++
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// Get the users whose name, handle or email contains the query, the newest first
+func SearchUsers(query string, limit int) (users []User, err error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(query)) + "%"
+	rows, err := Db.Query("SELECT "+userColumns+` FROM users
+		WHERE lower(name) LIKE $1 ESCAPE '\' OR handle LIKE $2 ESCAPE '\' OR lower(email) LIKE $3 ESCAPE '\'
+		ORDER BY created_at DESC LIMIT $4`, pattern, pattern, pattern, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := User{}
+		if err = user.scan(rows); err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// Get the logged in sessions of every user, the most recently used first
+func AllSessions(limit int) (sessions []Session, err error) {
+	rows, err := Db.Query("SELECT "+sessionColumns+" FROM sessions WHERE NOT partial ORDER BY last_seen_at DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session := Session{}
+		if err = session.scan(rows); err != nil {
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	return
+}
+
+// Delete a session of any user, userId is whose session it was and zero when there is no such session
+func DeleteSessionById(id int) (userId int, err error) {
+	err = Db.QueryRow("delete from sessions where id = $1 returning user_id", id).Scan(&userId)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// Get the newest threads across all boards, deleted ones included
+func NewestThreads(limit int) (threads []Thread, err error) {
+	rows, err := Db.Query("SELECT "+threadColumns+" FROM threads ORDER BY created_at DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		thread := Thread{}
+		if err = thread.scan(rows); err != nil {
+			return
+		}
+		threads = append(threads, thread)
+	}
+	err = rows.Err()
+	return
+}
+
+// Get the newest posts across all threads, deleted ones included
+func NewestPosts(limit int) (posts []Post, err error) {
+	rows, err := Db.Query("SELECT "+postColumns+" FROM posts ORDER BY created_at DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		post := Post{}
+		if err = post.scan(rows); err != nil {
+			return
+		}
+		posts = append(posts, post)
+	}
+	err = rows.Err()
+	return
+}
+
+// Undo the soft delete of the post, posts blanked with the account of their author stay deleted
+// and the error is then ErrNotRestorable
+func (post *Post) Restore() (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("update posts set deleted_at = NULL where id = $1 and deleted_at is not null and body != ''", post.Id)
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotRestorable
+	}
+	if err = recountPosts(tx, post.ThreadId); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Undo the soft delete of the thread, threads blanked with the account of their author stay
+// deleted and the error is then ErrNotRestorable
+func (thread *Thread) Restore() (err error) {
+	result, err := Db.Exec("update threads set deleted_at = NULL where id = $1 and deleted_at is not null and topic != ''", thread.Id)
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotRestorable
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestRestore(t *testing.T) {
+	setupDB(t)
+	author := createUser(t, "author")
+	thread, err := author.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		deleted, blanked bool
+		want             error
+	}{
+		{"deleted", true, false, nil},
+		{"not deleted", false, false, ErrNotRestorable},
+		// as the purge of the account of the author leaves it
+		{"blanked", true, true, ErrNotRestorable},
+	}
+	for _, test := range tests {
+		target, err := author.CreateThread(Category{Id: 1}, test.name, Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		post, err := author.CreatePost(thread, test.name, Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.deleted {
+			if err := target.Delete(); err != nil {
+				t.Fatal(err)
+			}
+			if err := post.Delete(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.blanked {
+			Db.Exec("update threads set topic = '' where id = $1", target.Id)
+			Db.Exec("update posts set body = '' where id = $1", post.Id)
+		}
+		if err := target.Restore(); err != test.want {
+			t.Errorf("thread %s: %v, want %v", test.name, err, test.want)
+		}
+		if err := post.Restore(); err != test.want {
+			t.Errorf("post %s: %v, want %v", test.name, err, test.want)
+		}
+		stored, _ := ThreadByUUID(target.Uuid)
+		if stored.IsDeleted() != test.blanked {
+			t.Errorf("thread %s: deleted %v, want %v", test.name, stored.IsDeleted(), test.blanked)
+		}
+		checkNumPosts(t, test.name, thread.Id)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a file uploaded with a post, the bytes live in the storage backend
+type Attachment struct {
+	Id          int
+	Uuid        string
+	PostId      int
+	UserId      int
+	Filename    string
+	ContentType string
+	Size        int64
+	StorageKey  string
+	ThumbKey    string
+	CreatedAt   time.Time
+}
+
+const attachmentColumns = "id, uuid, post_id, user_id, filename, content_type, size, storage_key, thumb_key, created_at"
+
+func (att *Attachment) scan(row scanner) error {
+	return row.Scan(&att.Id, &att.Uuid, &att.PostId, &att.UserId, &att.Filename, &att.ContentType, &att.Size, &att.StorageKey, &att.ThumbKey, &att.CreatedAt)
+}
+
+// Create a new attachment record, the uuid is generated by NewAttachmentUUID
+// before the file is written to the storage
+func (att *Attachment) Create() (err error) {
+	statement := "insert into attachments (uuid, post_id, user_id, filename, content_type, size, storage_key, thumb_key, created_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id, created_at"
+	stmt, err := Db.Prepare(statement)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRow(att.Uuid, att.PostId, att.UserId, att.Filename, att.ContentType, att.Size, att.StorageKey, att.ThumbKey, time.Now()).
+		Scan(&att.Id, &att.CreatedAt)
+	return
+}
+
+// Generate the uuid of an attachment about to be stored
+func NewAttachmentUUID() string {
+	return createUUID()
+}
+
+// check if the attachment is an image with a thumbnail
+func (att *Attachment) HasThumbnail() bool {
+	return att.ThumbKey != ""
+}
+
+// Get an attachment by the UUID
+func AttachmentByUUID(uuid string) (att Attachment, err error) {
+	err = att.scan(Db.QueryRow("SELECT "+attachmentColumns+" FROM attachments WHERE uuid = $1", uuid))
+	return
+}
+
+// Get the post the attachment belongs to
+func (att *Attachment) Post() (post Post, err error) {
+	err = post.scan(Db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = $1", att.PostId))
+	return
+}
+
+// get the attachments of a post
+func (post *Post) Attachments() (atts []Attachment, err error) {
+	rows, err := Db.Query("SELECT "+attachmentColumns+" FROM attachments WHERE post_id = $1 ORDER BY id", post.Id)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		att := Attachment{}
+		if err = att.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		atts = append(atts, att)
+	}
+	rows.Close()
+	return
+}
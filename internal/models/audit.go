@@ -0,0 +1,233 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditKind is the security or moderation event an audit entry records
+type AuditKind string
+
+const (
+	AuditLogin           AuditKind = "login"
+	AuditLoginFailed     AuditKind = "login_failed"
+	AuditAccountLocked   AuditKind = "account_locked"
+	AuditPasswordChanged AuditKind = "password_changed"
+	AuditPasswordReset   AuditKind = "password_reset"
+	AuditTwoFactorReset  AuditKind = "two_factor_reset"
+	AuditRoleChanged     AuditKind = "role_changed"
+	AuditSessionRevoked  AuditKind = "session_revoked"
+	AuditSessionsRevoked AuditKind = "sessions_revoked"
+	AuditAccountDeleted  AuditKind = "account_deleted"
+	AuditUserSuspended   AuditKind = "user_suspended"
+	AuditUserBanned      AuditKind = "user_banned"
+	AuditUserReinstated  AuditKind = "user_reinstated"
+	AuditThreadState     AuditKind = "thread_state"
+	AuditContentDeleted  AuditKind = "content_deleted"
+	AuditContentRestored AuditKind = "content_restored"
+	AuditReportsResolved AuditKind = "reports_resolved"
+	AuditTagChanged      AuditKind = "tag_changed"
+	AuditHoldReviewed    AuditKind = "hold_reviewed"
+)
+
+// all the kinds, in the order of the filter of the audit log
+func AuditKinds() []AuditKind {
+	return []AuditKind{AuditLogin, AuditLoginFailed, AuditAccountLocked, AuditPasswordChanged, AuditPasswordReset,
+		AuditTwoFactorReset, AuditRoleChanged, AuditSessionRevoked, AuditSessionsRevoked, AuditAccountDeleted,
+		AuditUserSuspended, AuditUserBanned, AuditUserReinstated, AuditThreadState, AuditContentDeleted,
+		AuditContentRestored, AuditReportsResolved, AuditTagChanged, AuditHoldReviewed}
+}
+
+// Origin is who caused an audit event and the request it came with, the zero Origin is the server itself
+type Origin struct {
+	ActorId   int
+	IP        string
+	RequestId string
+}
+
+// AuditEvent is an entry of the audit log. Entries are only ever added, each one carries the hash
+// of the entry before it so that changing or removing an entry breaks the chain after it.
+type AuditEvent struct {
+	Id   int
+	Kind AuditKind
+	// the user who did it, if any
+	ActorId sql.NullInt64
+	// the user the event is about, if any
+	UserId sql.NullInt64
+	// what the event is about besides the user, like thread:<uuid> or session:<id>
+	Target    string
+	IP        string
+	RequestId string
+	Detail    string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+	// the emails of the actor and of the user, empty for the server and anonymous visitors,
+	// only set by AuditEvents
+	ActorEmail string
+	UserEmail  string
+}
+
+const auditColumns = "id, kind, actor_id, user_id, target, ip, request_id, detail, created_at, prev_hash, hash"
+
+func (event *AuditEvent) scan(row scanner) error {
+	return row.Scan(&event.Id, &event.Kind, &event.ActorId, &event.UserId, &event.Target, &event.IP, &event.RequestId,
+		&event.Detail, &event.CreatedAt, &event.PrevHash, &event.Hash)
+}
+
+// the hash of the entry, over the hash of the previous entry and every field but the id
+func (event *AuditEvent) computeHash() string {
+	fields, _ := json.Marshal([]interface{}{event.Kind, event.ActorId.Int64, event.UserId.Int64, event.Target, event.IP,
+		event.RequestId, event.Detail, event.CreatedAt.UTC().Format(time.RFC3339Nano)})
+	sum := sha256.Sum256(append([]byte(event.PrevHash+"\n"), fields...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Add an entry to the audit log, userId is the user the event is about or zero
+func RecordAudit(kind AuditKind, origin Origin, userId int, target, detail string) (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	return commitAudit(tx, kind, origin, userId, target, detail)
+}
+
+// add the entry at the end of the chain and commit the transaction, so that the changes it records
+// and the entry are saved together and no other entry gets in between
+func commitAudit(tx *sql.Tx, kind AuditKind, origin Origin, userId int, target, detail string) (err error) {
+	// the chain only holds if entries are added one at a time. Updating the row of audit_lock
+	// locks it until the commit, the other writers wait on it whatever server they run on,
+	// like a SELECT ... FOR UPDATE SQLite does not have. The last entry is read once it is held.
+	result, err := tx.Exec("update audit_lock set locked_at = $1 where id = 1", time.Now())
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count != 1 {
+		return errors.New("the audit_lock row is missing")
+	}
+	event := AuditEvent{
+		Kind:      kind,
+		ActorId:   sql.NullInt64{Int64: int64(origin.ActorId), Valid: origin.ActorId != 0},
+		UserId:    sql.NullInt64{Int64: int64(userId), Valid: userId != 0},
+		Target:    target,
+		IP:        origin.IP,
+		RequestId: origin.RequestId,
+		Detail:    detail,
+		// the precision a Postgres timestamp keeps, the hash must match once read back
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	err = tx.QueryRow("SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&event.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	event.Hash = event.computeHash()
+	_, err = tx.Exec(`insert into audit_events (kind, actor_id, user_id, target, ip, request_id, detail, created_at, prev_hash, hash)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		event.Kind, event.ActorId, event.UserId, event.Target, event.IP, event.RequestId, event.Detail, event.CreatedAt,
+		event.PrevHash, event.Hash)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// AuditFilter picks the entries shown or exported, zero fields match everything
+type AuditFilter struct {
+	Kind AuditKind
+	// the email or handle of the user who did it or whom it is about
+	User string
+	IP   string
+	// entries from Since included to Until excluded
+	Since time.Time
+	Until time.Time
+}
+
+// the where clause and its arguments
+func (filter AuditFilter) where() (where string, args []interface{}) {
+	var conditions []string
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if filter.Kind != "" {
+		conditions = append(conditions, "kind = "+arg(filter.Kind))
+	}
+	if filter.User != "" {
+		user := strings.ToLower(strings.TrimPrefix(filter.User, "@"))
+		users := "(SELECT id FROM users WHERE lower(email) = " + arg(user) + " OR handle = " + arg(user) + ")"
+		conditions = append(conditions, "(actor_id IN "+users+" OR user_id IN "+users+")")
+	}
+	if filter.IP != "" {
+		conditions = append(conditions, "ip = "+arg(filter.IP))
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.Since.UTC()))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.Until.UTC()))
+	}
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return
+}
+
+// Get the entries matching the filter, the latest first, a limit of zero gets them all
+func AuditEvents(filter AuditFilter, limit int) (events []AuditEvent, err error) {
+	where, args := filter.where()
+	query := "SELECT " + auditColumns + " FROM audit_events" + where + " ORDER BY id DESC"
+	if limit > 0 {
+		args = append(args, limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	// the emails come with the entries, the export reads the whole log at once
+	query = "SELECT e." + strings.ReplaceAll(auditColumns, ", ", ", e.") + ", coalesce(actor.email, ''), coalesce(about.email, '') FROM (" + query +
+		") e LEFT JOIN users actor ON actor.id = e.actor_id LEFT JOIN users about ON about.id = e.user_id ORDER BY e.id DESC"
+	rows, err := Db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := AuditEvent{}
+		err = rows.Scan(&event.Id, &event.Kind, &event.ActorId, &event.UserId, &event.Target, &event.IP, &event.RequestId,
+			&event.Detail, &event.CreatedAt, &event.PrevHash, &event.Hash, &event.ActorEmail, &event.UserEmail)
+		if err != nil {
+			return
+		}
+		events = append(events, event)
+	}
+	err = rows.Err()
+	return
+}
+
+// Check the hash chain of the whole log. Broken is the id of the first entry that was changed,
+// or that follows removed entries, and zero when the chain holds. Head is the hash of the last
+// entry, kept elsewhere it shows that no entries were cut from the end.
+func VerifyAuditChain() (count int, broken int, head string, err error) {
+	rows, err := Db.Query("SELECT " + auditColumns + " FROM audit_events ORDER BY id")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event := AuditEvent{}
+		if err = event.scan(rows); err != nil {
+			return
+		}
+		count++
+		if broken == 0 && (event.PrevHash != head || event.computeHash() != event.Hash) {
+			broken = event.Id
+		}
+		head = event.Hash
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// adds the entries and returns their ids
+func recordAudits(t *testing.T, count int) (ids []int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := RecordAudit(AuditLogin, Origin{ActorId: 1, IP: "127.0.0.1", RequestId: "r" + strconv.Itoa(i)}, 1, "session:"+strconv.Itoa(i), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := AuditEvents(AuditFilter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		ids = append(ids, events[i].Id)
+	}
+	return
+}
+
+func TestAuditChain(t *testing.T) {
+	setupDB(t)
+	ids := recordAudits(t, 5)
+	count, broken, head, err := VerifyAuditChain()
+	if err != nil || count != 5 || broken != 0 {
+		t.Fatalf("VerifyAuditChain = %d, %d, %v, want 5 entries and no break", count, broken, err)
+	}
+	events, _ := AuditEvents(AuditFilter{}, 1)
+	if head != events[0].Hash {
+		t.Errorf("head %s, want the hash of the last entry %s", head, events[0].Hash)
+	}
+
+	// the triggers keep the log append-only
+	tests := []struct {
+		name      string
+		statement string
+	}{
+		{"update", "update audit_events set detail = 'changed' where id = $1"},
+		{"delete", "delete from audit_events where id = $1"},
+	}
+	for _, test := range tests {
+		if _, err := Db.Exec(test.statement, ids[2]); err == nil {
+			t.Errorf("%s: allowed on the audit log", test.name)
+		}
+	}
+	if count, broken, _, _ := VerifyAuditChain(); count != 5 || broken != 0 {
+		t.Errorf("the refused changes went through: %d entries, broken at %d", count, broken)
+	}
+}
+
+// the chain shows what was changed once the triggers are dropped
+func TestAuditChainShowsTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		// changes the entries with the ids, returns the id the chain should break at
+		tamper func(ids []int) (statement string, broken int)
+	}{
+		{"changed detail", func(ids []int) (string, int) {
+			return "update audit_events set detail = 'changed' where id = " + strconv.Itoa(ids[2]), ids[2]
+		}},
+		{"changed actor", func(ids []int) (string, int) {
+			return "update audit_events set actor_id = 2 where id = " + strconv.Itoa(ids[0]), ids[0]
+		}},
+		{"removed entry", func(ids []int) (string, int) {
+			return "delete from audit_events where id = " + strconv.Itoa(ids[1]), ids[2]
+		}},
+		{"rehashed entry", func(ids []int) (string, int) {
+			// a new hash for the changed entry no longer matches the prev_hash of the next one
+			return "update audit_events set detail = 'changed', hash = 'forged' where id = " + strconv.Itoa(ids[1]), ids[1]
+		}},
+	}
+	for _, test := range tests {
+		setupDB(t)
+		ids := recordAudits(t, 4)
+		if _, err := Db.Exec("DROP TRIGGER audit_events_no_update; DROP TRIGGER audit_events_no_delete"); err != nil {
+			t.Fatal(err)
+		}
+		statement, want := test.tamper(ids)
+		if _, err := Db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+		if _, broken, _, err := VerifyAuditChain(); err != nil || broken != want {
+			t.Errorf("%s: broken at %d, %v, want %d", test.name, broken, err, want)
+		}
+	}
+}
+
+// servers sharing the database add entries at once, each one chains to the one before
+func TestAuditConcurrentWriters(t *testing.T) {
+	initDB("file:" + filepath.Join(t.TempDir(), "audit.db") + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)")
+	t.Cleanup(func() { Db.Close() })
+	Db.SetMaxOpenConns(8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := RecordAudit(AuditLogin, Origin{RequestId: strconv.Itoa(i)}, 0, "", ""); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count, broken, _, err := VerifyAuditChain(); err != nil || count != 40 || broken != 0 {
+		t.Errorf("VerifyAuditChain = %d, broken at %d, %v, want 40 entries and no break", count, broken, err)
+	}
+}
+
+// the entries come with the emails of their users, the filters still apply
+func TestAuditEventsEmails(t *testing.T) {
+	setupDB(t)
+	admin := createUserWithRole(t, "admin", RoleAdmin)
+	alice := createUser(t, "alice")
+	records := []struct {
+		kind   AuditKind
+		actor  int
+		userId int
+	}{
+		{AuditLoginFailed, 0, 0},
+		{AuditLogin, alice.Id, alice.Id},
+		{AuditUserBanned, admin.Id, alice.Id},
+	}
+	for _, record := range records {
+		if err := RecordAudit(record.kind, Origin{ActorId: record.actor}, record.userId, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		// the emails of the actor and of the user of each entry, the latest first
+		want [][2]string
+	}{
+		{"all", AuditFilter{}, [][2]string{{admin.Email, alice.Email}, {alice.Email, alice.Email}, {"", ""}}},
+		{"kind", AuditFilter{Kind: AuditLogin}, [][2]string{{alice.Email, alice.Email}}},
+		{"actor", AuditFilter{User: "@admin"}, [][2]string{{admin.Email, alice.Email}}},
+		{"since", AuditFilter{Since: time.Now().Add(-time.Hour)}, [][2]string{{admin.Email, alice.Email}, {alice.Email, alice.Email}, {"", ""}}},
+		{"until", AuditFilter{Until: time.Now().Add(-time.Hour)}, nil},
+	}
+	for _, test := range tests {
+		events, err := AuditEvents(test.filter, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got [][2]string
+		for _, event := range events {
+			got = append(got, [2]string{event.ActorEmail, event.UserEmail})
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+	if events, _ := AuditEvents(AuditFilter{}, 1); len(events) != 1 || events[0].Kind != AuditUserBanned {
+		t.Errorf("the limit gave %v", events)
+	}
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Category is a board grouping threads, boards can be nested one level below a parent
+type Category struct {
+	Id          int
+	Slug        string
+	Name        string
+	Description string
+	Position    int
+	ParentId    sql.NullInt64
+	// least privileged role allowed to read the board, empty means everyone
+	ReadRole Role
+	// least privileged role allowed to start threads and reply in the board
+	PostRole  Role
+	CreatedAt time.Time
+}
+
+const categoryColumns = "id, slug, name, description, position, parent_id, read_role, post_role, created_at"
+
+func (cat *Category) scan(row scanner) error {
+	return row.Scan(&cat.Id, &cat.Slug, &cat.Name, &cat.Description, &cat.Position, &cat.ParentId, &cat.ReadRole, &cat.PostRole, &cat.CreatedAt)
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// check if the user may see the board and its threads, a sub-board is never more open
+// than its parent. A parent that cannot be found denies.
+func (user *User) CanRead(cat Category) bool {
+	if cat.ReadRole != "" && !user.HasRole(cat.ReadRole) {
+		return false
+	}
+	if !cat.ParentId.Valid {
+		return true
+	}
+	parent, err := cat.Parent()
+	return err == nil && user.CanRead(parent)
+}
+
+// check if the user may start threads and reply in the board and in its parent, only
+// verified users post
+func (user *User) CanPost(cat Category) bool {
+	if user.Id == 0 || !user.IsVerified() || !user.CanRead(cat) || !user.HasRole(cat.PostRole) {
+		return false
+	}
+	if !cat.ParentId.Valid {
+		return true
+	}
+	parent, err := cat.Parent()
+	return err == nil && user.CanPost(parent)
+}
+
+// Create a new category
+func (cat *Category) Create() (err error) {
+	cat.Slug = strings.ToLower(strings.TrimSpace(cat.Slug))
+	if !slugPattern.MatchString(cat.Slug) {
+		return errors.New("the slug may only contain lowercase letters, digits and dashes")
+	}
+	if cat.PostRole == "" {
+		cat.PostRole = RoleMember
+	}
+	statement := "insert into categories (slug, name, description, position, parent_id, read_role, post_role, created_at) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id, created_at"
+	stmt, err := Db.Prepare(statement)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRow(cat.Slug, cat.Name, cat.Description, cat.Position, cat.ParentId, cat.ReadRole, cat.PostRole, time.Now()).
+		Scan(&cat.Id, &cat.CreatedAt)
+	return
+}
+
+// Create the default boards when there are none yet
+func SeedCategories() (err error) {
+	var count int
+	if err = Db.QueryRow("SELECT count(*) FROM categories").Scan(&count); err != nil || count > 0 {
+		return
+	}
+	defaults := []Category{
+		{Slug: "announcements", Name: "Announcements", Description: "News from the staff", Position: 0, PostRole: RoleModerator},
+		{Slug: "general", Name: "General", Description: "Talk about anything", Position: 1},
+		{Slug: "staff", Name: "Staff", Description: "Private board for moderators", Position: 2, ReadRole: RoleModerator, PostRole: RoleModerator},
+	}
+	for _, cat := range defaults {
+		if err = cat.Create(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Get all categories, parents and children ordered by position
+func Categories() (cats []Category, err error) {
+	rows, err := Db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY position, name")
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		cat := Category{}
+		if err = cat.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		cats = append(cats, cat)
+	}
+	rows.Close()
+	return
+}
+
+// Get a category by its slug
+func CategoryBySlug(slug string) (cat Category, err error) {
+	err = cat.scan(Db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE slug = $1", slug))
+	return
+}
+
+// Get a category by its id
+func CategoryById(id int) (cat Category, err error) {
+	err = cat.scan(Db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = $1", id))
+	return
+}
+
+// Get the categories the user is allowed to read
+func ReadableCategories(user User) (cats []Category, err error) {
+	all, err := Categories()
+	if err != nil {
+		return
+	}
+	for _, cat := range all {
+		if user.CanRead(cat) {
+			cats = append(cats, cat)
+		}
+	}
+	return
+}
+
+// Get the ids of the categories the user is allowed to read, to filter thread lists
+func ReadableCategoryIds(user User) (ids []int, err error) {
+	cats, err := ReadableCategories(user)
+	for _, cat := range cats {
+		ids = append(ids, cat.Id)
+	}
+	return
+}
+
+// Get the categories the user is allowed to start threads in
+func PostableCategories(user User) (cats []Category, err error) {
+	all, err := Categories()
+	if err != nil {
+		return
+	}
+	for _, cat := range all {
+		if user.CanPost(cat) {
+			cats = append(cats, cat)
+		}
+	}
+	return
+}
+
+// Get the category the thread was started in
+func (thread *Thread) Category() (cat Category, err error) {
+	return CategoryById(thread.CategoryId)
+}
+
+// Get the parent board, err is sql.ErrNoRows for top level boards
+func (cat *Category) Parent() (parent Category, err error) {
+	if !cat.ParentId.Valid {
+		err = sql.ErrNoRows
+		return
+	}
+	return CategoryById(int(cat.ParentId.Int64))
+}
+
+// CategorySummary is a board with its counters and latest activity for the front page
+type CategorySummary struct {
+	Category
+	NumThreads int
+	NumPosts   int
+	// the thread with the latest activity, a new thread or a reply
+	LastThread Thread
+	LastActive time.Time
+	Children   []Category
+}
+
+func (summary *CategorySummary) LastActiveDate() string {
+	return summary.LastActive.Format("Jan 2, 2006 at 3:04pm")
+}
+
+func (summary *CategorySummary) HasActivity() bool {
+	return !summary.LastActive.IsZero()
+}
+
+// Get the top level boards readable by the user with their counters and latest activity
+func CategorySummaries(user User) (summaries []CategorySummary, err error) {
+	cats, err := ReadableCategories(user)
+	if err != nil {
+		return
+	}
+	children := map[int64][]Category{}
+	for _, cat := range cats {
+		if cat.ParentId.Valid {
+			children[cat.ParentId.Int64] = append(children[cat.ParentId.Int64], cat)
+		}
+	}
+	for _, cat := range cats {
+		if cat.ParentId.Valid {
+			continue
+		}
+		summary := CategorySummary{Category: cat, Children: children[int64(cat.Id)]}
+		if err = summary.load(); err != nil {
+			return
+		}
+		summaries = append(summaries, summary)
+	}
+	return
+}
+
+func (summary *CategorySummary) load() (err error) {
+	id := summary.Id
+	// only what the board lists is counted, as in the latest activity below
+	err = Db.QueryRow("SELECT count(*) FROM threads WHERE category_id = $1 AND deleted_at IS NULL AND hidden_at IS NULL", id).Scan(&summary.NumThreads)
+	if err != nil {
+		return
+	}
+	err = Db.QueryRow("SELECT count(*) FROM posts JOIN threads ON posts.thread_id = threads.id WHERE threads.category_id = $1 AND threads.deleted_at IS NULL AND threads.hidden_at IS NULL AND posts.deleted_at IS NULL AND posts.hidden_at IS NULL", id).
+		Scan(&summary.NumPosts)
+	if err != nil {
+		return
+	}
+	// the newest thread and the newest reply, whichever came last
+	var thread Thread
+	err = thread.scan(Db.QueryRow("SELECT "+threadColumns+" FROM threads WHERE category_id = $1 AND deleted_at IS NULL AND hidden_at IS NULL ORDER BY created_at DESC LIMIT 1", id))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	summary.LastThread, summary.LastActive = thread, thread.CreatedAt
+	var post Post
+	err = post.scan(Db.QueryRow("SELECT "+qualified("posts", postColumns)+" FROM posts JOIN threads ON posts.thread_id = threads.id WHERE threads.category_id = $1 AND threads.deleted_at IS NULL AND threads.hidden_at IS NULL AND posts.deleted_at IS NULL AND posts.hidden_at IS NULL ORDER BY posts.created_at DESC LIMIT 1", id))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	if post.CreatedAt.After(summary.LastActive) {
+		summary.LastActive = post.CreatedAt
+		summary.LastThread, err = post.Thread()
+	}
+	return
+}
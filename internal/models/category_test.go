@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func createCategory(t *testing.T, cat Category) Category {
+	t.Helper()
+	if err := cat.Create(); err != nil {
+		t.Fatal(err)
+	}
+	return cat
+}
+
+func TestSubBoardsInheritTheirParentRoles(t *testing.T) {
+	setupDB(t)
+	staff := createCategory(t, Category{Slug: "staff-room", Name: "Staff", ReadRole: RoleModerator, PostRole: RoleModerator})
+	news := createCategory(t, Category{Slug: "news", Name: "News", PostRole: RoleModerator})
+	// the children leave their own roles open
+	staffChild := createCategory(t, Category{Slug: "staff-child", Name: "Staff child", ParentId: sql.NullInt64{Int64: int64(staff.Id), Valid: true}})
+	newsChild := createCategory(t, Category{Slug: "news-child", Name: "News child", ParentId: sql.NullInt64{Int64: int64(news.Id), Valid: true}})
+	orphan := Category{Slug: "orphan", Name: "Orphan", PostRole: RoleMember, ParentId: sql.NullInt64{Int64: 9999, Valid: true}}
+
+	guest := User{}
+	member := createUser(t, "member")
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+
+	tests := []struct {
+		name    string
+		user    User
+		cat     Category
+		canRead bool
+		canPost bool
+	}{
+		{"guest, child of staff", guest, staffChild, false, false},
+		{"member, child of staff", member, staffChild, false, false},
+		{"moderator, child of staff", moderator, staffChild, true, true},
+		{"guest, child of news", guest, newsChild, true, false},
+		{"member, child of news", member, newsChild, true, false},
+		{"moderator, child of news", moderator, newsChild, true, true},
+		{"member, news", member, news, true, false},
+		{"moderator, missing parent", moderator, orphan, false, false},
+	}
+	for _, test := range tests {
+		if got := test.user.CanRead(test.cat); got != test.canRead {
+			t.Errorf("%s: CanRead = %v, want %v", test.name, got, test.canRead)
+		}
+		if got := test.user.CanPost(test.cat); got != test.canPost {
+			t.Errorf("%s: CanPost = %v, want %v", test.name, got, test.canPost)
+		}
+	}
+
+	ids, err := ReadableCategoryIds(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if id == staffChild.Id {
+			t.Error("the child of the staff board is listed for members")
+		}
+	}
+}
+
+// the counters of a board leave out what it does not list
+func TestCategorySummaryCountsVisibleContent(t *testing.T) {
+	setupDB(t)
+	board := createCategory(t, Category{Slug: "board", Name: "Board"})
+	author := createUser(t, "author")
+	thread := func(topic string, hold Hold) Thread {
+		t.Helper()
+		thread, err := author.CreateThread(board, topic, hold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return thread
+	}
+	post := func(thread Thread, body string, hold Hold) Post {
+		t.Helper()
+		post, err := author.CreatePost(thread, body, hold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	held := Hold{Held: true, Score: 1}
+
+	visible := thread("visible", Hold{})
+	post(visible, "visible", Hold{})
+	post(visible, "held", held)
+	deletedPost := post(visible, "deleted", Hold{})
+	if err := deletedPost.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	hiddenPost := post(visible, "hidden", Hold{})
+	Db.Exec("update posts set hidden_at = current_timestamp, hidden_reason = $2 where id = $1", hiddenPost.Id, HiddenByModerator)
+
+	// the posts of threads the board does not list are not counted either
+	post(thread("held", held), "in a held thread", Hold{})
+	hidden := thread("hidden", Hold{})
+	post(hidden, "in a hidden thread", Hold{})
+	Db.Exec("update threads set hidden_at = current_timestamp, hidden_reason = $2 where id = $1", hidden.Id, HiddenByModerator)
+	deleted := thread("deleted", Hold{})
+	post(deleted, "in a deleted thread", Hold{})
+	if err := deleted.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := CategorySummaries(createUser(t, "reader"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, summary := range summaries {
+		if summary.Id != board.Id {
+			continue
+		}
+		if summary.NumThreads != 1 || summary.NumPosts != 1 {
+			t.Errorf("%d threads and %d posts counted, want 1 and 1", summary.NumThreads, summary.NumPosts)
+		}
+		if summary.LastThread.Id != visible.Id {
+			t.Errorf("latest thread %q, want the visible one", summary.LastThread.Topic)
+		}
+		return
+	}
+	t.Fatal("the board is not listed")
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"crypto/rand"
 	"crypto/sha1"
+	"encoding/base64"
 	"fmt"
 	"time"
 
@@ -16,11 +17,23 @@ import (
 var Db *sqlx.DB // *sql.DB
 
 func InitDB() {
+	initDB(":memory:")
+}
+
+// open the database and create what is missing, the tests open files shared by several
+// connections to run transactions at once
+func initDB(dataSource string) {
 	var err error
-	Db, err = sqlx.Open("sqlite", ":memory:") // sql.Open("postgres", "dbname=chitchat sslmode=disable")
+	Db, err = sqlx.Open("sqlite", dataSource) // sql.Open("postgres", "dbname=chitchat sslmode=disable")
 	if err != nil {
 		log.Fatal(err)
 	}
+	// each connection to :memory: opens its own empty database, so the pool keeps a single
+	// one: a query waits for the transaction holding it instead of finding no tables. Inside
+	// a transaction only use the tx, a query on Db would wait for it forever.
+	if dataSource == ":memory:" {
+		Db.SetMaxOpenConns(1)
+	}
 
 	// create the threads table
 	_, err = Db.Exec(`
@@ -28,9 +41,22 @@ func InitDB() {
             id         INTEGER PRIMARY KEY AUTOINCREMENT,
             uuid       VARCHAR(64) NOT NULL UNIQUE,
             name       VARCHAR(255),
+            handle     VARCHAR(32) NOT NULL UNIQUE,
             email      VARCHAR(255) NOT NULL UNIQUE,
             password   VARCHAR(255) NOT NULL,
-            created_at TIMESTAMP NOT NULL
+            role       VARCHAR(32) NOT NULL DEFAULT 'member',
+            created_at TIMESTAMP NOT NULL,
+            read_all_at TIMESTAMP,
+            email_verified_at TIMESTAMP,
+            bio        TEXT NOT NULL DEFAULT '',
+            avatar_key VARCHAR(255) NOT NULL DEFAULT '',
+            timezone   VARCHAR(64) NOT NULL DEFAULT '',
+            deletion_requested_at TIMESTAMP,
+            deletion_mode VARCHAR(16) NOT NULL DEFAULT '',
+            deleted_at TIMESTAMP,
+            suspended_until TIMESTAMP,
+            banned_at  TIMESTAMP,
+            sanction_reason TEXT NOT NULL DEFAULT ''
         );
     `)
 	if err != nil {
@@ -43,7 +69,30 @@ func InitDB() {
             uuid       VARCHAR(64) NOT NULL UNIQUE,
             email      VARCHAR(255),
             user_id    INTEGER REFERENCES users(id),
-            created_at TIMESTAMP NOT NULL
+            created_at TIMESTAMP NOT NULL,
+            partial    BOOLEAN NOT NULL DEFAULT false,
+            user_agent TEXT NOT NULL DEFAULT '',
+            ip         VARCHAR(64) NOT NULL DEFAULT '',
+            last_seen_at TIMESTAMP NOT NULL,
+            csrf_token VARCHAR(64) NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS categories (
+            id          INTEGER PRIMARY KEY AUTOINCREMENT,
+            slug        VARCHAR(64) NOT NULL UNIQUE,
+            name        VARCHAR(255) NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            position    INTEGER NOT NULL DEFAULT 0,
+            parent_id   INTEGER REFERENCES categories(id),
+            read_role   VARCHAR(32) NOT NULL DEFAULT '',
+            post_role   VARCHAR(32) NOT NULL DEFAULT 'member',
+            created_at  TIMESTAMP NOT NULL
         );
     `)
 	if err != nil {
@@ -52,26 +101,416 @@ func InitDB() {
 
 	_, err = Db.Exec(`
         CREATE TABLE IF NOT EXISTS threads (
+            id          INTEGER PRIMARY KEY AUTOINCREMENT,
+            uuid        VARCHAR(64) NOT NULL UNIQUE,
+            topic       TEXT,
+            user_id     INTEGER REFERENCES users(id),
+            category_id INTEGER NOT NULL REFERENCES categories(id),
+            created_at  TIMESTAMP NOT NULL,
+            edited_at   TIMESTAMP,
+            deleted_at  TIMESTAMP,
+            pinned_at   TIMESTAMP,
+            locked_at   TIMESTAMP,
+            archived_at TIMESTAMP,
+            hidden_at   TIMESTAMP,
+            hidden_reason VARCHAR(16) NOT NULL DEFAULT '',
+            held_at     TIMESTAMP,
+            last_post_at TIMESTAMP NOT NULL,
+            num_posts   INTEGER NOT NULL DEFAULT 0,
+            hot_score   REAL NOT NULL DEFAULT 0
+        );
+        CREATE INDEX IF NOT EXISTS threads_category_id ON threads (category_id, created_at);
+        CREATE INDEX IF NOT EXISTS threads_created_at ON threads (created_at);
+        CREATE INDEX IF NOT EXISTS threads_last_post_at ON threads (last_post_at);
+        CREATE INDEX IF NOT EXISTS threads_category_last_post_at ON threads (category_id, last_post_at);
+        CREATE INDEX IF NOT EXISTS threads_num_posts ON threads (num_posts, last_post_at);
+        CREATE INDEX IF NOT EXISTS threads_category_num_posts ON threads (category_id, num_posts, last_post_at);
+        CREATE INDEX IF NOT EXISTS threads_hot_score ON threads (hot_score);
+        CREATE INDEX IF NOT EXISTS threads_category_hot_score ON threads (category_id, hot_score);
+        CREATE INDEX IF NOT EXISTS threads_pinned_at ON threads (pinned_at) WHERE pinned_at IS NOT NULL;
+        CREATE INDEX IF NOT EXISTS threads_category_pinned_at ON threads (category_id, pinned_at) WHERE pinned_at IS NOT NULL;
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS posts (
             id         INTEGER PRIMARY KEY AUTOINCREMENT,
             uuid       VARCHAR(64) NOT NULL UNIQUE,
-            topic      TEXT,
+            body       TEXT,
             user_id    INTEGER REFERENCES users(id),
-            created_at TIMESTAMP NOT NULL
+            thread_id  INTEGER REFERENCES threads(id),
+            created_at TIMESTAMP NOT NULL,
+            edited_at  TIMESTAMP,
+            deleted_at TIMESTAMP,
+            hidden_at  TIMESTAMP,
+            hidden_reason VARCHAR(16) NOT NULL DEFAULT '',
+            held_at    TIMESTAMP
         );
+        CREATE INDEX IF NOT EXISTS posts_thread_id ON posts (thread_id, id);
     `)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	_, err = Db.Exec(`
-        CREATE TABLE IF NOT EXISTS posts (
+        CREATE TABLE IF NOT EXISTS attachments (
+            id           INTEGER PRIMARY KEY AUTOINCREMENT,
+            uuid         VARCHAR(64) NOT NULL UNIQUE,
+            post_id      INTEGER REFERENCES posts(id),
+            user_id      INTEGER REFERENCES users(id),
+            filename     VARCHAR(255) NOT NULL,
+            content_type VARCHAR(255) NOT NULL,
+            size         INTEGER NOT NULL,
+            storage_key  VARCHAR(255) NOT NULL,
+            thumb_key    VARCHAR(255) NOT NULL DEFAULT '',
+            created_at   TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS attachments_post_id ON attachments (post_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS post_revisions (
             id         INTEGER PRIMARY KEY AUTOINCREMENT,
-            uuid       VARCHAR(64) NOT NULL UNIQUE,
+            post_id    INTEGER REFERENCES posts(id),
             body       TEXT,
+            body_html  TEXT,
             user_id    INTEGER REFERENCES users(id),
+            created_at TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS post_revisions_post_id ON post_revisions (post_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS thread_revisions (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
             thread_id  INTEGER REFERENCES threads(id),
+            topic      TEXT,
+            user_id    INTEGER REFERENCES users(id),
             created_at TIMESTAMP NOT NULL
         );
+        CREATE INDEX IF NOT EXISTS thread_revisions_thread_id ON thread_revisions (thread_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS tags (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            name       VARCHAR(32) NOT NULL UNIQUE,
+            created_at TIMESTAMP NOT NULL
+        );
+        CREATE TABLE IF NOT EXISTS thread_tags (
+            thread_id  INTEGER NOT NULL REFERENCES threads(id),
+            tag_id     INTEGER NOT NULL REFERENCES tags(id),
+            PRIMARY KEY (thread_id, tag_id)
+        );
+        CREATE INDEX IF NOT EXISTS thread_tags_tag_id ON thread_tags (tag_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS thread_state_changes (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            thread_id  INTEGER NOT NULL REFERENCES threads(id),
+            state      VARCHAR(32) NOT NULL,
+            enabled    BOOLEAN NOT NULL,
+            user_id    INTEGER REFERENCES users(id),
+            created_at TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS thread_state_changes_thread_id ON thread_state_changes (thread_id, state);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS thread_reads (
+            user_id           INTEGER NOT NULL REFERENCES users(id),
+            thread_id         INTEGER NOT NULL REFERENCES threads(id),
+            last_read_post_id INTEGER NOT NULL DEFAULT 0,
+            read_at           TIMESTAMP NOT NULL,
+            PRIMARY KEY (user_id, thread_id)
+        );
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS thread_subscriptions (
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            thread_id  INTEGER NOT NULL REFERENCES threads(id),
+            created_at TIMESTAMP NOT NULL,
+            PRIMARY KEY (user_id, thread_id)
+        );
+        CREATE INDEX IF NOT EXISTS thread_subscriptions_thread_id ON thread_subscriptions (thread_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS post_mentions (
+            post_id    INTEGER NOT NULL REFERENCES posts(id),
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            handle     VARCHAR(32) NOT NULL,
+            notified   BOOLEAN NOT NULL,
+            PRIMARY KEY (post_id, handle)
+        );
+        CREATE INDEX IF NOT EXISTS post_mentions_user_id ON post_mentions (user_id);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS notifications (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            kind       VARCHAR(32) NOT NULL,
+            thread_id  INTEGER NOT NULL REFERENCES threads(id),
+            post_id    INTEGER NOT NULL REFERENCES posts(id),
+            actor_id   INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMP NOT NULL,
+            read_at    TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS notifications_user_id ON notifications (user_id, created_at);
+        CREATE INDEX IF NOT EXISTS notifications_unread ON notifications (user_id, read_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS notification_preferences (
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            kind       VARCHAR(32) NOT NULL,
+            enabled    BOOLEAN NOT NULL,
+            PRIMARY KEY (user_id, kind)
+        );
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS outbox (
+            id              INTEGER PRIMARY KEY AUTOINCREMENT,
+            to_addr         VARCHAR(255) NOT NULL,
+            subject         VARCHAR(255) NOT NULL,
+            text_body       TEXT NOT NULL,
+            html_body       TEXT NOT NULL,
+            attempts        INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at TIMESTAMP NOT NULL,
+            last_error      TEXT,
+            sent_at         TIMESTAMP,
+            created_at      TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (sent_at, next_attempt_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS password_resets (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            token_hash VARCHAR(64) NOT NULL UNIQUE,
+            created_at TIMESTAMP NOT NULL,
+            expires_at TIMESTAMP NOT NULL,
+            used_at    TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS password_resets_user_id ON password_resets (user_id, created_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS email_verifications (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            email      VARCHAR(255) NOT NULL,
+            token_hash VARCHAR(64) NOT NULL UNIQUE,
+            created_at TIMESTAMP NOT NULL,
+            expires_at TIMESTAMP NOT NULL,
+            used_at    TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS email_verifications_user_id ON email_verifications (user_id, created_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_totp (
+            user_id      INTEGER PRIMARY KEY REFERENCES users(id),
+            secret       VARCHAR(64) NOT NULL,
+            last_step    INTEGER,
+            created_at   TIMESTAMP NOT NULL,
+            confirmed_at TIMESTAMP
+        );
+        CREATE TABLE IF NOT EXISTS recovery_codes (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            code_hash  VARCHAR(64) NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            used_at    TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS recovery_codes_user_id ON recovery_codes (user_id, code_hash);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_identities (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id    INTEGER NOT NULL REFERENCES users(id),
+            provider   VARCHAR(64) NOT NULL,
+            subject    VARCHAR(255) NOT NULL,
+            email      VARCHAR(255) NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            UNIQUE (provider, subject)
+        );
+        CREATE INDEX IF NOT EXISTS user_identities_user_id ON user_identities (user_id);
+        CREATE TABLE IF NOT EXISTS login_attempts (
+            state_hash   VARCHAR(64) PRIMARY KEY,
+            provider     VARCHAR(64) NOT NULL,
+            nonce        VARCHAR(64) NOT NULL,
+            verifier     VARCHAR(64) NOT NULL,
+            link_user_id INTEGER REFERENCES users(id),
+            created_at   TIMESTAMP NOT NULL
+        );
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS rate_limits (
+            key          VARCHAR(255) PRIMARY KEY,
+            tokens       REAL NOT NULL,
+            updated_unix REAL NOT NULL,
+            expires_at   TIMESTAMP NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS rate_limits_expires_at ON rate_limits (expires_at);
+        CREATE TABLE IF NOT EXISTS login_failures (
+            email          VARCHAR(255) PRIMARY KEY,
+            failures       INTEGER NOT NULL,
+            last_failed_at TIMESTAMP NOT NULL,
+            locked_until   TIMESTAMP
+        );
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS audit_events (
+            id         INTEGER PRIMARY KEY AUTOINCREMENT,
+            kind       VARCHAR(64) NOT NULL,
+            actor_id   INTEGER REFERENCES users(id),
+            user_id    INTEGER REFERENCES users(id),
+            target     VARCHAR(255) NOT NULL,
+            ip         VARCHAR(64) NOT NULL,
+            request_id VARCHAR(64) NOT NULL,
+            detail     TEXT NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            prev_hash  VARCHAR(64) NOT NULL,
+            hash       VARCHAR(64) NOT NULL UNIQUE
+        );
+        CREATE TABLE IF NOT EXISTS audit_lock (
+            id        INTEGER PRIMARY KEY,
+            locked_at TIMESTAMP
+        );
+        INSERT INTO audit_lock (id) VALUES (1) ON CONFLICT DO NOTHING;
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the audit log is append-only. SQLite has these two triggers, Postgres has the
+	// audit_events_append_only trigger of setup.sql refusing both. Neither stops the owner of
+	// the database from dropping them, or a TRUNCATE on Postgres which fires no row triggers,
+	// the hash chain shows what was changed that way.
+	_, err = Db.Exec(`
+        CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+        BEGIN
+            SELECT RAISE(ABORT, 'audit_events is append-only');
+        END;
+        CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+        BEGIN
+            SELECT RAISE(ABORT, 'audit_events is append-only');
+        END;
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS reports (
+            id          INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id     INTEGER NOT NULL REFERENCES users(id),
+            target_kind VARCHAR(16) NOT NULL,
+            target_id   INTEGER NOT NULL,
+            reason      VARCHAR(32) NOT NULL,
+            detail      TEXT NOT NULL DEFAULT '',
+            created_at  TIMESTAMP NOT NULL,
+            resolved_at TIMESTAMP,
+            resolved_by INTEGER REFERENCES users(id),
+            resolution  VARCHAR(16) NOT NULL DEFAULT '',
+            note        TEXT NOT NULL DEFAULT ''
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS reports_open ON reports (user_id, target_kind, target_id) WHERE resolved_at IS NULL;
+        CREATE INDEX IF NOT EXISTS reports_target ON reports (target_kind, target_id);
+        CREATE INDEX IF NOT EXISTS reports_resolved_at ON reports (resolved_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS spam_holds (
+            id          INTEGER PRIMARY KEY AUTOINCREMENT,
+            target_kind VARCHAR(16) NOT NULL,
+            target_id   INTEGER NOT NULL,
+            score       REAL NOT NULL,
+            reasons     TEXT NOT NULL,
+            created_at  TIMESTAMP NOT NULL,
+            reviewed_at TIMESTAMP,
+            reviewed_by INTEGER REFERENCES users(id),
+            decision    VARCHAR(16) NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS spam_holds_target ON spam_holds (target_kind, target_id);
+        CREATE INDEX IF NOT EXISTS spam_holds_reviewed_at ON spam_holds (reviewed_at);
+    `)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = Db.Exec(`
+        CREATE TABLE IF NOT EXISTS spam_tokens (
+            token VARCHAR(128) PRIMARY KEY,
+            spam  INTEGER NOT NULL DEFAULT 0,
+            ham   INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE TABLE IF NOT EXISTS spam_documents (
+            class VARCHAR(8) PRIMARY KEY,
+            count INTEGER NOT NULL DEFAULT 0
+        );
     `)
 	if err != nil {
 		log.Fatal(err)
@@ -96,6 +535,15 @@ func createUUID() (uuid string) {
 	return uuid
 }
 
+// create a random token for links, 256 bits encoded for URLs
+func createToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 // hash plaintext with SHA-1
 func Encrypt(plaintext string) (cryptext string) {
 	cryptext = fmt.Sprintf("%x", sha1.Sum([]byte(plaintext)))
@@ -107,20 +555,26 @@ func InsertInitialDB() {
 
 	// Insert initial data
 	_, err = Db.Exec(`
-        INSERT INTO users (uuid, name, email, password, created_at) VALUES (?, ?, ?, ?, ?)
-    `, createUUID(), "taewony", "taewony@gmail.com", Encrypt("password123"), time.Now())
+        INSERT INTO users (uuid, name, handle, email, password, created_at) VALUES (?, ?, ?, ?, ?, ?)
+    `, createUUID(), "taewony", "taewony", "taewony@gmail.com", Encrypt("password123"), time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = Db.Exec(`
+        INSERT INTO sessions (uuid, email, user_id, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?)
+    `, createUUID(), "taewony@gmail.com", 1, time.Now(), time.Now()) // Assuming user_id is 1
 	if err != nil {
 		log.Fatal(err)
 	}
 	_, err = Db.Exec(`
-        INSERT INTO sessions (uuid, email, user_id, created_at) VALUES (?, ?, ?, ?)
-    `, createUUID(), "taewony@gmail.com", 1, time.Now()) // Assuming user_id is 1
+        INSERT INTO categories (slug, name, created_at) VALUES (?, ?, ?)
+    `, "general", "General", time.Now())
 	if err != nil {
 		log.Fatal(err)
 	}
 	_, err = Db.Exec(`
-        INSERT INTO threads (uuid, topic, user_id, created_at) VALUES (?, ?, ?, ?)
-    `, createUUID(), "Sample Thread", 1, time.Now()) // Assuming user_id is 1
+        INSERT INTO threads (uuid, topic, user_id, category_id, created_at, last_post_at, num_posts) VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, createUUID(), "Sample Thread", 1, 1, time.Now(), time.Now(), 1) // Assuming user_id is 1 and category_id is 1
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// a fresh in-memory database for the test
+func setupDB(t *testing.T) {
+	t.Helper()
+	InitDB()
+	t.Cleanup(func() { Db.Close() })
+}
+
+// a user with a verified email, named after the handle
+func createUser(t *testing.T, handle string) User {
+	t.Helper()
+	user := User{Name: handle, Handle: handle, Email: handle + "@example.com", Password: "password"}
+	if err := user.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Db.Exec("update users set email_verified_at = $2 where id = $1", user.Id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	user, err := UserById(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// a user with a verified email and the role
+func createUserWithRole(t *testing.T, handle string, role Role) User {
+	t.Helper()
+	user := createUser(t, handle)
+	if err := user.SetRole(role); err != nil {
+		t.Fatal(err)
+	}
+	user.Role = role
+	return user
+}
+
+func TestQueryWhileTransactionIsOpen(t *testing.T) {
+	setupDB(t)
+	tx, err := Db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("insert into thread_revisions (thread_id, topic, user_id, created_at) values ($1, $2, $3, $4)",
+		1, "Sample Thread", 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// other requests query while one holds a transaction
+	done := make(chan error)
+	var count int
+	go func() {
+		done <- Db.QueryRow("SELECT count(*) FROM thread_revisions").Scan(&count)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("query did not wait for the transaction: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+}
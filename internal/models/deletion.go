@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DeletionMode is what happens to the threads and posts of a deleted account
+type DeletionMode string
+
+const (
+	// the content stays, credited to "Deleted user"
+	DeleteAnonymize DeletionMode = "anonymize"
+	// the content is erased too, threads and posts leave tombstones
+	DeleteRemove DeletionMode = "remove"
+)
+
+// how long a deletion can be cancelled, the account is purged after it
+var AccountDeletionGrace = 14 * 24 * time.Hour
+
+// the name deleted accounts are shown with
+const DeletedUserName = "Deleted user"
+
+var (
+	ErrInvalidDeletionMode = errors.New("please choose what happens to your threads and posts")
+	ErrNoDeletionPending   = errors.New("no deletion of the account is pending")
+)
+
+func (user *User) IsDeleted() bool {
+	return user.DeletedAt.Valid
+}
+
+// check if the account is waiting to be purged
+func (user *User) DeletionPending() bool {
+	return user.DeletionRequestedAt.Valid && !user.IsDeleted()
+}
+
+// when the account is purged, once the grace period of the request is over
+func (user *User) DeletionDueAt() time.Time {
+	return user.DeletionRequestedAt.Time.Add(AccountDeletionGrace)
+}
+
+// Ask to delete the account, it can be cancelled until the grace period is over
+func (user *User) RequestDeletion(mode DeletionMode) (err error) {
+	if mode != DeleteAnonymize && mode != DeleteRemove {
+		return ErrInvalidDeletionMode
+	}
+	now := time.Now()
+	if _, err = Db.Exec("update users set deletion_requested_at = $2, deletion_mode = $3 where id = $1", user.Id, now, mode); err != nil {
+		return
+	}
+	user.DeletionRequestedAt = sql.NullTime{Time: now, Valid: true}
+	user.DeletionMode = mode
+	return
+}
+
+// Keep the account after all
+func (user *User) CancelDeletion() (err error) {
+	if !user.DeletionPending() {
+		return ErrNoDeletionPending
+	}
+	if _, err = Db.Exec("update users set deletion_requested_at = NULL, deletion_mode = '' where id = $1", user.Id); err != nil {
+		return
+	}
+	user.DeletionRequestedAt = sql.NullTime{}
+	user.DeletionMode = ""
+	return
+}
+
+// Get the accounts whose grace period is over
+func AccountsDueForPurge() (users []User, err error) {
+	rows, err := Db.Query("SELECT "+userColumns+" FROM users WHERE deletion_requested_at < $1 AND deleted_at IS NULL",
+		time.Now().Add(-AccountDeletionGrace))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := User{}
+		if err = user.scan(rows); err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// PurgeAccount erases the personal data of the user. The row stays with a made up name, handle
+// and email so threads, posts and notifications keep pointing at a user, the handle has a dash
+// no one can choose or mention. In the remove mode the threads and posts are blanked as well.
+// The storage keys returned are the files to delete, the avatar and the attachments of removed
+// posts, the storage is not part of the transaction.
+func PurgeAccount(user User) (keys []string, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if user.AvatarKey != "" {
+		keys = append(keys, user.AvatarKey)
+	}
+	if user.DeletionMode == DeleteRemove {
+		var files []string
+		if files, err = removeContent(tx, user.Id, now); err != nil {
+			return
+		}
+		keys = append(keys, files...)
+	}
+	// what only made sense for the user
+	for _, table := range []string{"sessions", "password_resets", "email_verifications", "user_totp", "recovery_codes",
+		"user_identities", "thread_reads", "thread_subscriptions", "notification_preferences", "notifications"} {
+		if _, err = tx.Exec("delete from "+table+" where user_id = $1", user.Id); err != nil {
+			return
+		}
+	}
+	if _, err = tx.Exec("delete from login_attempts where link_user_id = $1", user.Id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from login_failures where email = $1", user.Email); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from outbox where to_addr = $1 and sent_at is null", user.Email); err != nil {
+		return
+	}
+	id := strconv.Itoa(user.Id)
+	_, err = tx.Exec(`update users set name = $2, handle = $3, email = $4, password = $5, role = $6, bio = '', avatar_key = '',
+		timezone = '', email_verified_at = NULL, deleted_at = $7 where id = $1`,
+		user.Id, DeletedUserName, "deleted-"+id, "deleted-"+user.Uuid+"@deleted.invalid", Encrypt(createToken()), RoleMember, now)
+	if err != nil {
+		return
+	}
+	err = commitAudit(tx, AuditAccountDeleted, Origin{}, user.Id, "", string(user.DeletionMode))
+	return
+}
+
+// blank the threads and posts of the user with their history, and drop their attachments
+func removeContent(tx *sql.Tx, userId int, now time.Time) (keys []string, err error) {
+	rows, err := tx.Query(`SELECT storage_key, thumb_key FROM attachments WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)`, userId)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var key, thumb string
+		if err = rows.Scan(&key, &thumb); err != nil {
+			rows.Close()
+			return
+		}
+		keys = append(keys, key)
+		if thumb != "" {
+			keys = append(keys, thumb)
+		}
+	}
+	rows.Close()
+	for _, statement := range []string{
+		"delete from attachments where post_id in (select id from posts where user_id = $1)",
+		"delete from post_revisions where post_id in (select id from posts where user_id = $1)",
+		"delete from post_mentions where post_id in (select id from posts where user_id = $1)",
+		"delete from thread_revisions where thread_id in (select id from threads where user_id = $1)",
+	} {
+		if _, err = tx.Exec(statement, userId); err != nil {
+			return
+		}
+	}
+	if _, err = tx.Exec("update posts set body = '', deleted_at = coalesce(deleted_at, $2) where user_id = $1", userId, now); err != nil {
+		return
+	}
+	var threadIds []int
+	rows, err = tx.Query("SELECT DISTINCT thread_id FROM posts WHERE user_id = $1", userId)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var threadId int
+		if err = rows.Scan(&threadId); err != nil {
+			rows.Close()
+			return
+		}
+		threadIds = append(threadIds, threadId)
+	}
+	rows.Close()
+	for _, threadId := range threadIds {
+		if err = recountPosts(tx, threadId); err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec("update threads set topic = '', deleted_at = coalesce(deleted_at, $2) where user_id = $1", userId, now)
+	return
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAccountsDueForPurge(t *testing.T) {
+	setupDB(t)
+	cutoff := time.Now().Add(-AccountDeletionGrace)
+
+	tests := []struct {
+		handle string
+		// when the deletion was asked, zero when it was not
+		requested time.Time
+		due       bool
+	}{
+		{"kept", time.Time{}, false},
+		{"asked", time.Now(), false},
+		{"asked within the grace", cutoff.Add(time.Minute), false},
+		{"asked before the grace", cutoff.Add(-time.Minute), true},
+	}
+	for i, test := range tests {
+		user := createUser(t, "user_"+string(rune('a'+i)))
+		if !test.requested.IsZero() {
+			if _, err := Db.Exec("update users set deletion_requested_at = $2, deletion_mode = $3 where id = $1", user.Id, test.requested, DeleteAnonymize); err != nil {
+				t.Fatal(err)
+			}
+		}
+		users, err := AccountsDueForPurge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		due := slices.ContainsFunc(users, func(due User) bool { return due.Id == user.Id })
+		if due != test.due {
+			t.Errorf("%s: due %v, want %v", test.handle, due, test.due)
+		}
+		if test.due {
+			if _, err := PurgeAccount(users[0]); err != nil {
+				t.Fatal(err)
+			}
+			// a purged account is not purged again
+			if users, _ := AccountsDueForPurge(); len(users) != 0 {
+				t.Errorf("%s: still due after the purge", test.handle)
+			}
+		}
+	}
+}
+
+func TestPurgeAccount(t *testing.T) {
+	setupDB(t)
+	tests := []struct {
+		mode DeletionMode
+		// the content of the user is blanked
+		removed bool
+		keys    []string
+	}{
+		{DeleteAnonymize, false, []string{"avatars/anonymize"}},
+		{DeleteRemove, true, []string{"avatars/remove", "attachments/remove", "attachments/remove_thumb"}},
+	}
+	for _, test := range tests {
+		mode := string(test.mode)
+		leaving, other := createUser(t, mode), createUser(t, mode+"_other")
+		own, err := leaving.CreateThread(Category{Id: 1}, "Own thread", Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		others, err := other.CreateThread(Category{Id: 1}, "Other thread", Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := leaving.CreatePost(others, "A reply", Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.CreatePost(others, "Another reply", Hold{}); err != nil {
+			t.Fatal(err)
+		}
+		att := Attachment{Uuid: NewAttachmentUUID(), PostId: reply.Id, UserId: leaving.Id, Filename: "file.png",
+			ContentType: "image/png", StorageKey: "attachments/" + mode, ThumbKey: "attachments/" + mode + "_thumb"}
+		if err := att.Create(); err != nil {
+			t.Fatal(err)
+		}
+		if err := leaving.SetAvatar("avatars/" + mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := leaving.RequestDeletion(test.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, err := PurgeAccount(leaving)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, test.keys) {
+			t.Errorf("%s: storage keys %v, want %v", test.mode, keys, test.keys)
+		}
+		user, err := UserById(leaving.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.IsDeleted() || user.Name != DeletedUserName || user.Email == leaving.Email || user.HasAvatar() {
+			t.Errorf("%s: the account keeps its data, %q %q", test.mode, user.Name, user.Email)
+		}
+
+		// the threads and posts leave tombstones, the threads of others count only what is left
+		thread, _ := ThreadByUUID(own.Uuid)
+		post, _ := PostByUUID(reply.Uuid)
+		if test.removed != (thread.Topic == "" && thread.IsDeleted()) || test.removed != (post.Body == "" && post.IsDeleted()) {
+			t.Errorf("%s: thread %q deleted %v, post %q deleted %v", test.mode, thread.Topic, thread.IsDeleted(), post.Body, post.IsDeleted())
+		}
+		var attachments int
+		Db.QueryRow("SELECT count(*) FROM attachments WHERE post_id = $1", reply.Id).Scan(&attachments)
+		if (attachments == 0) != test.removed {
+			t.Errorf("%s: %d attachments left", test.mode, attachments)
+		}
+		checkNumPosts(t, mode, others.Id)
+		// the other user keeps everything
+		if thread, _ := ThreadByUUID(others.Uuid); thread.Topic != "Other thread" || thread.IsDeleted() {
+			t.Errorf("%s: the thread of another user changed", test.mode)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"regexp"
+)
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffInsert
+	DiffDelete
+)
+
+// DiffChunk is a run of text that was kept, inserted or deleted between two revisions
+type DiffChunk struct {
+	Op   DiffOp
+	Text string
+}
+
+// words and the whitespace between them, so the text can be put back together
+var diffTokens = regexp.MustCompile(`\s+|\S+`)
+
+// Diff compares two revisions word by word using the longest common subsequence
+func Diff(from, to string) (chunks []DiffChunk) {
+	a := diffTokens.FindAllString(from, -1)
+	b := diffTokens.FindAllString(to, -1)
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	add := func(op DiffOp, text string) {
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Text += text
+			return
+		}
+		chunks = append(chunks, DiffChunk{Op: op, Text: text})
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(DiffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(DiffInsert, b[j])
+	}
+	return
+}
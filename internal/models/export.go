@@ -0,0 +1,292 @@
+package models
+
+import (
+	"database/sql"
+	"path"
+	"strings"
+	"time"
+)
+
+// Export is everything the user created or that is kept about the user, written as
+// data.json in the archive of the account
+type Export struct {
+	ExportedAt  time.Time          `json:"exported_at"`
+	Account     ExportAccount      `json:"account"`
+	Threads     []ExportThread     `json:"threads"`
+	Posts       []ExportPost       `json:"posts"`
+	Edits       []ExportEdit       `json:"edits"`
+	Attachments []ExportAttachment `json:"attachments"`
+	// the UUIDs of the threads the user watches
+	Watching                []string             `json:"watching"`
+	NotificationPreferences map[string]bool      `json:"notification_preferences"`
+	Notifications           []ExportNotification `json:"notifications"`
+	Sessions                []ExportSession      `json:"sessions"`
+	LinkedAccounts          []ExportIdentity     `json:"linked_accounts"`
+	SecurityEvents          []ExportAuditEvent   `json:"security_events"`
+}
+
+type ExportAccount struct {
+	Uuid            string     `json:"uuid"`
+	Name            string     `json:"name"`
+	Handle          string     `json:"handle"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Role            Role       `json:"role"`
+	Bio             string     `json:"bio"`
+	Timezone        string     `json:"timezone"`
+	// path of the avatar in the archive
+	Avatar    string    `json:"avatar,omitempty"`
+	TwoFactor bool      `json:"two_factor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportThread struct {
+	Uuid      string     `json:"uuid"`
+	Topic     string     `json:"topic"`
+	Board     string     `json:"board"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type ExportPost struct {
+	Uuid       string     `json:"uuid"`
+	ThreadUuid string     `json:"thread_uuid"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+}
+
+// a version of a thread topic or a post body written by the user
+type ExportEdit struct {
+	ThreadUuid string    `json:"thread_uuid,omitempty"`
+	PostUuid   string    `json:"post_uuid,omitempty"`
+	Text       string    `json:"text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportAttachment struct {
+	Uuid        string `json:"uuid"`
+	PostUuid    string `json:"post_uuid"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// path of the file in the archive
+	File       string    `json:"file"`
+	CreatedAt  time.Time `json:"created_at"`
+	StorageKey string    `json:"-"`
+}
+
+type ExportNotification struct {
+	Kind      NotificationKind `json:"kind"`
+	Message   string           `json:"message"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at"`
+}
+
+type ExportSession struct {
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type ExportIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportAuditEvent struct {
+	Kind      AuditKind `json:"kind"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// nil for a time that is not set, so it is null in the JSON
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// the file name made safe to use as the last part of a path in the archive
+func archiveName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// run the query and call each for every row
+func eachRow(query string, args []interface{}, each func(row scanner) error) (err error) {
+	rows, err := Db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = each(rows); err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
+
+// Collect the data of the user for the export, the files are read by the caller
+// from the storage keys of the attachments and the avatar
+func (user *User) Export() (export Export, err error) {
+	id := []interface{}{user.Id}
+	export = Export{
+		ExportedAt: time.Now(),
+		Account: ExportAccount{
+			Uuid:            user.Uuid,
+			Name:            user.Name,
+			Handle:          user.Handle,
+			Email:           user.Email,
+			EmailVerifiedAt: nullTime(user.EmailVerifiedAt),
+			Role:            user.Role,
+			Bio:             user.Bio,
+			Timezone:        user.Timezone,
+			TwoFactor:       user.HasTwoFactor(),
+			CreatedAt:       user.CreatedAt,
+		},
+		Threads:                 []ExportThread{},
+		Posts:                   []ExportPost{},
+		Edits:                   []ExportEdit{},
+		Attachments:             []ExportAttachment{},
+		Watching:                []string{},
+		NotificationPreferences: map[string]bool{},
+		Notifications:           []ExportNotification{},
+		Sessions:                []ExportSession{},
+		LinkedAccounts:          []ExportIdentity{},
+		SecurityEvents:          []ExportAuditEvent{},
+	}
+	if user.HasAvatar() {
+		export.Account.Avatar = "avatar" + path.Ext(user.AvatarKey)
+	}
+
+	err = eachRow(`SELECT threads.uuid, threads.topic, categories.name, threads.created_at, threads.edited_at, threads.deleted_at
+		FROM threads JOIN categories ON categories.id = threads.category_id WHERE threads.user_id = $1 ORDER BY threads.id`, id,
+		func(row scanner) error {
+			var t ExportThread
+			var edited, deleted sql.NullTime
+			err := row.Scan(&t.Uuid, &t.Topic, &t.Board, &t.CreatedAt, &edited, &deleted)
+			t.EditedAt, t.DeletedAt = nullTime(edited), nullTime(deleted)
+			export.Threads = append(export.Threads, t)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow(`SELECT posts.uuid, threads.uuid, posts.body, posts.created_at, posts.edited_at, posts.deleted_at
+		FROM posts JOIN threads ON threads.id = posts.thread_id WHERE posts.user_id = $1 ORDER BY posts.id`, id,
+		func(row scanner) error {
+			var p ExportPost
+			var edited, deleted sql.NullTime
+			err := row.Scan(&p.Uuid, &p.ThreadUuid, &p.Body, &p.CreatedAt, &edited, &deleted)
+			p.EditedAt, p.DeletedAt = nullTime(edited), nullTime(deleted)
+			export.Posts = append(export.Posts, p)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow(`SELECT threads.uuid, thread_revisions.topic, thread_revisions.created_at FROM thread_revisions
+		JOIN threads ON threads.id = thread_revisions.thread_id WHERE thread_revisions.user_id = $1 ORDER BY thread_revisions.id`, id,
+		func(row scanner) error {
+			var e ExportEdit
+			err := row.Scan(&e.ThreadUuid, &e.Text, &e.CreatedAt)
+			export.Edits = append(export.Edits, e)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow(`SELECT posts.uuid, post_revisions.body, post_revisions.created_at FROM post_revisions
+		JOIN posts ON posts.id = post_revisions.post_id WHERE post_revisions.user_id = $1 ORDER BY post_revisions.id`, id,
+		func(row scanner) error {
+			var e ExportEdit
+			err := row.Scan(&e.PostUuid, &e.Text, &e.CreatedAt)
+			export.Edits = append(export.Edits, e)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow(`SELECT attachments.uuid, posts.uuid, attachments.filename, attachments.content_type, attachments.size,
+		attachments.storage_key, attachments.created_at FROM attachments JOIN posts ON posts.id = attachments.post_id
+		WHERE attachments.user_id = $1 ORDER BY attachments.id`, id,
+		func(row scanner) error {
+			var a ExportAttachment
+			err := row.Scan(&a.Uuid, &a.PostUuid, &a.Filename, &a.ContentType, &a.Size, &a.StorageKey, &a.CreatedAt)
+			a.File = "attachments/" + a.Uuid + "/" + archiveName(a.Filename)
+			export.Attachments = append(export.Attachments, a)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow(`SELECT threads.uuid FROM thread_subscriptions JOIN threads ON threads.id = thread_subscriptions.thread_id
+		WHERE thread_subscriptions.user_id = $1`, id,
+		func(row scanner) error {
+			var uuid string
+			err := row.Scan(&uuid)
+			export.Watching = append(export.Watching, uuid)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	for _, kind := range NotificationKinds() {
+		export.NotificationPreferences[string(kind)] = user.Notifies(kind)
+	}
+	notifs := []Notification{}
+	err = eachRow("SELECT "+notificationColumns+" FROM notifications WHERE user_id = $1 ORDER BY id", id,
+		func(row scanner) error {
+			var notif Notification
+			err := notif.scan(row)
+			notifs = append(notifs, notif)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	// the messages query the database, the rows above are closed by now
+	for _, notif := range notifs {
+		export.Notifications = append(export.Notifications,
+			ExportNotification{Kind: notif.Kind, Message: notif.Message(), CreatedAt: notif.CreatedAt, ReadAt: nullTime(notif.ReadAt)})
+	}
+	err = eachRow("SELECT user_agent, ip, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND NOT partial ORDER BY id", id,
+		func(row scanner) error {
+			var s ExportSession
+			err := row.Scan(&s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt)
+			export.Sessions = append(export.Sessions, s)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow("SELECT provider, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY id", id,
+		func(row scanner) error {
+			var i ExportIdentity
+			err := row.Scan(&i.Provider, &i.Email, &i.CreatedAt)
+			export.LinkedAccounts = append(export.LinkedAccounts, i)
+			return err
+		})
+	if err != nil {
+		return
+	}
+	err = eachRow("SELECT kind, ip, detail, created_at FROM audit_events WHERE user_id = $1 ORDER BY id", id,
+		func(row scanner) error {
+			var e ExportAuditEvent
+			err := row.Scan(&e.Kind, &e.IP, &e.Detail, &e.CreatedAt)
+			export.SecurityEvents = append(export.SecurityEvents, e)
+			return err
+		})
+	return
+}
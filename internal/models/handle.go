@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+var (
+	ErrInvalidHandle = errors.New("usernames are 3 to 32 letters, digits or underscores")
+	ErrHandleTaken   = errors.New("this username is already taken")
+)
+
+// NormalizeHandle lowercases the handle and drops a leading @, "@Alice" becomes "alice"
+func NormalizeHandle(handle string) (normalized string, err error) {
+	normalized = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handlePattern.MatchString(normalized) {
+		err = ErrInvalidHandle
+	}
+	return
+}
+
+// the handle of a new user: the one chosen, or one made from the name or the email
+func (user *User) pickHandle() (handle string, err error) {
+	if user.Handle != "" {
+		if handle, err = NormalizeHandle(user.Handle); err != nil {
+			return
+		}
+		if _, err = UserByHandle(handle); err == nil {
+			return "", ErrHandleTaken
+		}
+		return handle, nil
+	}
+	base := user.Name
+	if base == "" {
+		base, _, _ = strings.Cut(user.Email, "@")
+	}
+	// keep the allowed characters, then pad or cut to a valid length
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r == ' ' || r == '-' || r == '.':
+			return '_'
+		}
+		return -1
+	}, strings.ToLower(base))
+	for len(base) < 3 {
+		base += "_"
+	}
+	if len(base) > 28 {
+		base = base[:28]
+	}
+	handle = base
+	for n := 2; ; n++ {
+		if _, err = UserByHandle(handle); err != nil {
+			return handle, nil
+		}
+		handle = base + strconv.Itoa(n)
+	}
+}
+
+// CheckHandle normalizes the handle and checks that no other user has it
+func (user *User) CheckHandle(handle string) (normalized string, err error) {
+	if normalized, err = NormalizeHandle(handle); err != nil {
+		return
+	}
+	if other, err := UserByHandle(normalized); err == nil && other.Id != user.Id {
+		return "", ErrHandleTaken
+	}
+	return
+}
+
+// Change the handle of the user, mentions written before keep pointing at the user
+func (user *User) SetHandle(handle string) (err error) {
+	if handle, err = user.CheckHandle(handle); err != nil {
+		return
+	}
+	if _, err = Db.Exec("update users set handle = $2 where id = $1", user.Id, handle); err != nil {
+		return
+	}
+	user.Handle = handle
+	return
+}
+
+// Get a single user given the handle
+func UserByHandle(handle string) (user User, err error) {
+	user = User{}
+	err = user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE handle = $1", strings.ToLower(handle)))
+	return
+}
+
+// Get the users whose handle starts with the prefix, for mention autocompletion
+func UsersWithHandlePrefix(prefix string, limit int) (users []User, err error) {
+	prefix = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	rows, err := Db.Query("SELECT "+userColumns+` FROM users WHERE handle LIKE $1 ESCAPE '\' ORDER BY handle LIMIT $2`, prefix+"%", limit)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		user := User{}
+		if err = user.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	return
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeHandle(t *testing.T) {
+	tests := []struct {
+		handle, want string
+		err          error
+	}{
+		{"alice", "alice", nil},
+		{" @Alice_2 ", "alice_2", nil},
+		{"al", "al", ErrInvalidHandle},
+		{strings.Repeat("a", 33), strings.Repeat("a", 33), ErrInvalidHandle},
+		{"alice-smith", "alice-smith", ErrInvalidHandle},
+		{"alice smith", "alice smith", ErrInvalidHandle},
+		{"@@alice", "@alice", ErrInvalidHandle},
+	}
+	for _, test := range tests {
+		if handle, err := NormalizeHandle(test.handle); handle != test.want || err != test.err {
+			t.Errorf("%q: %q, %v, want %q, %v", test.handle, handle, err, test.want, test.err)
+		}
+	}
+}
+
+func TestHandlesAreUnique(t *testing.T) {
+	setupDB(t)
+	alice := createUser(t, "alice")
+
+	tests := []struct {
+		name string
+		user User
+		// the handle given, or the error
+		want string
+		err  error
+	}{
+		{"chosen", User{Handle: "@Bob"}, "bob", nil},
+		{"taken", User{Handle: "alice"}, "", ErrHandleTaken},
+		{"taken in other letters", User{Handle: "ALICE"}, "", ErrHandleTaken},
+		{"invalid", User{Handle: "a"}, "", ErrInvalidHandle},
+		// without a handle one is made from the name, numbered past the taken ones
+		{"from the name", User{Name: "Alice"}, "alice2", nil},
+		{"from the name again", User{Name: "Alice"}, "alice3", nil},
+		{"from a long name", User{Name: "Carol " + strings.Repeat("x", 40)}, "carol_" + strings.Repeat("x", 22), nil},
+		{"from a short name", User{Name: "Al"}, "al_", nil},
+		{"from the email", User{Email: "Dan.Smith@example.com"}, "dan_smith", nil},
+	}
+	for i, test := range tests {
+		user := test.user
+		user.Password = "password"
+		if user.Email == "" {
+			user.Email = "user" + strings.Repeat("x", i) + "@example.com"
+		}
+		err := user.Create()
+		if err != test.err || err == nil && user.Handle != test.want {
+			t.Errorf("%s: %q, %v, want %q, %v", test.name, user.Handle, err, test.want, test.err)
+		}
+	}
+
+	bob, err := UserByHandle("BOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.SetHandle("Alice"); err != ErrHandleTaken {
+		t.Errorf("renamed to a taken handle: %v", err)
+	}
+	// keeping the own handle is not taking it
+	if err := alice.SetHandle("alice"); err != nil {
+		t.Errorf("renamed to the own handle: %v", err)
+	}
+	if err := bob.SetHandle("robert"); err != nil || bob.Handle != "robert" {
+		t.Errorf("renamed to %q, %v", bob.Handle, err)
+	}
+	// the old handle is free again
+	if _, err := UserByHandle("bob"); err == nil {
+		t.Error("the old handle still finds the user")
+	}
+	if _, err := alice.CheckHandle("bob"); err != nil {
+		t.Errorf("the old handle is not free: %v", err)
+	}
+}
+
+func TestUsersWithHandlePrefix(t *testing.T) {
+	setupDB(t)
+	for _, handle := range []string{"alice", "alina", "a_b", "axb", "bob"} {
+		createUser(t, handle)
+	}
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"al", "alice alina"},
+		{"AL", "alice alina"},
+		// an underscore is not a wildcard
+		{"a_", "a_b"},
+		{"a%", ""},
+		{"", "a_b alice alina axb bob"},
+	}
+	for _, test := range tests {
+		users, err := UsersWithHandlePrefix(test.prefix, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var handles []string
+		for _, user := range users {
+			handles = append(handles, user.Handle)
+		}
+		if got := strings.Join(handles, " "); got != test.want {
+			t.Errorf("%q: %q, want %q", test.prefix, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// how long the user has to log in at the provider
+var LoginAttemptTTL = 10 * time.Minute
+
+var (
+	ErrIdentityLinked      = errors.New("This account of the provider is already linked to another user")
+	ErrInvalidLoginAttempt = errors.New("The login expired or was not started here, please try again")
+)
+
+// Identity links an account at an OpenID Connect provider to a user, a user may have several
+type Identity struct {
+	Id       int
+	UserId   int
+	Provider string
+	// the provider's id of the account, stable unlike the email
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+const identityColumns = "id, user_id, provider, subject, email, created_at"
+
+func (identity *Identity) scan(row scanner) error {
+	return row.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+}
+
+func (identity *Identity) CreatedAtDate() string {
+	return identity.CreatedAt.Format("Jan 2, 2006")
+}
+
+// LoginAttempt keeps the values sent to the provider until it redirects back
+type LoginAttempt struct {
+	Provider string
+	Nonce    string
+	Verifier string
+	// set when a logged-in user links a provider instead of logging in
+	LinkUserId sql.NullInt64
+}
+
+// Save the login attempt under its state, only the hash of the state is stored
+func CreateLoginAttempt(state string, attempt LoginAttempt) (err error) {
+	now := time.Now()
+	if _, err = Db.Exec("delete from login_attempts where created_at < $1", now.Add(-LoginAttemptTTL)); err != nil {
+		return
+	}
+	_, err = Db.Exec("insert into login_attempts (state_hash, provider, nonce, verifier, link_user_id, created_at) values ($1, $2, $3, $4, $5, $6)",
+		hashToken(state), attempt.Provider, attempt.Nonce, attempt.Verifier, attempt.LinkUserId, now)
+	return
+}
+
+// Get and remove the login attempt of the state, each attempt is used once
+func TakeLoginAttempt(provider, state string) (attempt LoginAttempt, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	hash := hashToken(state)
+	err = tx.QueryRow("SELECT provider, nonce, verifier, link_user_id FROM login_attempts WHERE state_hash = $1 AND provider = $2 AND created_at > $3",
+		hash, provider, time.Now().Add(-LoginAttemptTTL)).Scan(&attempt.Provider, &attempt.Nonce, &attempt.Verifier, &attempt.LinkUserId)
+	if err != nil {
+		return attempt, ErrInvalidLoginAttempt
+	}
+	if _, err = tx.Exec("delete from login_attempts where state_hash = $1", hash); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// Get the user linked to the provider account
+func UserByIdentity(provider, subject string) (user User, err error) {
+	err = user.scan(Db.QueryRow("SELECT "+qualified("users", userColumns)+" FROM users JOIN user_identities ON user_identities.user_id = users.id WHERE user_identities.provider = $1 AND user_identities.subject = $2",
+		provider, subject))
+	return
+}
+
+// Link the provider account to the user
+func (user *User) LinkIdentity(provider, subject, email string) (err error) {
+	var owner int
+	err = Db.QueryRow("SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&owner)
+	if err == nil {
+		if owner != user.Id {
+			return ErrIdentityLinked
+		}
+		return nil
+	}
+	_, err = Db.Exec("insert into user_identities (user_id, provider, subject, email, created_at) values ($1, $2, $3, $4, $5)",
+		user.Id, provider, subject, email, time.Now())
+	return
+}
+
+// Get the provider accounts linked to the user
+func (user *User) Identities() (identities []Identity, err error) {
+	rows, err := Db.Query("SELECT "+identityColumns+" FROM user_identities WHERE user_id = $1 ORDER BY provider, id", user.Id)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		identity := Identity{}
+		if err = identity.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		identities = append(identities, identity)
+	}
+	rows.Close()
+	return
+}
+
+// Unlink a provider account of the user, other users' links are not found
+func (user *User) UnlinkIdentity(id int) (err error) {
+	res, err := Db.Exec("delete from user_identities where id = $1 and user_id = $2", id, user.Id)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return
+}
+
+// Create the account of someone logging in with a provider for the first time. The provider
+// verified the email, the account has no password until one is set with a password reset.
+func CreateExternalUser(name, email string) (user User, err error) {
+	user = User{Name: name, Email: email, Password: createToken()}
+	if err = user.Create(); err != nil {
+		return
+	}
+	// no password hashes to the empty string, nothing logs in with it
+	if _, err = Db.Exec("update users set password = '' where id = $1", user.Id); err != nil {
+		return
+	}
+	user.Password = ""
+	err = user.MarkVerified()
+	return
+}
+
+// check if the user has a password, accounts made through a provider have none until one is
+// set with a password reset
+func (user *User) HasPassword() bool {
+	return user.Password != ""
+}
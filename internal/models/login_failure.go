@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Failed logins are counted by email, whether an account has it or not, so the answers do
+// not tell which addresses have one. The first failures are free, then each one doubles
+// the wait before the next attempt, and every LockoutThreshold failures the email is locked
+// out. The count goes on through the lockouts, only a successful login clears it, so the
+// checks reading it like the login challenge still see every failure.
+var (
+	FreeLoginFailures = 3
+	MaxLoginDelay     = time.Minute
+	LockoutThreshold  = 10
+	LockoutDuration   = 15 * time.Minute
+)
+
+// Get how long the email must wait before its next login attempt, and whether it is locked out
+func LoginWait(email string) (wait time.Duration, locked bool, err error) {
+	var count int
+	var lastFailed time.Time
+	var lockedUntil sql.NullTime
+	err = Db.QueryRow("SELECT failures, last_failed_at, locked_until FROM login_failures WHERE email = $1", email).
+		Scan(&count, &lastFailed, &lockedUntil)
+	if err != nil {
+		// no failures
+		return 0, false, nil
+	}
+	now := time.Now()
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return lockedUntil.Time.Sub(now), true, nil
+	}
+	if next := lastFailed.Add(loginDelay(count)); next.After(now) {
+		return next.Sub(now), false, nil
+	}
+	return
+}
+
+// the wait after the count-th failure in a row
+func loginDelay(count int) time.Duration {
+	if count <= FreeLoginFailures {
+		return 0
+	}
+	delay := time.Second << (count - FreeLoginFailures - 1)
+	if delay > MaxLoginDelay || delay <= 0 {
+		delay = MaxLoginDelay
+	}
+	return delay
+}
+
+// Count a failed login of the email, locked is true when this failure locked it out
+func RecordLoginFailure(email string) (locked bool, err error) {
+	now := time.Now()
+	var count int
+	err = Db.QueryRow(`insert into login_failures (email, failures, last_failed_at) values ($1, 1, $2)
+		on conflict (email) do update set failures = login_failures.failures + 1, last_failed_at = excluded.last_failed_at
+		returning failures`, email, now).Scan(&count)
+	if err != nil || LockoutThreshold <= 0 || count%LockoutThreshold != 0 {
+		return
+	}
+	_, err = Db.Exec("update login_failures set locked_until = $2 where email = $1", email, now.Add(LockoutDuration))
+	return err == nil, err
+}
+
+// Forget the failures of the email after a successful login or password reset
+func ClearLoginFailures(email string) (err error) {
+	_, err = Db.Exec("delete from login_failures where email = $1", email)
+	return
+}
+
+// Count the failed logins of the email in a row, since its last login
+func LoginFailures(email string) (count int) {
+	Db.QueryRow("SELECT failures FROM login_failures WHERE email = $1", email).Scan(&count)
+	return
+}
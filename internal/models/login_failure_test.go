@@ -0,0 +1,77 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{FreeLoginFailures, 0},
+		{FreeLoginFailures + 1, time.Second},
+		{FreeLoginFailures + 2, 2 * time.Second},
+		{FreeLoginFailures + 4, 8 * time.Second},
+		{FreeLoginFailures + 20, MaxLoginDelay},
+		// past the width of a shift
+		{FreeLoginFailures + 100, MaxLoginDelay},
+	}
+	for _, test := range tests {
+		if got := loginDelay(test.count); got != test.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", test.count, got, test.want)
+		}
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	setupDB(t)
+	const email = "alice@example.com"
+	for i := 1; i <= 3*LockoutThreshold; i++ {
+		// the lockout and the delay of the last failure are over
+		if _, err := Db.Exec("update login_failures set last_failed_at = $2, locked_until = null where email = $1", email, time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		locked, err := RecordLoginFailure(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i%LockoutThreshold == 0; locked != want {
+			t.Errorf("failure %d: locked = %v, want %v", i, locked, want)
+		}
+		// the count goes on through the lockouts
+		if count := LoginFailures(email); count != i {
+			t.Errorf("failure %d: %d failures counted", i, count)
+		}
+		wait, locked, err := LoginWait(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case i%LockoutThreshold == 0:
+			if !locked || wait <= LockoutDuration-time.Minute || wait > LockoutDuration {
+				t.Errorf("failure %d: wait %v, locked %v, want a lockout", i, wait, locked)
+			}
+		case i <= FreeLoginFailures:
+			if locked || wait != 0 {
+				t.Errorf("failure %d: wait %v, locked %v, want no wait", i, wait, locked)
+			}
+		default:
+			if locked || wait <= 0 || wait > loginDelay(i) {
+				t.Errorf("failure %d: wait %v, locked %v, want up to %v", i, wait, locked, loginDelay(i))
+			}
+		}
+	}
+
+	if wait, locked, _ := LoginWait("bob@example.com"); wait != 0 || locked {
+		t.Errorf("an email without failures waits %v, locked %v", wait, locked)
+	}
+	if err := ClearLoginFailures(email); err != nil {
+		t.Fatal(err)
+	}
+	if wait, locked, _ := LoginWait(email); wait != 0 || locked || LoginFailures(email) != 0 {
+		t.Errorf("after a login: wait %v, locked %v, %d failures", wait, locked, LoginFailures(email))
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/taewony/go-fullstack-webapp/internal/markdown"
+)
+
+// Mentions are resolved to users when the post is written and kept in post_mentions,
+// so they keep pointing at the same user after a rename even if someone else takes
+// the old handle. Mention links use the user UUID, /users/{uuid} redirects to the
+// current profile URL.
+
+// the link of a user mention
+func (user *User) MentionURL() string {
+	return "/users/" + user.Uuid
+}
+
+// Resolve a mention to the user currently holding the handle, used before the post is saved
+func ResolveHandle(handle string) (href string, ok bool) {
+	user, err := UserByHandle(handle)
+	if err != nil {
+		return "", false
+	}
+	return user.MentionURL(), true
+}
+
+// record the users mentioned in the body, mentions recorded by earlier revisions are kept
+func saveMentions(tx *sql.Tx, postId int, body string) (err error) {
+	for _, handle := range markdown.Mentions(body) {
+		var count int
+		if err = tx.QueryRow("SELECT count(*) FROM post_mentions WHERE post_id = $1 AND handle = $2", postId, handle).Scan(&count); err != nil {
+			return
+		}
+		if count > 0 {
+			continue
+		}
+		// look the user up within the transaction, which holds the connection
+		var userId int
+		err = tx.QueryRow("SELECT id FROM users WHERE handle = $1", handle).Scan(&userId)
+		if err == sql.ErrNoRows {
+			// not a user, the mention stays plain text
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec("insert into post_mentions (post_id, user_id, handle, notified) values ($1, $2, $3, $4)", postId, userId, handle, false)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// resolve the mentions of the post to the users recorded when it was written
+func (post *Post) mentionResolver() markdown.Resolver {
+	links := map[string]string{}
+	rows, err := Db.Query("SELECT post_mentions.handle, users.uuid FROM post_mentions JOIN users ON users.id = post_mentions.user_id WHERE post_mentions.post_id = $1", post.Id)
+	if err == nil {
+		for rows.Next() {
+			var handle, uuid string
+			if rows.Scan(&handle, &uuid) == nil {
+				links[handle] = "/users/" + uuid
+			}
+		}
+		rows.Close()
+	}
+	return func(handle string) (href string, ok bool) {
+		href, ok = links[handle]
+		return
+	}
+}
+
+// Notify the users mentioned in the post who were not notified yet, adding them to notified
+func notifyMentions(thread Thread, post Post, notified map[int]bool) (err error) {
+	rows, err := Db.Query("SELECT user_id FROM post_mentions WHERE post_id = $1 AND notified = $2", post.Id, false)
+	if err != nil {
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if !notified[id] {
+			if notified[id], err = notify(id, NotifyMention, thread, post); err != nil {
+				return
+			}
+		}
+	}
+	_, err = Db.Exec("update post_mentions set notified = $2 where post_id = $1", post.Id, true)
+	return
+}
+
+// Notify the users newly mentioned by an edit of the post
+func NotifyEdit(thread Thread, post Post) (err error) {
+	return notifyMentions(thread, post, map[int]bool{})
+}
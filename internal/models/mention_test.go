@@ -0,0 +1,60 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// a mention keeps pointing at the user it named when written, through renames
+func TestMentionsFollowTheUser(t *testing.T) {
+	setupDB(t)
+	board := createCategory(t, Category{Slug: "general", Name: "General"})
+	author, bob := createUser(t, "author"), createUser(t, "bob")
+	thread, err := author.CreateThread(board, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := author.CreatePost(thread, "hi @bob and @nobody", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NotifyPost(thread, post); err != nil {
+		t.Fatal(err)
+	}
+	if kinds := notificationKinds(t, bob); len(kinds) != 1 || kinds[0] != NotifyMention {
+		t.Errorf("bob was notified %v", kinds)
+	}
+
+	if err := bob.SetHandle("robert"); err != nil {
+		t.Fatal(err)
+	}
+	impostor := User{Name: "bob", Handle: "bob", Email: "impostor@example.com", Password: "password"}
+	if err := impostor.Create(); err != nil {
+		t.Fatal(err)
+	}
+	html := post.BodyHTML()
+	if !strings.Contains(html, `href="`+bob.MentionURL()+`"`) || strings.Contains(html, impostor.MentionURL()) {
+		t.Errorf("the mention of bob renders as %s", html)
+	}
+	if strings.Contains(html, "@nobody</a>") {
+		t.Errorf("the mention of no one is a link: %s", html)
+	}
+
+	// an edit notifies only the users it newly mentions, the handle written before keeps its user
+	carol := createUser(t, "carol")
+	if err := post.Edit(author, "hi @bob, @nobody and @carol", Hold{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NotifyEdit(thread, post); err != nil {
+		t.Fatal(err)
+	}
+	if kinds := notificationKinds(t, bob); len(kinds) != 1 {
+		t.Errorf("bob was notified %v after the edit", kinds)
+	}
+	if kinds := notificationKinds(t, carol); len(kinds) != 1 || kinds[0] != NotifyMention {
+		t.Errorf("carol was notified %v", kinds)
+	}
+	if kinds := notificationKinds(t, impostor); len(kinds) != 0 {
+		t.Errorf("the new bob was notified %v", kinds)
+	}
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// NotificationKind is the event a notification is about
+type NotificationKind string
+
+const (
+	// someone replied to a thread the user started
+	NotifyReply NotificationKind = "reply"
+	// someone replied to a thread the user watches
+	NotifyWatched NotificationKind = "watched"
+	// someone mentioned the user in a post
+	NotifyMention NotificationKind = "mention"
+)
+
+// all the kinds, in the order shown on the preferences page
+func NotificationKinds() []NotificationKind {
+	return []NotificationKind{NotifyReply, NotifyWatched, NotifyMention}
+}
+
+// what the preferences page says about each kind
+func (kind NotificationKind) Description() string {
+	switch kind {
+	case NotifyReply:
+		return "Replies to threads I started"
+	case NotifyWatched:
+		return "Replies to threads I watch"
+	case NotifyMention:
+		return "Posts mentioning me"
+	}
+	return string(kind)
+}
+
+type Notification struct {
+	Id       int
+	UserId   int
+	Kind     NotificationKind
+	ThreadId int
+	PostId   int
+	// the user whose action caused the notification
+	ActorId   int
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+const notificationColumns = "id, user_id, kind, thread_id, post_id, actor_id, created_at, read_at"
+
+func (notif *Notification) scan(row scanner) error {
+	return row.Scan(&notif.Id, &notif.UserId, &notif.Kind, &notif.ThreadId, &notif.PostId, &notif.ActorId, &notif.CreatedAt, &notif.ReadAt)
+}
+
+func (notif *Notification) CreatedAtDate() string {
+	return notif.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
+}
+
+func (notif *Notification) IsRead() bool {
+	return notif.ReadAt.Valid
+}
+
+// the sentence shown in the notification list
+func (notif *Notification) Message() string {
+	var actor, topic string
+	Db.QueryRow("SELECT name FROM users WHERE id = $1", notif.ActorId).Scan(&actor)
+	Db.QueryRow("SELECT topic FROM threads WHERE id = $1", notif.ThreadId).Scan(&topic)
+	switch notif.Kind {
+	case NotifyReply:
+		return actor + " replied to your thread " + topic
+	case NotifyWatched:
+		return actor + " replied to " + topic
+	case NotifyMention:
+		return actor + " mentioned you in " + topic
+	}
+	return topic
+}
+
+// the thread and post the notification points at
+func (notif *Notification) Target() string {
+	var thread, post string
+	Db.QueryRow("SELECT uuid FROM threads WHERE id = $1", notif.ThreadId).Scan(&thread)
+	Db.QueryRow("SELECT uuid FROM posts WHERE id = $1", notif.PostId).Scan(&post)
+	return "/thread/" + thread + "#post-" + post
+}
+
+// check if the user wants to be notified of the kind, every kind is on until turned off
+func (user *User) Notifies(kind NotificationKind) bool {
+	enabled := true
+	Db.QueryRow("SELECT enabled FROM notification_preferences WHERE user_id = $1 AND kind = $2", user.Id, kind).Scan(&enabled)
+	return enabled
+}
+
+// Turn a kind of notification on or off for the user
+func (user *User) SetNotifies(kind NotificationKind, enabled bool) (err error) {
+	_, err = Db.Exec(`insert into notification_preferences (user_id, kind, enabled) values ($1, $2, $3)
+		on conflict (user_id, kind) do update set enabled = excluded.enabled`, user.Id, kind, enabled)
+	return
+}
+
+// Watch the thread, the user is notified of every reply
+func (user *User) Watch(thread Thread) (err error) {
+	_, err = Db.Exec("insert into thread_subscriptions (user_id, thread_id, created_at) values ($1, $2, $3) on conflict (user_id, thread_id) do nothing",
+		user.Id, thread.Id, time.Now())
+	return
+}
+
+// Stop watching the thread
+func (user *User) Unwatch(thread Thread) (err error) {
+	_, err = Db.Exec("delete from thread_subscriptions where user_id = $1 and thread_id = $2", user.Id, thread.Id)
+	return
+}
+
+// check if the user watches the thread
+func (user *User) Watches(thread Thread) bool {
+	var count int
+	Db.QueryRow("SELECT count(*) FROM thread_subscriptions WHERE user_id = $1 AND thread_id = $2", user.Id, thread.Id).Scan(&count)
+	return count > 0
+}
+
+// Notify a user of the post, unless they wrote it, turned the kind off or cannot read the board anymore
+func notify(userId int, kind NotificationKind, thread Thread, post Post) (sent bool, err error) {
+	if userId == post.UserId {
+		return
+	}
+	user, err := UserById(userId)
+	if err != nil {
+		return false, nil
+	}
+	cat, err := thread.Category()
+	if err != nil || !user.CanRead(cat) || !user.Notifies(kind) {
+		return
+	}
+	_, err = Db.Exec("insert into notifications (user_id, kind, thread_id, post_id, actor_id, created_at) values ($1, $2, $3, $4, $5, $6)",
+		userId, kind, thread.Id, post.Id, post.UserId, time.Now())
+	return err == nil, err
+}
+
+// Notify the mentioned users, the thread author and the watchers of a new post, each user gets a single notification
+func NotifyPost(thread Thread, post Post) (err error) {
+	notified := map[int]bool{}
+	if err = notifyMentions(thread, post, notified); err != nil {
+		return
+	}
+	if !notified[thread.UserId] {
+		if notified[thread.UserId], err = notify(thread.UserId, NotifyReply, thread, post); err != nil {
+			return
+		}
+	}
+	rows, err := Db.Query("SELECT user_id FROM thread_subscriptions WHERE thread_id = $1 AND user_id <> $2", thread.Id, thread.UserId)
+	if err != nil {
+		return
+	}
+	var watchers []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		watchers = append(watchers, id)
+	}
+	rows.Close()
+	for _, id := range watchers {
+		if notified[id] {
+			continue
+		}
+		if _, err = notify(id, NotifyWatched, thread, post); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Get the latest notifications of the user
+func (user *User) Notifications(limit int) (notifs []Notification, err error) {
+	rows, err := Db.Query("SELECT "+notificationColumns+" FROM notifications WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2", user.Id, limit)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		notif := Notification{}
+		if err = notif.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		notifs = append(notifs, notif)
+	}
+	rows.Close()
+	return
+}
+
+// Get the number of unread notifications, shown on the bell
+func (user *User) UnreadNotifications() (count int, err error) {
+	err = Db.QueryRow("SELECT count(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", user.Id).Scan(&count)
+	return
+}
+
+// Get a notification of the user, other users' notifications are not found
+func (user *User) Notification(id int) (notif Notification, err error) {
+	err = notif.scan(Db.QueryRow("SELECT "+notificationColumns+" FROM notifications WHERE id = $1 AND user_id = $2", id, user.Id))
+	return
+}
+
+// Mark the notification as read
+func (notif *Notification) MarkRead() (err error) {
+	_, err = Db.Exec("update notifications set read_at = $2 where id = $1 and read_at is null", notif.Id, time.Now())
+	return
+}
+
+// Mark all the notifications of the user as read
+func (user *User) MarkNotificationsRead() (err error) {
+	_, err = Db.Exec("update notifications set read_at = $2 where user_id = $1 and read_at is null", user.Id, time.Now())
+	return
+}
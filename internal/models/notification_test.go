@@ -0,0 +1,82 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// the kinds of the notifications of the user, the latest first
+func notificationKinds(t *testing.T, user User) (kinds []NotificationKind) {
+	t.Helper()
+	notifs, err := user.Notifications(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, notif := range notifs {
+		kinds = append(kinds, notif.Kind)
+	}
+	return
+}
+
+func TestNotifyPost(t *testing.T) {
+	setupDB(t)
+	board := createCategory(t, Category{Slug: "general", Name: "General"})
+	staff := createCategory(t, Category{Slug: "staff-room", Name: "Staff", ReadRole: RoleModerator})
+	author, replier := createUserWithRole(t, "author", RoleModerator), createUser(t, "replier")
+
+	tests := []struct {
+		handle string
+		board  Category
+		// brings the user to the state of the test
+		setup func(user User, thread Thread)
+		want  NotificationKind
+	}{
+		{"watcher", board, func(user User, thread Thread) { user.Watch(thread) }, NotifyWatched},
+		{"not watching", board, func(User, Thread) {}, ""},
+		{"unwatched", board, func(user User, thread Thread) {
+			user.Watch(thread)
+			user.Unwatch(thread)
+		}, ""},
+		{"watched off", board, func(user User, thread Thread) {
+			user.Watch(thread)
+			user.SetNotifies(NotifyWatched, false)
+		}, ""},
+		// other kinds off leave the watched replies on
+		{"replies off", board, func(user User, thread Thread) {
+			user.Watch(thread)
+			user.SetNotifies(NotifyReply, false)
+		}, NotifyWatched},
+		{"watcher of a closed board", staff, func(user User, thread Thread) { user.Watch(thread) }, ""},
+	}
+	for _, test := range tests {
+		thread, err := author.CreateThread(test.board, test.handle, Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := createUser(t, strings.ReplaceAll(test.handle, " ", "_"))
+		test.setup(user, thread)
+		// the one writing the reply hears nothing of it, even watching
+		replier.Watch(thread)
+		author.Watch(thread)
+		post, err := replier.CreatePost(thread, "A reply", Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NotifyPost(thread, post); err != nil {
+			t.Fatal(err)
+		}
+		kinds := notificationKinds(t, user)
+		if test.want == "" && len(kinds) != 0 || test.want != "" && (len(kinds) != 1 || kinds[0] != test.want) {
+			t.Errorf("%s: notified %v, want %q", test.handle, kinds, test.want)
+		}
+	}
+	if kinds := notificationKinds(t, replier); len(kinds) != 0 {
+		t.Errorf("the replier was notified of their own posts: %v", kinds)
+	}
+	// the author hears once of each reply, as the author and not as a watcher
+	kinds := notificationKinds(t, author)
+	if len(kinds) != len(tests) || slices.ContainsFunc(kinds, func(kind NotificationKind) bool { return kind != NotifyReply }) {
+		t.Errorf("the author was notified %v", kinds)
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/mail"
+)
+
+// attempts before a mail is given up, waiting MailRetryDelay, then twice as long after each failure
+var (
+	MaxMailAttempts = 8
+	MailRetryDelay  = time.Minute
+)
+
+// OutboxMail is an email waiting to be delivered, or kept after delivery for the dev mailbox
+type OutboxMail struct {
+	Id            int
+	To            string
+	Subject       string
+	Text          string
+	HTML          string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	SentAt        sql.NullTime
+	CreatedAt     time.Time
+}
+
+const outboxColumns = "id, to_addr, subject, text_body, html_body, attempts, next_attempt_at, last_error, sent_at, created_at"
+
+func (m *OutboxMail) scan(row scanner) error {
+	return row.Scan(&m.Id, &m.To, &m.Subject, &m.Text, &m.HTML, &m.Attempts, &m.NextAttemptAt, &m.LastError, &m.SentAt, &m.CreatedAt)
+}
+
+func (m *OutboxMail) CreatedAtDate() string {
+	return m.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
+}
+
+// the delivery state shown in the mailbox
+func (m *OutboxMail) Status() string {
+	switch {
+	case m.SentAt.Valid:
+		return "sent"
+	case m.Attempts >= MaxMailAttempts:
+		return "failed"
+	case m.Attempts > 0:
+		return "retrying"
+	}
+	return "queued"
+}
+
+// Queue a mail for the delivery worker, it is sent on its next run
+func QueueMail(to, subject, text, html string) (err error) {
+	now := time.Now()
+	_, err = Db.Exec("insert into outbox (to_addr, subject, text_body, html_body, next_attempt_at, created_at) values ($1, $2, $3, $4, $5, $6)",
+		to, subject, text, html, now, now)
+	return
+}
+
+// Send the mails that are due, a failed mail is retried later until it runs out of attempts
+func DeliverOutbox(mailer mail.Mailer) (sent int, err error) {
+	rows, err := Db.Query("SELECT "+outboxColumns+" FROM outbox WHERE sent_at IS NULL AND attempts < $1 AND next_attempt_at <= $2 ORDER BY id",
+		MaxMailAttempts, time.Now())
+	if err != nil {
+		return
+	}
+	var due []OutboxMail
+	for rows.Next() {
+		m := OutboxMail{}
+		if err = m.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		due = append(due, m)
+	}
+	rows.Close()
+
+	for _, m := range due {
+		sendErr := mailer.Send(mail.Message{To: m.To, Subject: m.Subject, Text: m.Text, HTML: m.HTML})
+		if sendErr != nil {
+			next := time.Now().Add(MailRetryDelay << m.Attempts)
+			_, err = Db.Exec("update outbox set attempts = attempts + 1, next_attempt_at = $2, last_error = $3 where id = $1", m.Id, next, sendErr.Error())
+		} else {
+			_, err = Db.Exec("update outbox set attempts = attempts + 1, sent_at = $2, last_error = null where id = $1", m.Id, time.Now())
+			sent++
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Get the latest mails of the outbox, sent or not
+func OutboxMails(limit int) (mails []OutboxMail, err error) {
+	rows, err := Db.Query("SELECT "+outboxColumns+" FROM outbox ORDER BY id DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		m := OutboxMail{}
+		if err = m.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		mails = append(mails, m)
+	}
+	rows.Close()
+	return
+}
+
+// Get a mail of the outbox by id
+func OutboxMailById(id int) (m OutboxMail, err error) {
+	err = m.scan(Db.QueryRow("SELECT "+outboxColumns+" FROM outbox WHERE id = $1", id))
+	return
+}
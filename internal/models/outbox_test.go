@@ -0,0 +1,119 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/mail"
+	"github.com/taewony/go-fullstack-webapp/internal/mail/mailtest"
+)
+
+func TestDeliverOutbox(t *testing.T) {
+	setupDB(t)
+	attempts, delay := MaxMailAttempts, MailRetryDelay
+	MaxMailAttempts, MailRetryDelay = 3, time.Hour
+	t.Cleanup(func() { MaxMailAttempts, MailRetryDelay = attempts, delay })
+
+	server, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	mailer := mail.NewSMTP(server.Host, server.Port, "", "", "noreply@chitchat.example")
+	if err := QueueMail("someone@example.com", "Hello", "text", "<p>html</p>"); err != nil {
+		t.Fatal(err)
+	}
+	// the mail is due again now, whatever its backoff
+	due := func() {
+		if _, err := Db.Exec("update outbox set next_attempt_at = $1", time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		failing  bool
+		due      bool
+		sent     int
+		attempts int
+		// the wait before the next attempt, zero when none is planned
+		backoff  time.Duration
+		status   string
+		received int
+	}{
+		{"refused", true, false, 0, 1, time.Hour, "retrying", 0},
+		{"waits for the backoff", false, false, 0, 1, time.Hour, "retrying", 0},
+		{"refused again", true, true, 0, 2, 2 * time.Hour, "retrying", 0},
+		{"delivered", false, true, 1, 3, 0, "sent", 1},
+		{"not sent twice", false, true, 0, 3, 0, "sent", 1},
+	}
+	for _, test := range tests {
+		server.SetFailing(test.failing)
+		if test.due {
+			due()
+		}
+		before := time.Now()
+		sent, err := DeliverOutbox(mailer)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		m, err := OutboxMailById(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != test.sent || m.Attempts != test.attempts || m.Status() != test.status || len(server.Received()) != test.received {
+			t.Errorf("%s: sent %d, %d attempts, %s, %d received, want %d, %d, %s, %d", test.name,
+				sent, m.Attempts, m.Status(), len(server.Received()), test.sent, test.attempts, test.status, test.received)
+		}
+		if test.backoff > 0 {
+			if wait := m.NextAttemptAt.Sub(before); wait < test.backoff-time.Minute || wait > test.backoff+time.Minute {
+				t.Errorf("%s: next attempt in %v, want %v", test.name, wait, test.backoff)
+			}
+			if !m.LastError.Valid {
+				t.Errorf("%s: the error of the attempt is not kept", test.name)
+			}
+		}
+		if test.status == "sent" && (!m.SentAt.Valid || m.LastError.Valid) {
+			t.Errorf("%s: sent at %v with error %v", test.name, m.SentAt, m.LastError)
+		}
+	}
+}
+
+func TestDeliverOutboxGivesUp(t *testing.T) {
+	setupDB(t)
+	attempts := MaxMailAttempts
+	MaxMailAttempts = 2
+	t.Cleanup(func() { MaxMailAttempts = attempts })
+
+	server, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetFailing(true)
+	mailer := mail.NewSMTP(server.Host, server.Port, "", "", "noreply@chitchat.example")
+	if err := QueueMail("someone@example.com", "Hello", "text", "<p>html</p>"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxMailAttempts+2; i++ {
+		if _, err := Db.Exec("update outbox set next_attempt_at = $1", time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DeliverOutbox(mailer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := OutboxMailById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Attempts != MaxMailAttempts || m.Status() != "failed" || m.SentAt.Valid {
+		t.Errorf("%d attempts, %s, want %d attempts and failed", m.Attempts, m.Status(), MaxMailAttempts)
+	}
+
+	// a failed mail is not sent once the server works again
+	server.SetFailing(false)
+	if sent, err := DeliverOutbox(mailer); err != nil || sent != 0 || len(server.Received()) != 0 {
+		t.Errorf("sent %d, %v, %d received after giving up", sent, err, len(server.Received()))
+	}
+}
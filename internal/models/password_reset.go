@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// how long a reset link works, and how many links a user may ask for per PasswordResetTTL
+var (
+	PasswordResetTTL  = time.Hour
+	MaxPasswordResets = 3
+)
+
+var (
+	ErrTooManyResets     = errors.New("Too many password resets requested")
+	ErrInvalidResetToken = errors.New("This reset link is invalid or has expired")
+)
+
+// Only the SHA-256 hash of a reset token is stored, the token itself is only ever in the
+// email, so reading the table does not give a way into the accounts.
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// Create a reset token for the user, refused once the user asked for too many
+func (user *User) CreatePasswordReset() (token string, err error) {
+	now := time.Now()
+	var count int
+	err = Db.QueryRow("SELECT count(*) FROM password_resets WHERE user_id = $1 AND created_at > $2", user.Id, now.Add(-PasswordResetTTL)).Scan(&count)
+	if err != nil {
+		return
+	}
+	if count >= MaxPasswordResets {
+		return "", ErrTooManyResets
+	}
+	token = createToken()
+	_, err = Db.Exec("insert into password_resets (user_id, token_hash, created_at, expires_at) values ($1, $2, $3, $4)",
+		user.Id, hashToken(token), now, now.Add(PasswordResetTTL))
+	return
+}
+
+// Get the user of an unused, unexpired reset token
+func UserByResetToken(token string) (user User, err error) {
+	var userId int
+	err = Db.QueryRow("SELECT user_id FROM password_resets WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2",
+		hashToken(token), time.Now()).Scan(&userId)
+	if err != nil {
+		return user, ErrInvalidResetToken
+	}
+	return UserById(userId)
+}
+
+// Set the password of the token's user, every reset link and session of the user stops working
+func ResetPassword(token, password string) (user User, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userId int
+	err = tx.QueryRow("SELECT user_id FROM password_resets WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2",
+		hashToken(token), now).Scan(&userId)
+	if err != nil {
+		return user, ErrInvalidResetToken
+	}
+	if _, err = tx.Exec("update users set password = $2 where id = $1", userId, Encrypt(password)); err != nil {
+		return
+	}
+	if _, err = tx.Exec("update password_resets set used_at = $2 where user_id = $1 and used_at is null", userId, now); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from sessions where user_id = $1", userId); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	return UserById(userId)
+}
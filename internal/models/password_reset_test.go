@@ -0,0 +1,89 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResetPassword(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice")
+	other := createUser(t, "bob")
+	reset := func(user User) string {
+		t.Helper()
+		token, err := user.CreatePasswordReset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid, sibling, othersToken := reset(user), reset(user), reset(other)
+	expired := reset(user)
+	if _, err := Db.Exec("update password_resets set expires_at = $2 where token_hash = $1", hashToken(expired), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	session, err := user.CreateSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is never stored, only its hash
+	var stored int
+	Db.QueryRow("SELECT count(*) FROM password_resets WHERE token_hash = $1", valid).Scan(&stored)
+	if stored != 0 {
+		t.Error("the token is stored as it is")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+		err   error
+	}{
+		{"unknown token", "not-a-token", 0, ErrInvalidResetToken},
+		{"empty token", "", 0, ErrInvalidResetToken},
+		{"expired token", expired, 0, ErrInvalidResetToken},
+		{"valid token", valid, user.Id, nil},
+		{"used token", valid, 0, ErrInvalidResetToken},
+		{"other token of the user, used up by the reset", sibling, 0, ErrInvalidResetToken},
+		{"token of another user", othersToken, other.Id, nil},
+	}
+	for _, test := range tests {
+		got, err := ResetPassword(test.token, "new password")
+		if err != test.err || got.Id != test.want {
+			t.Errorf("%s: user %d, %v, want %d, %v", test.name, got.Id, err, test.want, test.err)
+		}
+	}
+
+	user, _ = UserById(user.Id)
+	if user.Password != Encrypt("new password") {
+		t.Error("the password did not change")
+	}
+	if valid, _ := session.Check(); valid {
+		t.Error("the sessions of the user still work after the reset")
+	}
+}
+
+func TestPasswordResetsAreLimited(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice")
+	for i := 0; i < MaxPasswordResets; i++ {
+		token, err := user.CreatePasswordReset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := UserByResetToken(token); err != nil || got.Id != user.Id {
+			t.Errorf("UserByResetToken = %d, %v, want %d", got.Id, err, user.Id)
+		}
+	}
+	if _, err := user.CreatePasswordReset(); err != ErrTooManyResets {
+		t.Errorf("err = %v, want ErrTooManyResets", err)
+	}
+	// the older requests no longer count
+	if _, err := Db.Exec("update password_resets set created_at = $1", time.Now().Add(-PasswordResetTTL-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.CreatePasswordReset(); err != nil {
+		t.Errorf("err = %v once the requests are older than the TTL", err)
+	}
+}
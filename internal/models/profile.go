@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// longest name and bio accepted, in characters
+const (
+	MaxNameLength = 64
+	MaxBioLength  = 500
+)
+
+var (
+	ErrInvalidName     = errors.New("the name must be 1 to 64 characters")
+	ErrBioTooLong      = errors.New("the bio must be at most 500 characters")
+	ErrInvalidTimezone = errors.New("unknown timezone")
+	ErrWrongPassword   = errors.New("the current password is not correct")
+	ErrPasswordEmpty   = errors.New("the new password must not be empty")
+)
+
+// trim the profile fields and check them before they are saved
+func (user *User) validateProfile() error {
+	user.Name = strings.TrimSpace(user.Name)
+	user.Bio = strings.TrimSpace(user.Bio)
+	user.Timezone = strings.TrimSpace(user.Timezone)
+	if user.Name == "" || utf8.RuneCountInString(user.Name) > MaxNameLength {
+		return ErrInvalidName
+	}
+	if utf8.RuneCountInString(user.Bio) > MaxBioLength {
+		return ErrBioTooLong
+	}
+	if user.Timezone != "" {
+		if _, err := time.LoadLocation(user.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	return nil
+}
+
+// Location is the zone the dates are shown to the user in
+func (user *User) Location() *time.Location {
+	if user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Timezones offered on the settings page, the zone database of the system has them all
+// but a short list of the common ones is easier to pick from
+func Timezones() []string {
+	return []string{
+		"UTC",
+		"America/Los_Angeles", "America/Denver", "America/Chicago", "America/New_York", "America/Sao_Paulo",
+		"Europe/London", "Europe/Paris", "Europe/Berlin", "Europe/Moscow",
+		"Africa/Cairo", "Africa/Johannesburg",
+		"Asia/Dubai", "Asia/Kolkata", "Asia/Bangkok", "Asia/Shanghai", "Asia/Seoul", "Asia/Tokyo",
+		"Australia/Sydney", "Pacific/Auckland",
+	}
+}
+
+// Change the password after checking the current one, the other sessions of the user end
+// so a device that knew the old password is logged out
+func (user *User) ChangePassword(current, password, keepSession string) (err error) {
+	if user.Password != Encrypt(current) {
+		return ErrWrongPassword
+	}
+	if password == "" {
+		return ErrPasswordEmpty
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("update users set password = $2 where id = $1", user.Id, Encrypt(password)); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from sessions where user_id = $1 and uuid != $2", user.Id, keepSession); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	user.Password = Encrypt(password)
+	return
+}
+
+// Set the storage key of the avatar, an empty key removes it
+func (user *User) SetAvatar(key string) (err error) {
+	if _, err = Db.Exec("update users set avatar_key = $2 where id = $1", user.Id, key); err != nil {
+		return
+	}
+	user.AvatarKey = key
+	return
+}
+
+func (user *User) HasAvatar() bool {
+	return user.AvatarKey != ""
+}
+
+// the user id as $1 followed by the category ids, the arguments of the activity queries
+func userCategoryArgs(userId int, categoryIds []int) []interface{} {
+	args := []interface{}{userId}
+	for _, id := range categoryIds {
+		args = append(args, id)
+	}
+	return args
+}
+
+// Count the threads the user started in the categories, deleted ones are not counted
+func (user *User) ThreadCount(categoryIds []int) (count int) {
+	if len(categoryIds) == 0 {
+		return
+	}
+	args := userCategoryArgs(user.Id, categoryIds)
+	Db.QueryRow("SELECT count(*) FROM threads WHERE user_id = $1 AND deleted_at IS NULL AND category_id IN ("+
+		placeholders(2, len(categoryIds))+")", args...).Scan(&count)
+	return
+}
+
+// Count the posts the user wrote in threads of the categories, deleted ones are not counted
+func (user *User) PostCount(categoryIds []int) (count int) {
+	if len(categoryIds) == 0 {
+		return
+	}
+	args := userCategoryArgs(user.Id, categoryIds)
+	Db.QueryRow("SELECT count(*) FROM posts JOIN threads ON threads.id = posts.thread_id WHERE posts.user_id = $1 "+
+		"AND posts.deleted_at IS NULL AND threads.deleted_at IS NULL AND threads.category_id IN ("+
+		placeholders(2, len(categoryIds))+")", args...).Scan(&count)
+	return
+}
+
+// Get the latest threads the user started in the categories
+func (user *User) RecentThreads(categoryIds []int, limit int) (threads []Thread, err error) {
+	if len(categoryIds) == 0 {
+		return
+	}
+	args := userCategoryArgs(user.Id, categoryIds)
+	args = append(args, limit)
+	rows, err := Db.Query("SELECT "+threadColumns+" FROM threads WHERE user_id = $1 AND deleted_at IS NULL AND hidden_at IS NULL AND category_id IN ("+
+		placeholders(2, len(categoryIds))+") ORDER BY created_at DESC LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		thread := Thread{}
+		if err = thread.scan(rows); err != nil {
+			return
+		}
+		threads = append(threads, thread)
+	}
+	err = rows.Err()
+	return
+}
+
+// Get the latest posts the user wrote in threads of the categories
+func (user *User) RecentPosts(categoryIds []int, limit int) (posts []Post, err error) {
+	if len(categoryIds) == 0 {
+		return
+	}
+	args := userCategoryArgs(user.Id, categoryIds)
+	args = append(args, limit)
+	rows, err := Db.Query("SELECT "+qualified("posts", postColumns)+" FROM posts JOIN threads ON threads.id = posts.thread_id "+
+		"WHERE posts.user_id = $1 AND posts.deleted_at IS NULL AND posts.hidden_at IS NULL AND threads.deleted_at IS NULL AND threads.hidden_at IS NULL "+
+		"AND threads.category_id IN ("+
+		placeholders(2, len(categoryIds))+") ORDER BY posts.created_at DESC LIMIT $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		post := Post{}
+		if err = post.scan(rows); err != nil {
+			return
+		}
+		posts = append(posts, post)
+	}
+	err = rows.Err()
+	return
+}
+
+// Get the URL of the post on the page of its thread
+func (post *Post) Link() string {
+	var thread string
+	Db.QueryRow("SELECT uuid FROM threads WHERE id = $1", post.ThreadId).Scan(&thread)
+	return "/thread/" + thread + "#post-" + post.Uuid
+}
+
+// Get the topic of the thread the post is in
+func (post *Post) ThreadTopic() (topic string) {
+	Db.QueryRow("SELECT topic FROM threads WHERE id = $1", post.ThreadId).Scan(&topic)
+	return
+}
@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestChangePassword(t *testing.T) {
+	setupDB(t)
+	user, other := createUser(t, "alice"), createUser(t, "bob")
+	current, phone, others := createSession(t, user), createSession(t, user), createSession(t, other)
+
+	tests := []struct {
+		name              string
+		current, password string
+		err               error
+		// whether the other session of the user still works after, a refused change logs nobody out
+		phone bool
+	}{
+		{"wrong current password", "wrong", "new password", ErrWrongPassword, true},
+		{"no current password", "", "new password", ErrWrongPassword, true},
+		{"empty new password", "password", "", ErrPasswordEmpty, true},
+		{"changed", "password", "new password", nil, false},
+		{"the old password after the change", "password", "newer password", ErrWrongPassword, false},
+	}
+	for _, test := range tests {
+		if err := user.ChangePassword(test.current, test.password, current.Uuid); err != test.err {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+		if valid, _ := phone.Check(); valid != test.phone {
+			t.Errorf("%s: the other session works %v, want %v", test.name, valid, test.phone)
+		}
+	}
+
+	stored, _ := UserById(user.Id)
+	if stored.Password != Encrypt("new password") {
+		t.Error("the new password is not stored")
+	}
+	// this device and the ones of other users stay logged in
+	for _, session := range []Session{current, others} {
+		if valid, _ := session.Check(); !valid {
+			t.Errorf("the session %d was logged out", session.Id)
+		}
+	}
+}
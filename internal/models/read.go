@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ReadMark tells what the user has read of a thread
+type ReadMark struct {
+	// the user opened the thread, or marked everything as read after it was started
+	Seen bool
+	// posts added since the user last read the thread, as counted in NumPosts: the deleted,
+	// hidden and held ones are left out
+	Unread int
+}
+
+// ReadMarks are the read marks of a thread list, by thread id.
+// A nil map means the visitor is not logged in and nothing is tracked.
+type ReadMarks map[int]ReadMark
+
+// Reading is tracked with one row per user and thread holding the last post read, plus a
+// read_all_at time on the user: everything posted before it counts as read. Marking all as
+// read moves that time and removes the rows of the user, so the table only ever holds the
+// threads read since then.
+
+// the time the user last marked everything as read, the zero time if never
+func (user *User) readAllAt() (at time.Time, err error) {
+	var readAll sql.NullTime
+	err = Db.QueryRow("SELECT read_all_at FROM users WHERE id = $1", user.Id).Scan(&readAll)
+	if readAll.Valid {
+		at = readAll.Time
+	}
+	return
+}
+
+// Get the read marks of the threads in a single query
+func (user *User) ReadMarks(threads []Thread) (marks ReadMarks, err error) {
+	marks = ReadMarks{}
+	if len(threads) == 0 {
+		return
+	}
+	readAll, err := user.readAllAt()
+	if err != nil {
+		return
+	}
+	args := []interface{}{user.Id, readAll}
+	for _, thread := range threads {
+		args = append(args, thread.Id)
+	}
+	rows, err := Db.Query(`SELECT threads.id, thread_reads.thread_id IS NOT NULL OR threads.created_at <= $2,
+		(SELECT count(*) FROM posts WHERE posts.thread_id = threads.id AND posts.id > coalesce(thread_reads.last_read_post_id, 0) AND posts.created_at > $2
+			AND posts.deleted_at IS NULL AND posts.hidden_at IS NULL)
+		FROM threads LEFT JOIN thread_reads ON thread_reads.thread_id = threads.id AND thread_reads.user_id = $1
+		WHERE threads.id IN (`+placeholders(3, len(threads))+`)`, args...)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var id int
+		var mark ReadMark
+		if err = rows.Scan(&id, &mark.Seen, &mark.Unread); err != nil {
+			rows.Close()
+			return
+		}
+		marks[id] = mark
+	}
+	rows.Close()
+	return
+}
+
+// Get the id of the first visible post of the thread the user has not read, 0 if all are read
+func (user *User) FirstUnreadPost(thread Thread) (id int, err error) {
+	readAll, err := user.readAllAt()
+	if err != nil {
+		return
+	}
+	err = Db.QueryRow(`SELECT coalesce(min(posts.id), 0) FROM posts WHERE posts.thread_id = $1 AND posts.created_at > $3
+		AND posts.deleted_at IS NULL AND posts.hidden_at IS NULL AND posts.id > coalesce((SELECT last_read_post_id FROM thread_reads WHERE user_id = $2 AND thread_id = $1), 0)`,
+		thread.Id, user.Id, readAll).Scan(&id)
+	return
+}
+
+// Record that the user read the thread up to the post, the marker never moves back
+func (user *User) MarkThreadRead(thread Thread, lastPostId int) (err error) {
+	_, err = Db.Exec(`insert into thread_reads (user_id, thread_id, last_read_post_id, read_at) values ($1, $2, $3, $4)
+		on conflict (user_id, thread_id) do update set last_read_post_id = excluded.last_read_post_id, read_at = excluded.read_at
+		where thread_reads.last_read_post_id <= excluded.last_read_post_id`, user.Id, thread.Id, lastPostId, time.Now())
+	return
+}
+
+// Mark every thread as read
+func (user *User) MarkAllRead() (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("update users set read_all_at = $2 where id = $1", user.Id, time.Now()); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from thread_reads where user_id = $1", user.Id); err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package models
+
+import "testing"
+
+// the unread counts only take the posts the reader can see
+func TestReadMarksCountVisiblePosts(t *testing.T) {
+	setupDB(t)
+	author, reader := createUser(t, "author"), createUser(t, "reader")
+	thread, err := author.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := author.CreatePost(thread, "read", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.MarkThreadRead(thread, read.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// posts the reader does not see come first, the visible one last
+	deleted, _ := author.CreatePost(thread, "deleted", Hold{})
+	if err := deleted.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	hidden, _ := author.CreatePost(thread, "hidden", Hold{})
+	if _, err := Db.Exec("update posts set hidden_at = current_timestamp, hidden_reason = $2 where id = $1", hidden.Id, HiddenByModerator); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := author.CreatePost(thread, "held", Hold{Held: true, Score: 1}); err != nil {
+		t.Fatal(err)
+	}
+	visible, _ := author.CreatePost(thread, "visible", Hold{})
+
+	marks, err := reader.ReadMarks([]Thread{thread})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark := marks[thread.Id]; !mark.Seen || mark.Unread != 1 {
+		t.Errorf("read mark %+v, want seen with the one visible post unread", mark)
+	}
+	if id, err := reader.FirstUnreadPost(thread); id != visible.Id || err != nil {
+		t.Errorf("first unread post %d, %v, want the visible post %d", id, err, visible.Id)
+	}
+
+	// the posts come in order, the last one is where the reader stops
+	posts, err := thread.Posts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(posts); i++ {
+		if posts[i].Id < posts[i-1].Id {
+			t.Fatalf("post %d comes after post %d", posts[i].Id, posts[i-1].Id)
+		}
+	}
+	if err := reader.MarkThreadRead(thread, posts[len(posts)-1].Id); err != nil {
+		t.Fatal(err)
+	}
+	if marks, _ := reader.ReadMarks([]Thread{thread}); marks[thread.Id].Unread != 0 {
+		t.Errorf("%d posts unread after reading the thread", marks[thread.Id].Unread)
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"database/sql"
+	"html/template"
+
+	"github.com/taewony/go-fullstack-webapp/internal/markdown"
+)
+
+// Get the post body rendered from markdown, the HTML is cached with the
+// current revision so it is only rendered once per edit
+func (post *Post) BodyHTML() (html string) {
+	var revId int
+	var cached sql.NullString
+	err := Db.QueryRow("SELECT id, body_html FROM post_revisions WHERE post_id = $1 ORDER BY id DESC LIMIT 1", post.Id).
+		Scan(&revId, &cached)
+	if err == nil && cached.Valid {
+		return cached.String
+	}
+	html, err = markdown.RenderWithMentions(post.Body, post.mentionResolver())
+	if err != nil {
+		return template.HTMLEscapeString(post.Body)
+	}
+	if revId != 0 {
+		Db.Exec("update post_revisions set body_html = $2 where id = $1", revId, html)
+	}
+	return
+}
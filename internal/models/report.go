@@ -0,0 +1,402 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReportReason is why a member flagged a thread or a post
+type ReportReason string
+
+const (
+	ReasonSpam       ReportReason = "spam"
+	ReasonHarassment ReportReason = "harassment"
+	ReasonOffTopic   ReportReason = "off_topic"
+	ReasonIllegal    ReportReason = "illegal"
+	ReasonOther      ReportReason = "other"
+)
+
+// all the reasons, in the order shown on the report form
+func ReportReasons() []ReportReason {
+	return []ReportReason{ReasonSpam, ReasonHarassment, ReasonOffTopic, ReasonIllegal, ReasonOther}
+}
+
+// what the report form says about each reason
+func (reason ReportReason) Description() string {
+	switch reason {
+	case ReasonSpam:
+		return "Spam or advertising"
+	case ReasonHarassment:
+		return "Harassment or hate"
+	case ReasonOffTopic:
+		return "Off-topic"
+	case ReasonIllegal:
+		return "Illegal content"
+	case ReasonOther:
+		return "Something else"
+	}
+	return string(reason)
+}
+
+// parse a reason coming from the report form
+func ParseReportReason(name string) (reason ReportReason, err error) {
+	for _, r := range ReportReasons() {
+		if string(r) == name {
+			return r, nil
+		}
+	}
+	err = fmt.Errorf("unknown report reason %q", name)
+	return
+}
+
+// ReportTarget is the kind of content a report is about
+type ReportTarget string
+
+const (
+	TargetThread ReportTarget = "thread"
+	TargetPost   ReportTarget = "post"
+)
+
+// Resolution is what a moderator did about the reports of a thread or post
+type Resolution string
+
+const (
+	// the content is fine, it is shown again if the reports hid it, not when it is held or a
+	// moderator hid it
+	ResolveDismiss Resolution = "dismissed"
+	ResolveHide    Resolution = "hidden"
+	ResolveDelete  Resolution = "deleted"
+	// the author gets a warning by mail, the content stays as it is
+	ResolveWarn Resolution = "warned"
+)
+
+// parse a resolution coming from the moderation queue
+func ParseResolution(name string) (resolution Resolution, err error) {
+	switch resolution = Resolution(name); resolution {
+	case ResolveDismiss, ResolveHide, ResolveDelete, ResolveWarn:
+		return
+	}
+	err = fmt.Errorf("unknown resolution %q", name)
+	return
+}
+
+// HideReason is why a thread or post is hidden, each way of showing it again only undoes
+// its own reason: dismissing the reports does not show content held as spam or hidden by
+// a moderator
+type HideReason string
+
+const (
+	HiddenByReports   HideReason = "reports"
+	HiddenByModerator HideReason = "moderator"
+	HiddenHeld        HideReason = "held"
+)
+
+// content is hidden once this many different users reported it, zero never hides it
+var ReportHideThreshold = 3
+
+const MaxReportDetailLength = 1000
+
+var (
+	ErrAlreadyReported = errors.New("you already reported this")
+	ErrDetailTooLong   = errors.New("the details are too long")
+	ErrNoOpenReports   = errors.New("there are no open reports on this")
+)
+
+type Report struct {
+	Id         int
+	UserId     int
+	TargetKind ReportTarget
+	TargetId   int
+	Reason     ReportReason
+	Detail     string
+	CreatedAt  time.Time
+	// set once a moderator dealt with the reported content
+	ResolvedAt sql.NullTime
+	ResolvedBy sql.NullInt64
+	Resolution Resolution
+	Note       string
+}
+
+const reportColumns = "id, user_id, target_kind, target_id, reason, detail, created_at, resolved_at, resolved_by, resolution, note"
+
+func (report *Report) scan(row scanner) error {
+	return row.Scan(&report.Id, &report.UserId, &report.TargetKind, &report.TargetId, &report.Reason, &report.Detail, &report.CreatedAt,
+		&report.ResolvedAt, &report.ResolvedBy, &report.Resolution, &report.Note)
+}
+
+// Get the name of the user who sent the report
+func (report *Report) UserName() (name string) {
+	Db.QueryRow("SELECT name FROM users WHERE id = $1", report.UserId).Scan(&name)
+	return
+}
+
+// Get the name of the moderator who resolved the report
+func (report *Report) ResolverName() (name string) {
+	Db.QueryRow("SELECT name FROM users WHERE id = $1", report.ResolvedBy.Int64).Scan(&name)
+	return
+}
+
+// ReportedItem is a thread or a post with its open reports, as listed in the moderation queue
+type ReportedItem struct {
+	Kind   ReportTarget
+	Thread Thread
+	// only set for posts
+	Post    Post
+	Reports []Report
+}
+
+// the uuid of the reported thread or post, used in the URLs of the queue
+func (item *ReportedItem) Uuid() string {
+	if item.Kind == TargetPost {
+		return item.Post.Uuid
+	}
+	return item.Thread.Uuid
+}
+
+// the user who wrote the reported thread or post
+func (item *ReportedItem) Author() User {
+	if item.Kind == TargetPost {
+		return item.Post.User()
+	}
+	return item.Thread.User()
+}
+
+// the topic of the reported thread or the body of the reported post
+func (item *ReportedItem) Text() string {
+	if item.Kind == TargetPost {
+		return item.Post.Body
+	}
+	return item.Thread.Topic
+}
+
+func (item *ReportedItem) IsHidden() bool {
+	if item.Kind == TargetPost {
+		return item.Post.IsHidden()
+	}
+	return item.Thread.IsHidden()
+}
+
+func (item *ReportedItem) targetId() int {
+	if item.Kind == TargetPost {
+		return item.Post.Id
+	}
+	return item.Thread.Id
+}
+
+// the table of the reported content
+func (kind ReportTarget) table() string {
+	if kind == TargetPost {
+		return "posts"
+	}
+	return "threads"
+}
+
+// Report a thread, hidden is true when this report hid it
+func (user *User) ReportThread(thread Thread, reason ReportReason, detail string) (hidden bool, err error) {
+	return user.report(TargetThread, thread.Id, reason, detail)
+}
+
+// Report a post, hidden is true when this report hid it
+func (user *User) ReportPost(post Post, reason ReportReason, detail string) (hidden bool, err error) {
+	return user.report(TargetPost, post.Id, reason, detail)
+}
+
+// add the report and hide the content once enough different users reported it
+func (user *User) report(kind ReportTarget, id int, reason ReportReason, detail string) (hidden bool, err error) {
+	if len(detail) > MaxReportDetailLength {
+		return false, ErrDetailTooLong
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// a user has a single open report per content, the unique index keeps it so
+	result, err := tx.Exec(`insert into reports (user_id, target_kind, target_id, reason, detail, created_at) values ($1, $2, $3, $4, $5, $6)
+		on conflict do nothing`, user.Id, kind, id, reason, detail, time.Now())
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return false, ErrAlreadyReported
+	}
+	if ReportHideThreshold > 0 {
+		var reporters int
+		err = tx.QueryRow("SELECT count(DISTINCT user_id) FROM reports WHERE target_kind = $1 AND target_id = $2 AND resolved_at IS NULL",
+			kind, id).Scan(&reporters)
+		if err != nil {
+			return
+		}
+		if reporters >= ReportHideThreshold {
+			result, err = tx.Exec("update "+kind.table()+" set hidden_at = $2, hidden_reason = $3 where id = $1 and hidden_at is null",
+				id, time.Now(), HiddenByReports)
+			if err != nil {
+				return
+			}
+			count, _ := result.RowsAffected()
+			hidden = count > 0
+			if hidden && kind == TargetPost {
+				var threadId int
+				if err = tx.QueryRow("SELECT thread_id FROM posts WHERE id = $1", id).Scan(&threadId); err != nil {
+					return
+				}
+				if err = recountPosts(tx, threadId); err != nil {
+					return
+				}
+			}
+		}
+	}
+	err = tx.Commit()
+	return
+}
+
+// Count the threads and posts waiting in the moderation queue
+func OpenReportCount() (count int) {
+	Db.QueryRow("SELECT count(*) FROM (SELECT DISTINCT target_kind, target_id FROM reports WHERE resolved_at IS NULL) AS open").Scan(&count)
+	return
+}
+
+// Get the reported threads and posts with open reports, the most reported first and then the longest waiting
+func ReportQueue(limit int) (items []ReportedItem, err error) {
+	rows, err := Db.Query(`SELECT target_kind, target_id FROM reports WHERE resolved_at IS NULL
+		GROUP BY target_kind, target_id ORDER BY count(*) DESC, min(created_at) LIMIT $1`, limit)
+	if err != nil {
+		return
+	}
+	type target struct {
+		kind ReportTarget
+		id   int
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err = rows.Scan(&t.kind, &t.id); err != nil {
+			rows.Close()
+			return
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	for _, t := range targets {
+		var item ReportedItem
+		if item, err = reportedItem(t.kind, t.id); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+// Get the thread or post with the uuid and its open reports
+func ReportedItemByUUID(kind ReportTarget, uuid string) (item ReportedItem, err error) {
+	var id int
+	err = Db.QueryRow("SELECT id FROM "+kind.table()+" WHERE uuid = $1", uuid).Scan(&id)
+	if err != nil {
+		return
+	}
+	return reportedItem(kind, id)
+}
+
+func reportedItem(kind ReportTarget, id int) (item ReportedItem, err error) {
+	item.Kind = kind
+	if kind == TargetPost {
+		if err = item.Post.scan(Db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = $1", id)); err != nil {
+			return
+		}
+		id = item.Post.ThreadId
+	}
+	if err = item.Thread.scan(Db.QueryRow("SELECT "+threadColumns+" FROM threads WHERE id = $1", id)); err != nil {
+		return
+	}
+	rows, err := Db.Query("SELECT "+reportColumns+" FROM reports WHERE target_kind = $1 AND target_id = $2 AND resolved_at IS NULL ORDER BY created_at",
+		kind, item.targetId())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		report := Report{}
+		if err = report.scan(rows); err != nil {
+			return
+		}
+		item.Reports = append(item.Reports, report)
+	}
+	err = rows.Err()
+	return
+}
+
+// Resolve the open reports of the item, applying the resolution to the content in the same transaction.
+// The reports keep who resolved them, how and why, as the log of the moderation.
+func (item *ReportedItem) Resolve(resolution Resolution, moderator User, note string) (err error) {
+	if len(note) > MaxReportDetailLength {
+		return ErrDetailTooLong
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	table, id := item.Kind.table(), item.targetId()
+	switch resolution {
+	case ResolveDismiss:
+		_, err = tx.Exec("update "+table+" set hidden_at = NULL, hidden_reason = '' where id = $1 and hidden_reason = $2", id, HiddenByReports)
+	case ResolveHide:
+		// held content stays held, the review of the hold decides about it
+		_, err = tx.Exec("update "+table+" set hidden_at = coalesce(hidden_at, $2), hidden_reason = $3 where id = $1 and hidden_reason != $4",
+			id, now, HiddenByModerator, HiddenHeld)
+	case ResolveDelete:
+		_, err = tx.Exec("update "+table+" set deleted_at = coalesce(deleted_at, $2) where id = $1", id, now)
+	}
+	if err != nil {
+		return
+	}
+	if item.Kind == TargetPost {
+		if err = recountPosts(tx, item.Post.ThreadId); err != nil {
+			return
+		}
+	}
+	result, err := tx.Exec(`update reports set resolved_at = $3, resolved_by = $4, resolution = $5, note = $6
+		where target_kind = $1 and target_id = $2 and resolved_at is null`, item.Kind, id, now, moderator.Id, resolution, note)
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNoOpenReports
+	}
+	return tx.Commit()
+}
+
+// Get the latest resolved reports, the log of the moderation
+func ResolvedReports(limit int) (reports []Report, err error) {
+	rows, err := Db.Query("SELECT "+reportColumns+" FROM reports WHERE resolved_at IS NOT NULL ORDER BY resolved_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		report := Report{}
+		if err = report.scan(rows); err != nil {
+			return
+		}
+		reports = append(reports, report)
+	}
+	err = rows.Err()
+	return
+}
+
+// the link to the reported thread or post
+func (report *Report) Target() string {
+	if report.TargetKind == TargetPost {
+		post := Post{Id: report.TargetId}
+		Db.QueryRow("SELECT thread_id, uuid FROM posts WHERE id = $1", report.TargetId).Scan(&post.ThreadId, &post.Uuid)
+		return post.Link()
+	}
+	var uuid string
+	Db.QueryRow("SELECT uuid FROM threads WHERE id = $1", report.TargetId).Scan(&uuid)
+	return "/thread/" + uuid
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// whether the content is hidden and why
+func hiddenState(t *testing.T, kind ReportTarget, id int) (hidden bool, reason HideReason) {
+	t.Helper()
+	err := Db.QueryRow("SELECT hidden_at IS NOT NULL, hidden_reason FROM "+kind.table()+" WHERE id = $1", id).Scan(&hidden, &reason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// the count of the thread against its visible posts
+func checkNumPosts(t *testing.T, name string, threadId int) {
+	t.Helper()
+	var counted, visible int
+	Db.QueryRow("SELECT num_posts FROM threads WHERE id = $1", threadId).Scan(&counted)
+	Db.QueryRow("SELECT count(*) FROM posts WHERE thread_id = $1 AND deleted_at IS NULL AND hidden_at IS NULL", threadId).Scan(&visible)
+	if counted != visible {
+		t.Errorf("%s: the thread counts %d posts, %d are visible", name, counted, visible)
+	}
+}
+
+func TestReportHidesAtTheThreshold(t *testing.T) {
+	setupDB(t)
+	author := createUser(t, "author")
+	thread, err := author.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := author.CreatePost(thread, "reported", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reporters []User
+	for i := 0; i <= ReportHideThreshold; i++ {
+		reporters = append(reporters, createUser(t, "reporter"+strconv.Itoa(i)))
+	}
+
+	if _, err := reporters[0].ReportPost(post, ReasonSpam, strings.Repeat("x", MaxReportDetailLength+1)); err != ErrDetailTooLong {
+		t.Errorf("a long detail gave %v", err)
+	}
+	for i, reporter := range reporters[:ReportHideThreshold-1] {
+		if hidden, err := reporter.ReportPost(post, ReasonSpam, ""); hidden || err != nil {
+			t.Fatalf("report %d: hidden %v, %v", i+1, hidden, err)
+		}
+	}
+	// a second report of the same user does not count
+	if _, err := reporters[0].ReportPost(post, ReasonOther, ""); err != ErrAlreadyReported {
+		t.Errorf("a second report of the same user gave %v", err)
+	}
+	if hidden, _ := hiddenState(t, TargetPost, post.Id); hidden {
+		t.Fatal("hidden below the threshold")
+	}
+	if hidden, err := reporters[ReportHideThreshold-1].ReportPost(post, ReasonSpam, ""); !hidden || err != nil {
+		t.Fatalf("the report reaching the threshold: hidden %v, %v", hidden, err)
+	}
+	if hidden, reason := hiddenState(t, TargetPost, post.Id); !hidden || reason != HiddenByReports {
+		t.Errorf("hidden %v by %q, want hidden by the reports", hidden, reason)
+	}
+	checkNumPosts(t, "hidden by the reports", thread.Id)
+	if hidden, err := reporters[ReportHideThreshold].ReportPost(post, ReasonSpam, ""); hidden || err != nil {
+		t.Errorf("a report past the threshold: hidden %v, %v", hidden, err)
+	}
+	if OpenReportCount() != 1 {
+		t.Errorf("%d items in the queue, want 1", OpenReportCount())
+	}
+}
+
+func TestResolve(t *testing.T) {
+	setupDB(t)
+	author := createUser(t, "author")
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+	var reporters []User
+	for i := 0; i < ReportHideThreshold; i++ {
+		reporters = append(reporters, createUser(t, "reporter"+strconv.Itoa(i)))
+	}
+	thread, err := author.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := func(kind ReportTarget, id, count int) {
+		t.Helper()
+		for _, reporter := range reporters[:count] {
+			if _, err := reporter.report(kind, id, ReasonSpam, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	resolve := func(kind ReportTarget, uuid string, resolution Resolution) error {
+		item, err := ReportedItemByUUID(kind, uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return item.Resolve(resolution, moderator, "")
+	}
+
+	// how the content gets to its state, with open reports
+	states := map[string]func(kind ReportTarget, id int, uuid string){
+		"visible": func(kind ReportTarget, id int, uuid string) { report(kind, id, 1) },
+		"hidden by the reports": func(kind ReportTarget, id int, uuid string) {
+			report(kind, id, ReportHideThreshold)
+		},
+		// created held by the spam checks
+		"held": func(kind ReportTarget, id int, uuid string) { report(kind, id, ReportHideThreshold) },
+		"hidden by a moderator": func(kind ReportTarget, id int, uuid string) {
+			report(kind, id, 1)
+			if err := resolve(kind, uuid, ResolveHide); err != nil {
+				t.Fatal(err)
+			}
+			report(kind, id, ReportHideThreshold)
+		},
+	}
+
+	tests := []struct {
+		kind       ReportTarget
+		state      string
+		resolution Resolution
+		hidden     bool
+		reason     HideReason
+	}{
+		{TargetPost, "visible", ResolveDismiss, false, ""},
+		{TargetPost, "hidden by the reports", ResolveDismiss, false, ""},
+		{TargetThread, "hidden by the reports", ResolveDismiss, false, ""},
+		{TargetPost, "held", ResolveDismiss, true, HiddenHeld},
+		{TargetThread, "held", ResolveDismiss, true, HiddenHeld},
+		{TargetPost, "hidden by a moderator", ResolveDismiss, true, HiddenByModerator},
+		{TargetPost, "visible", ResolveHide, true, HiddenByModerator},
+		{TargetPost, "hidden by the reports", ResolveHide, true, HiddenByModerator},
+		{TargetPost, "held", ResolveHide, true, HiddenHeld},
+		{TargetPost, "hidden by the reports", ResolveWarn, true, HiddenByReports},
+		{TargetPost, "visible", ResolveWarn, false, ""},
+		{TargetPost, "visible", ResolveDelete, false, ""},
+	}
+	for _, test := range tests {
+		name := string(test.kind) + " " + test.state + ", " + string(test.resolution)
+		hold := Hold{Held: test.state == "held", Score: 1}
+		var id int
+		var uuid string
+		if test.kind == TargetPost {
+			post, err := author.CreatePost(thread, name, hold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, uuid = post.Id, post.Uuid
+		} else {
+			target, err := author.CreateThread(Category{Id: 1}, name, hold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, uuid = target.Id, target.Uuid
+		}
+		states[test.state](test.kind, id, uuid)
+		if err := resolve(test.kind, uuid, test.resolution); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if hidden, reason := hiddenState(t, test.kind, id); hidden != test.hidden || reason != test.reason {
+			t.Errorf("%s: hidden %v by %q, want %v by %q", name, hidden, reason, test.hidden, test.reason)
+		}
+		checkNumPosts(t, name, thread.Id)
+		if err := resolve(test.kind, uuid, test.resolution); err != ErrNoOpenReports {
+			t.Errorf("%s: resolved twice, %v", name, err)
+		}
+		if test.state == "held" {
+			// the review of the hold shows the content the reports did not change
+			item, err := HeldItemByUUID(test.kind, uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := item.Review(HoldApproved, moderator); err != nil {
+				t.Fatal(err)
+			}
+			if hidden, reason := hiddenState(t, test.kind, id); hidden || reason != "" {
+				t.Errorf("%s, approved: hidden %v by %q", name, hidden, reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// how long authors may edit or delete what they wrote, moderators are not limited
+var EditWindow = 30 * time.Minute
+
+// Revision is a full copy of a post body (or a thread topic) as it was saved
+type Revision struct {
+	Id        int
+	Body      string
+	UserId    int
+	CreatedAt time.Time
+}
+
+func (rev *Revision) CreatedAtDate() string {
+	return rev.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
+}
+
+// Get the user name who saved this revision
+func (rev *Revision) UserName() string {
+	user := User{}
+	Db.QueryRow("SELECT id, uuid, name, email, created_at FROM users WHERE id = $1", rev.UserId).
+		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.CreatedAt)
+	return user.Name
+}
+
+func addPostRevision(tx *sql.Tx, postId int, body string, userId int, at time.Time) (err error) {
+	_, err = tx.Exec("insert into post_revisions (post_id, body, user_id, created_at) values ($1, $2, $3, $4)", postId, body, userId, at)
+	return
+}
+
+func addThreadRevision(tx *sql.Tx, threadId int, topic string, userId int, at time.Time) (err error) {
+	_, err = tx.Exec("insert into thread_revisions (thread_id, topic, user_id, created_at) values ($1, $2, $3, $4)", threadId, topic, userId, at)
+	return
+}
+
+// check if the user may edit or delete the post
+func (user *User) CanModifyPost(post Post) bool {
+	if user.Can(PermModerateContent) {
+		return true
+	}
+	return post.UserId == user.Id && !post.IsDeleted() && !post.IsHidden() && time.Since(post.CreatedAt) < EditWindow
+}
+
+// check if the user may edit or delete the thread
+func (user *User) CanModifyThread(thread Thread) bool {
+	if user.Can(PermModerateContent) {
+		return true
+	}
+	return thread.UserId == user.Id && !thread.IsDeleted() && !thread.IsHidden() && time.Since(thread.CreatedAt) < EditWindow
+}
+
+// Change the body of the post, keeping the new version as a revision. A held edit hides
+// the post until a moderator approved it.
+func (post *Post) Edit(editor User, body string, hold Hold) (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err = tx.Exec("update posts set body = $2, edited_at = $3 where id = $1", post.Id, body, now); err != nil {
+		return
+	}
+	if err = addPostRevision(tx, post.Id, body, editor.Id, now); err != nil {
+		return
+	}
+	if err = saveMentions(tx, post.Id, body); err != nil {
+		return
+	}
+	if err = hold.holdEdit(tx, TargetPost, post.Id, now); err != nil {
+		return
+	}
+	if hold.Held {
+		if err = recountPosts(tx, post.ThreadId); err != nil {
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	post.Body = body
+	post.EditedAt = sql.NullTime{Time: now, Valid: true}
+	if hold.Held && !post.HeldAt.Valid {
+		post.HeldAt = sql.NullTime{Time: now, Valid: true}
+	}
+	if hold.Held && !post.HiddenAt.Valid {
+		post.HiddenAt = sql.NullTime{Time: now, Valid: true}
+	}
+	return
+}
+
+// Change the topic of the thread, keeping the new version as a revision. A held edit hides
+// the thread until a moderator approved it.
+func (thread *Thread) Edit(editor User, topic string, hold Hold) (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err = tx.Exec("update threads set topic = $2, edited_at = $3 where id = $1", thread.Id, topic, now); err != nil {
+		return
+	}
+	if err = addThreadRevision(tx, thread.Id, topic, editor.Id, now); err != nil {
+		return
+	}
+	if err = hold.holdEdit(tx, TargetThread, thread.Id, now); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	thread.Topic = topic
+	thread.EditedAt = sql.NullTime{Time: now, Valid: true}
+	if hold.Held && !thread.HeldAt.Valid {
+		thread.HeldAt = sql.NullTime{Time: now, Valid: true}
+	}
+	if hold.Held && !thread.HiddenAt.Valid {
+		thread.HiddenAt = sql.NullTime{Time: now, Valid: true}
+	}
+	return
+}
+
+// get all the revisions of the post, oldest first
+func (post *Post) Revisions() (revs []Revision, err error) {
+	return revisions("SELECT id, body, user_id, created_at FROM post_revisions WHERE post_id = $1 ORDER BY id", post.Id)
+}
+
+// get all the revisions of the thread topic, oldest first
+func (thread *Thread) Revisions() (revs []Revision, err error) {
+	return revisions("SELECT id, topic, user_id, created_at FROM thread_revisions WHERE thread_id = $1 ORDER BY id", thread.Id)
+}
+
+func revisions(query string, id int) (revs []Revision, err error) {
+	rows, err := Db.Query(query, id)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		rev := Revision{}
+		if err = rows.Scan(&rev.Id, &rev.Body, &rev.UserId, &rev.CreatedAt); err != nil {
+			rows.Close()
+			return
+		}
+		revs = append(revs, rev)
+	}
+	rows.Close()
+	return
+}
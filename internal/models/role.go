@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Role is the privilege level attached to every user
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is a single capability granted by a role
+type Permission string
+
+const (
+	PermModerateContent Permission = "moderate_content"
+	PermManageUsers     Permission = "manage_users"
+)
+
+// roles ordered from the least to the most privileged
+var roleRanks = map[Role]int{
+	RoleMember:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// permissions granted by each role
+var rolePermissions = map[Role][]Permission{
+	RoleMember:    {},
+	RoleModerator: {PermModerateContent},
+	RoleAdmin:     {PermModerateContent, PermManageUsers},
+}
+
+// all the roles, from the least to the most privileged
+func Roles() []Role {
+	return []Role{RoleMember, RoleModerator, RoleAdmin}
+}
+
+// parse a role name coming from a form or the command line
+func ParseRole(name string) (role Role, err error) {
+	role = Role(name)
+	if _, ok := roleRanks[role]; !ok {
+		err = fmt.Errorf("unknown role %q", name)
+	}
+	return
+}
+
+// check if the user holds the given role or a more privileged one
+func (user *User) HasRole(role Role) bool {
+	rank, ok := roleRanks[user.Role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[role]
+}
+
+// check if the user's role grants the given permission
+func (user *User) Can(perm Permission) bool {
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Change the role of the user
+func (user *User) SetRole(role Role) (err error) {
+	statement := "update users set role = $2 where id = $1"
+	stmt, err := Db.Prepare(statement)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(user.Id, role)
+	if err == nil {
+		user.Role = role
+	}
+	return
+}
+
+// Create the initial admin account, or promote it if the email is already registered.
+// The address comes from the operator so it counts as verified.
+func SeedAdmin(name, email, password string) (err error) {
+	user, err := UserByEmail(email)
+	if err != nil {
+		user = User{Name: name, Email: email, Password: password}
+		if err = user.Create(); err != nil {
+			return
+		}
+	}
+	if err = user.MarkVerified(); err != nil {
+		return
+	}
+	return user.SetRole(RoleAdmin)
+}
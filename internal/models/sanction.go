@@ -0,0 +1,80 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// a suspension lasts at least a day and at most this many, past that the user should be banned
+const MaxSuspensionDays = 365
+
+const MaxSanctionReasonLength = 500
+
+var (
+	ErrInvalidSuspension = errors.New("a suspension lasts from one day to a year")
+	ErrReasonTooLong     = errors.New("the reason is too long")
+	ErrNotSanctioned     = errors.New("the user is neither suspended nor banned")
+)
+
+func (user *User) IsBanned() bool {
+	return user.BannedAt.Valid
+}
+
+// check if the user is suspended right now, a suspension ends by itself
+func (user *User) IsSuspended() bool {
+	return user.SuspendedUntil.Valid && time.Now().Before(user.SuspendedUntil.Time)
+}
+
+// check if the user may log in, suspended and banned users may not
+func (user *User) CanLogIn() bool {
+	return !user.IsBanned() && !user.IsSuspended()
+}
+
+// Suspend the user for a number of days and log them out everywhere, origin is the admin doing it
+func (user *User) Suspend(days int, reason string, origin Origin) (err error) {
+	if days < 1 || days > MaxSuspensionDays {
+		return ErrInvalidSuspension
+	}
+	until := time.Now().AddDate(0, 0, days)
+	detail := "until " + until.Format(time.RFC3339) + ": " + reason
+	return user.sanction(AuditUserSuspended, sql.NullTime{Time: until, Valid: true}, sql.NullTime{}, reason, detail, origin)
+}
+
+// Ban the user for good and log them out everywhere, origin is the admin doing it
+func (user *User) Ban(reason string, origin Origin) (err error) {
+	return user.sanction(AuditUserBanned, sql.NullTime{}, sql.NullTime{Time: time.Now(), Valid: true}, reason, reason, origin)
+}
+
+// Lift the suspension or the ban of the user
+func (user *User) Reinstate(origin Origin) (err error) {
+	if !user.IsBanned() && !user.SuspendedUntil.Valid {
+		return ErrNotSanctioned
+	}
+	return user.sanction(AuditUserReinstated, sql.NullTime{}, sql.NullTime{}, "", "", origin)
+}
+
+// set the sanction of the user, drop their sessions and record the audit event in one transaction
+func (user *User) sanction(kind AuditKind, until, bannedAt sql.NullTime, reason, detail string, origin Origin) (err error) {
+	if len(reason) > MaxSanctionReasonLength {
+		return ErrReasonTooLong
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("update users set suspended_until = $2, banned_at = $3, sanction_reason = $4 where id = $1",
+		user.Id, until, bannedAt, reason); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from sessions where user_id = $1", user.Id); err != nil {
+		return
+	}
+	if err = commitAudit(tx, kind, origin, user.Id, "", detail); err != nil {
+		return
+	}
+	user.SuspendedUntil, user.BannedAt, user.SanctionReason = until, bannedAt, reason
+	return
+}
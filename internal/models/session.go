@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// how often the last seen time of a session is written, a write on every request is not needed
+var SessionSeenEvery = time.Minute
+
+// the browsers and systems told apart in Device, the first match wins so Edge and Chrome
+// come before Safari, whose name they also carry
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	systems = []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// Device names the browser and the system of the session from its user agent, like
+// "Firefox on Linux", for the user to recognize it
+func (session *Session) Device() string {
+	browser, system := "Unknown browser", ""
+	for _, b := range browsers {
+		if strings.Contains(session.UserAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(session.UserAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+// Records that the session was used, at most once per SessionSeenEvery
+func (session *Session) Touch() (err error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < SessionSeenEvery {
+		return
+	}
+	_, err = Db.Exec("update sessions set last_seen_at = $2 where id = $1", session.Id, now)
+	if err == nil {
+		session.LastSeenAt = now
+	}
+	return
+}
+
+// Get the logged in sessions of the user, the most recently used first
+func (user *User) Sessions() (sessions []Session, err error) {
+	rows, err := Db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND NOT partial ORDER BY last_seen_at DESC", user.Id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session := Session{}
+		if err = session.scan(rows); err != nil {
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	return
+}
+
+// Delete one session of the user, ok is false when the user has no such session
+func (user *User) DeleteSession(id int) (ok bool, err error) {
+	result, err := Db.Exec("delete from sessions where id = $1 and user_id = $2", id, user.Id)
+	if err != nil {
+		return
+	}
+	count, err := result.RowsAffected()
+	ok = count > 0
+	return
+}
+
+// Delete the sessions of the user except the one with the uuid, to log out the other devices
+func (user *User) DeleteOtherSessions(uuid string) (count int64, err error) {
+	result, err := Db.Exec("delete from sessions where user_id = $1 and uuid != $2", user.Id, uuid)
+	if err != nil {
+		return
+	}
+	return result.RowsAffected()
+}
+
+// Delete every session of the user, to log them out everywhere
+func (user *User) DeleteSessions() (count int64, err error) {
+	result, err := Db.Exec("delete from sessions where user_id = $1", user.Id)
+	if err != nil {
+		return
+	}
+	return result.RowsAffected()
+}
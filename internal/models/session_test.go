@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// a session of the user, as the browser holds it after logging in
+func createSession(t *testing.T, user User) Session {
+	t.Helper()
+	session, err := user.CreateSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestDeleteSession(t *testing.T) {
+	setupDB(t)
+	alice, bob := createUser(t, "alice"), createUser(t, "bob")
+	laptop, phone, bobs := createSession(t, alice), createSession(t, alice), createSession(t, bob)
+
+	tests := []struct {
+		name    string
+		session Session
+		deleted bool
+	}{
+		{"session of another user", bobs, false},
+		{"unknown session", Session{Id: bobs.Id + 100}, false},
+		{"own session", phone, true},
+		{"own session again", phone, false},
+	}
+	for _, test := range tests {
+		ok, err := alice.DeleteSession(test.session.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.deleted {
+			t.Errorf("%s: deleted %v, want %v", test.name, ok, test.deleted)
+		}
+	}
+	for _, session := range []Session{laptop, bobs} {
+		if valid, _ := session.Check(); !valid {
+			t.Errorf("the session %d was logged out", session.Id)
+		}
+	}
+	if valid, _ := phone.Check(); valid {
+		t.Error("the deleted session still works")
+	}
+
+	// logging out the other devices keeps this one and the sessions of other users
+	createSession(t, alice)
+	if count, err := alice.DeleteOtherSessions(laptop.Uuid); count != 1 || err != nil {
+		t.Errorf("logged out %d other sessions, %v", count, err)
+	}
+	if sessions, _ := alice.Sessions(); len(sessions) != 1 || sessions[0].Id != laptop.Id {
+		t.Errorf("%d sessions left", len(sessions))
+	}
+	if valid, _ := bobs.Check(); !valid {
+		t.Error("the session of another user was logged out")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	setupDB(t)
+	session := createSession(t, createUser(t, "alice"))
+	stored := func() (seen time.Time) {
+		t.Helper()
+		if err := Db.QueryRow("SELECT last_seen_at FROM sessions WHERE id = $1", session.Id).Scan(&seen); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	tests := []struct {
+		name string
+		// how long ago the session was last seen
+		ago     time.Duration
+		written bool
+	}{
+		{"just seen", 0, false},
+		{"seen within the period", SessionSeenEvery / 2, false},
+		{"seen a period ago", SessionSeenEvery + time.Second, true},
+	}
+	for _, test := range tests {
+		seen := time.Now().Add(-test.ago)
+		if _, err := Db.Exec("update sessions set last_seen_at = $2 where id = $1", session.Id, seen); err != nil {
+			t.Fatal(err)
+		}
+		session.LastSeenAt = seen
+		if err := session.Touch(); err != nil {
+			t.Fatal(err)
+		}
+		if written := !stored().Equal(seen); written != test.written {
+			t.Errorf("%s: written %v, want %v", test.name, written, test.written)
+		}
+		if test.written && time.Since(session.LastSeenAt) > time.Second {
+			t.Errorf("%s: last seen %v", test.name, session.LastSeenAt)
+		}
+	}
+}
@@ -1,5 +1,33 @@
+drop table spam_documents;
+drop table spam_tokens;
+drop table spam_holds;
+drop table reports;
+drop table audit_events;
+drop function audit_events_append_only();
+drop table audit_lock;
+drop table login_failures;
+drop table rate_limits;
+drop table login_attempts;
+drop table user_identities;
+drop table recovery_codes;
+drop table user_totp;
+drop table email_verifications;
+drop table password_resets;
+drop table outbox;
+drop table notification_preferences;
+drop table notifications;
+drop table post_mentions;
+drop table thread_subscriptions;
+drop table thread_reads;
+drop table thread_state_changes;
+drop table thread_tags;
+drop table tags;
+drop table attachments;
+drop table thread_revisions;
+drop table post_revisions;
 drop table posts;
 drop table threads;
+drop table categories;
 drop table sessions;
 drop table users;
 
@@ -8,9 +36,22 @@ create table users (
   id         serial primary key,
   uuid       varchar(64) not null unique,
   name       varchar(255),
+  handle     varchar(32) not null unique,
   email      varchar(255) not null unique,
   password   varchar(255) not null,
-  created_at timestamp not null   
+  role       varchar(32) not null default 'member',
+  created_at timestamp not null,
+  read_all_at timestamp,
+  email_verified_at timestamp,
+  bio        text not null default '',
+  avatar_key varchar(255) not null default '',
+  timezone   varchar(64) not null default '',
+  deletion_requested_at timestamp,
+  deletion_mode varchar(16) not null default '',
+  deleted_at timestamp,
+  suspended_until timestamp,
+  banned_at  timestamp,
+  sanction_reason text not null default ''
 );
 
 create table sessions (
@@ -18,22 +59,348 @@ create table sessions (
   uuid       varchar(64) not null unique,
   email      varchar(255),
   user_id    integer references users(id),
-  created_at timestamp not null   
+  created_at timestamp not null,
+  partial    boolean not null default false,
+  user_agent text not null default '',
+  ip         varchar(64) not null default '',
+  last_seen_at timestamp not null,
+  csrf_token varchar(64) not null default ''
+);
+
+create table categories (
+  id          serial primary key,
+  slug        varchar(64) not null unique,
+  name        varchar(255) not null,
+  description text not null default '',
+  position    integer not null default 0,
+  parent_id   integer references categories(id),
+  read_role   varchar(32) not null default '',
+  post_role   varchar(32) not null default 'member',
+  created_at  timestamp not null
 );
 
 create table threads (
+  id          serial primary key,
+  uuid        varchar(64) not null unique,
+  topic       text,
+  user_id     integer references users(id),
+  category_id integer not null references categories(id),
+  created_at  timestamp not null,
+  edited_at   timestamp,
+  deleted_at  timestamp,
+  pinned_at   timestamp,
+  locked_at   timestamp,
+  archived_at timestamp,
+  hidden_at   timestamp,
+  hidden_reason varchar(16) not null default '',
+  held_at     timestamp,
+  last_post_at timestamp not null,
+  num_posts   integer not null default 0,
+  hot_score   double precision not null default 0
+);
+
+create index threads_category_id on threads (category_id, created_at);
+create index threads_created_at on threads (created_at);
+create index threads_last_post_at on threads (last_post_at);
+create index threads_category_last_post_at on threads (category_id, last_post_at);
+create index threads_num_posts on threads (num_posts, last_post_at);
+create index threads_category_num_posts on threads (category_id, num_posts, last_post_at);
+create index threads_hot_score on threads (hot_score);
+create index threads_category_hot_score on threads (category_id, hot_score);
+create index threads_pinned_at on threads (pinned_at) where pinned_at is not null;
+create index threads_category_pinned_at on threads (category_id, pinned_at) where pinned_at is not null;
+
+create table posts (
   id         serial primary key,
   uuid       varchar(64) not null unique,
-  topic      text,
+  body       text,
   user_id    integer references users(id),
-  created_at timestamp not null       
+  thread_id  integer references threads(id),
+  created_at timestamp not null,
+  edited_at  timestamp,
+  deleted_at timestamp,
+  hidden_at  timestamp,
+  hidden_reason varchar(16) not null default '',
+  held_at    timestamp
 );
 
-create table posts (
+create index posts_thread_id on posts (thread_id, id);
+
+create table attachments (
+  id           serial primary key,
+  uuid         varchar(64) not null unique,
+  post_id      integer references posts(id),
+  user_id      integer references users(id),
+  filename     varchar(255) not null,
+  content_type varchar(255) not null,
+  size         bigint not null,
+  storage_key  varchar(255) not null,
+  thumb_key    varchar(255) not null default '',
+  created_at   timestamp not null
+);
+
+create index attachments_post_id on attachments (post_id);
+
+create table post_revisions (
   id         serial primary key,
-  uuid       varchar(64) not null unique,
+  post_id    integer references posts(id),
   body       text,
+  body_html  text,
   user_id    integer references users(id),
+  created_at timestamp not null
+);
+
+create index post_revisions_post_id on post_revisions (post_id);
+
+create table thread_revisions (
+  id         serial primary key,
   thread_id  integer references threads(id),
-  created_at timestamp not null  
+  topic      text,
+  user_id    integer references users(id),
+  created_at timestamp not null
+);
+
+create index thread_revisions_thread_id on thread_revisions (thread_id);
+
+create table tags (
+  id         serial primary key,
+  name       varchar(32) not null unique,
+  created_at timestamp not null
+);
+
+create table thread_tags (
+  thread_id  integer not null references threads(id),
+  tag_id     integer not null references tags(id),
+  primary key (thread_id, tag_id)
+);
+
+create index thread_tags_tag_id on thread_tags (tag_id);
+
+create table thread_state_changes (
+  id         serial primary key,
+  thread_id  integer not null references threads(id),
+  state      varchar(32) not null,
+  enabled    boolean not null,
+  user_id    integer references users(id),
+  created_at timestamp not null
+);
+
+create index thread_state_changes_thread_id on thread_state_changes (thread_id, state);
+
+create table thread_reads (
+  user_id           integer not null references users(id),
+  thread_id         integer not null references threads(id),
+  last_read_post_id integer not null default 0,
+  read_at           timestamp not null,
+  primary key (user_id, thread_id)
+);
+
+create table thread_subscriptions (
+  user_id    integer not null references users(id),
+  thread_id  integer not null references threads(id),
+  created_at timestamp not null,
+  primary key (user_id, thread_id)
+);
+
+create index thread_subscriptions_thread_id on thread_subscriptions (thread_id);
+
+create table notifications (
+  id         serial primary key,
+  user_id    integer not null references users(id),
+  kind       varchar(32) not null,
+  thread_id  integer not null references threads(id),
+  post_id    integer not null references posts(id),
+  actor_id   integer not null references users(id),
+  created_at timestamp not null,
+  read_at    timestamp
+);
+
+create index notifications_user_id on notifications (user_id, created_at);
+create index notifications_unread on notifications (user_id, read_at);
+
+create table notification_preferences (
+  user_id    integer not null references users(id),
+  kind       varchar(32) not null,
+  enabled    boolean not null,
+  primary key (user_id, kind)
+);
+
+create table post_mentions (
+  post_id    integer not null references posts(id),
+  user_id    integer not null references users(id),
+  handle     varchar(32) not null,
+  notified   boolean not null,
+  primary key (post_id, handle)
+);
+
+create index post_mentions_user_id on post_mentions (user_id);
+
+create table outbox (
+  id              serial primary key,
+  to_addr         varchar(255) not null,
+  subject         varchar(255) not null,
+  text_body       text not null,
+  html_body       text not null,
+  attempts        integer not null default 0,
+  next_attempt_at timestamp not null,
+  last_error      text,
+  sent_at         timestamp,
+  created_at      timestamp not null
+);
+
+create index outbox_pending on outbox (sent_at, next_attempt_at);
+
+create table password_resets (
+  id         serial primary key,
+  user_id    integer not null references users(id),
+  token_hash varchar(64) not null unique,
+  created_at timestamp not null,
+  expires_at timestamp not null,
+  used_at    timestamp
+);
+
+create index password_resets_user_id on password_resets (user_id, created_at);
+
+create table email_verifications (
+  id         serial primary key,
+  user_id    integer not null references users(id),
+  email      varchar(255) not null,
+  token_hash varchar(64) not null unique,
+  created_at timestamp not null,
+  expires_at timestamp not null,
+  used_at    timestamp
+);
+
+create index email_verifications_user_id on email_verifications (user_id, created_at);
+
+create table user_totp (
+  user_id      integer primary key references users(id),
+  secret       varchar(64) not null,
+  last_step    bigint,
+  created_at   timestamp not null,
+  confirmed_at timestamp
+);
+
+create table recovery_codes (
+  id         serial primary key,
+  user_id    integer not null references users(id),
+  code_hash  varchar(64) not null,
+  created_at timestamp not null,
+  used_at    timestamp
+);
+
+create index recovery_codes_user_id on recovery_codes (user_id, code_hash);
+
+create table user_identities (
+  id         serial primary key,
+  user_id    integer not null references users(id),
+  provider   varchar(64) not null,
+  subject    varchar(255) not null,
+  email      varchar(255) not null,
+  created_at timestamp not null,
+  unique (provider, subject)
+);
+
+create index user_identities_user_id on user_identities (user_id);
+
+create table login_attempts (
+  state_hash   varchar(64) primary key,
+  provider     varchar(64) not null,
+  nonce        varchar(64) not null,
+  verifier     varchar(64) not null,
+  link_user_id integer references users(id),
+  created_at   timestamp not null
+);
+
+create table rate_limits (
+  key          varchar(255) primary key,
+  tokens       double precision not null,
+  updated_unix double precision not null,
+  expires_at   timestamp not null
+);
+
+create index rate_limits_expires_at on rate_limits (expires_at);
+
+create table login_failures (
+  email          varchar(255) primary key,
+  failures       integer not null,
+  last_failed_at timestamp not null,
+  locked_until   timestamp
+);
+
+create table audit_events (
+  id         serial primary key,
+  kind       varchar(64) not null,
+  actor_id   integer references users(id),
+  user_id    integer references users(id),
+  target     varchar(255) not null,
+  ip         varchar(64) not null,
+  request_id varchar(64) not null,
+  detail     text not null,
+  created_at timestamp not null,
+  prev_hash  varchar(64) not null,
+  hash       varchar(64) not null unique
+);
+
+-- the single row the writers of the log lock to add their entry one at a time
+create table audit_lock (
+  id        integer primary key,
+  locked_at timestamp
+);
+
+insert into audit_lock (id) values (1);
+
+-- refuses updates and deletes of the rows, the SQLite triggers of InitDB do the same. It does
+-- not fire on TRUNCATE or once dropped, the hash chain shows those.
+create function audit_events_append_only() returns trigger as $$
+begin
+  raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_events_append_only before update or delete on audit_events
+  for each row execute procedure audit_events_append_only();
+
+create table reports (
+  id          serial primary key,
+  user_id     integer not null references users(id),
+  target_kind varchar(16) not null,
+  target_id   integer not null,
+  reason      varchar(32) not null,
+  detail      text not null default '',
+  created_at  timestamp not null,
+  resolved_at timestamp,
+  resolved_by integer references users(id),
+  resolution  varchar(16) not null default '',
+  note        text not null default ''
+);
+
+create unique index reports_open on reports (user_id, target_kind, target_id) where resolved_at is null;
+create index reports_target on reports (target_kind, target_id);
+create index reports_resolved_at on reports (resolved_at);
+
+create table spam_holds (
+  id          serial primary key,
+  target_kind varchar(16) not null,
+  target_id   integer not null,
+  score       real not null,
+  reasons     text not null,
+  created_at  timestamp not null,
+  reviewed_at timestamp,
+  reviewed_by integer references users(id),
+  decision    varchar(16) not null default ''
+);
+
+create index spam_holds_target on spam_holds (target_kind, target_id);
+create index spam_holds_reviewed_at on spam_holds (reviewed_at);
+
+create table spam_tokens (
+  token varchar(128) primary key,
+  spam  integer not null default 0,
+  ham   integer not null default 0
+);
+
+create table spam_documents (
+  class varchar(8) primary key,
+  count integer not null default 0
 );
\ No newline at end of file
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Hold is what the spam checks found about new content, held content waits for a moderator.
+// The zero Hold publishes the content right away.
+type Hold struct {
+	Held    bool
+	Score   float64
+	Reasons string
+}
+
+// HoldDecision is what a moderator decided about held content
+type HoldDecision string
+
+const (
+	// the content is fine, it is shown
+	HoldApproved HoldDecision = "approved"
+	// the content is spam, it is deleted
+	HoldSpam HoldDecision = "spam"
+)
+
+// parse a decision coming from the held queue
+func ParseHoldDecision(name string) (decision HoldDecision, err error) {
+	switch decision = HoldDecision(name); decision {
+	case HoldApproved, HoldSpam:
+		return
+	}
+	err = errors.New("unknown decision " + name)
+	return
+}
+
+var ErrNotHeld = errors.New("this is not waiting for a moderator")
+
+// why the new content is hidden, if it is
+func (hold Hold) hideReason() HideReason {
+	if hold.Held {
+		return HiddenHeld
+	}
+	return ""
+}
+
+// keep why the content is held, for the moderators
+func (hold Hold) save(tx *sql.Tx, kind ReportTarget, id int, now time.Time) (err error) {
+	if !hold.Held {
+		return
+	}
+	_, err = tx.Exec("insert into spam_holds (target_kind, target_id, score, reasons, created_at) values ($1, $2, $3, $4, $5)",
+		kind, id, hold.Score, hold.Reasons, now)
+	return
+}
+
+// hold the edited content, a moderator sees it again before it is shown. Content already
+// hidden keeps why it is, and content still waiting keeps the hold it has and the time of it.
+func (hold Hold) holdEdit(tx *sql.Tx, kind ReportTarget, id int, now time.Time) (err error) {
+	if !hold.Held {
+		return
+	}
+	_, err = tx.Exec(`update `+kind.table()+` set held_at = coalesce(held_at, $2),
+		hidden_reason = case when hidden_at is null then $3 else hidden_reason end,
+		hidden_at = coalesce(hidden_at, $2) where id = $1`, id, now, HiddenHeld)
+	if err != nil {
+		return
+	}
+	var open int
+	if err = tx.QueryRow("SELECT count(*) FROM spam_holds WHERE target_kind = $1 AND target_id = $2 AND reviewed_at IS NULL", kind, id).Scan(&open); err != nil || open > 0 {
+		return
+	}
+	return hold.save(tx, kind, id, now)
+}
+
+// HeldItem is a thread or a post waiting for a moderator, as listed in the held queue
+type HeldItem struct {
+	Kind   ReportTarget
+	Thread Thread
+	// only set for posts
+	Post      Post
+	Score     float64
+	Reasons   string
+	CreatedAt time.Time
+}
+
+// the uuid of the held thread or post, used in the URLs of the queue
+func (item *HeldItem) Uuid() string {
+	if item.Kind == TargetPost {
+		return item.Post.Uuid
+	}
+	return item.Thread.Uuid
+}
+
+// whether the held content was shown before, held for an edit rather than held when it was
+// posted: content held at once has the time it was posted
+func (item *HeldItem) IsEdit() bool {
+	if item.Kind == TargetPost {
+		return item.Post.HeldAt.Time.After(item.Post.CreatedAt)
+	}
+	return item.Thread.HeldAt.Time.After(item.Thread.CreatedAt)
+}
+
+// the user who wrote the held thread or post
+func (item *HeldItem) Author() User {
+	if item.Kind == TargetPost {
+		return item.Post.User()
+	}
+	return item.Thread.User()
+}
+
+// the topic of the held thread or the body of the held post, what the classifier learns from
+func (item *HeldItem) Text() string {
+	if item.Kind == TargetPost {
+		return item.Post.Body
+	}
+	return item.Thread.Topic
+}
+
+// Count the threads and posts waiting in the held queue
+func HeldCount() (count int) {
+	Db.QueryRow("SELECT count(*) FROM spam_holds WHERE reviewed_at IS NULL").Scan(&count)
+	return
+}
+
+// Get the threads and posts waiting for a moderator, the longest waiting first
+func HeldQueue(limit int) (items []HeldItem, err error) {
+	rows, err := Db.Query("SELECT target_kind, target_id FROM spam_holds WHERE reviewed_at IS NULL ORDER BY created_at LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	type target struct {
+		kind ReportTarget
+		id   int
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err = rows.Scan(&t.kind, &t.id); err != nil {
+			rows.Close()
+			return
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	for _, t := range targets {
+		var item HeldItem
+		if item, err = heldItem(t.kind, t.id); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+// Get the held thread or post with the uuid
+func HeldItemByUUID(kind ReportTarget, uuid string) (item HeldItem, err error) {
+	var id int
+	err = Db.QueryRow("SELECT id FROM "+kind.table()+" WHERE uuid = $1", uuid).Scan(&id)
+	if err != nil {
+		return
+	}
+	return heldItem(kind, id)
+}
+
+func heldItem(kind ReportTarget, id int) (item HeldItem, err error) {
+	item.Kind = kind
+	err = Db.QueryRow("SELECT score, reasons, created_at FROM spam_holds WHERE target_kind = $1 AND target_id = $2 AND reviewed_at IS NULL",
+		kind, id).Scan(&item.Score, &item.Reasons, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = ErrNotHeld
+	}
+	if err != nil {
+		return
+	}
+	if kind == TargetPost {
+		if err = item.Post.scan(Db.QueryRow("SELECT "+postColumns+" FROM posts WHERE id = $1", id)); err != nil {
+			return
+		}
+		id = item.Post.ThreadId
+	}
+	err = item.Thread.scan(Db.QueryRow("SELECT "+threadColumns+" FROM threads WHERE id = $1", id))
+	return
+}
+
+// Review the held item: approved content is shown, spam is deleted
+func (item *HeldItem) Review(decision HoldDecision, moderator User) (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	table, id := item.Kind.table(), item.Thread.Id
+	if item.Kind == TargetPost {
+		id = item.Post.Id
+	}
+	result, err := tx.Exec(`update spam_holds set reviewed_at = $3, reviewed_by = $4, decision = $5
+		where target_kind = $1 and target_id = $2 and reviewed_at is null`, item.Kind, id, now, moderator.Id, decision)
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotHeld
+	}
+	switch decision {
+	case HoldApproved:
+		// only the hold is lifted, content a moderator hid since stays hidden
+		_, err = tx.Exec(`update `+table+` set held_at = NULL,
+			hidden_at = case when hidden_reason = $2 then NULL else hidden_at end,
+			hidden_reason = case when hidden_reason = $2 then '' else hidden_reason end where id = $1`, id, HiddenHeld)
+	case HoldSpam:
+		_, err = tx.Exec("update "+table+" set held_at = NULL, deleted_at = coalesce(deleted_at, $2) where id = $1", id, now)
+	}
+	if err != nil {
+		return
+	}
+	// an approved post counts in its thread from now on
+	if item.Kind == TargetPost && decision == HoldApproved {
+		if _, err = tx.Exec("update threads set last_post_at = $2 where id = $1 and last_post_at < $2", item.Post.ThreadId, item.Post.CreatedAt); err != nil {
+			return
+		}
+		if err = recountPosts(tx, item.Post.ThreadId); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,92 @@
+package models
+
+import "testing"
+
+// an edit the spam checks hold hides the content until a moderator approves it
+func TestHeldEdit(t *testing.T) {
+	setupDB(t)
+	author := createUser(t, "author")
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+	thread, err := author.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	held := Hold{Held: true, Score: 1, Reasons: "test"}
+
+	tests := []struct {
+		kind  ReportTarget
+		state string
+		// after the held edit and after its approval
+		reason, approved HideReason
+		// whether it was shown before the edit was held
+		shown bool
+	}{
+		{TargetPost, "visible", HiddenHeld, "", true},
+		{TargetThread, "visible", HiddenHeld, "", true},
+		{TargetPost, "held", HiddenHeld, "", false},
+		{TargetThread, "held", HiddenHeld, "", false},
+		{TargetPost, "hidden by a moderator", HiddenByModerator, HiddenByModerator, true},
+		{TargetThread, "hidden by a moderator", HiddenByModerator, HiddenByModerator, true},
+	}
+	for _, test := range tests {
+		name := string(test.kind) + " " + test.state
+		hold := Hold{Held: test.state == "held", Score: 1}
+		var id int
+		var uuid string
+		var edit func(hold Hold) error
+		if test.kind == TargetPost {
+			post, err := author.CreatePost(thread, name, hold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, uuid = post.Id, post.Uuid
+			edit = func(hold Hold) error { return post.Edit(author, name+", edited", hold) }
+		} else {
+			target, err := author.CreateThread(Category{Id: 1}, name, hold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, uuid = target.Id, target.Uuid
+			edit = func(hold Hold) error { return target.Edit(author, name+", edited", hold) }
+		}
+		if test.state == "hidden by a moderator" {
+			if _, err := Db.Exec("update "+test.kind.table()+" set hidden_at = current_timestamp, hidden_reason = $2 where id = $1", id, HiddenByModerator); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// an edit the checks let through changes nothing
+		if err := edit(Hold{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := edit(held); err != nil {
+			t.Fatal(err)
+		}
+		if hidden, reason := hiddenState(t, test.kind, id); !hidden || reason != test.reason {
+			t.Errorf("%s, edited: hidden %v by %q, want hidden by %q", name, hidden, reason, test.reason)
+		}
+		checkNumPosts(t, name+", edited", thread.Id)
+		// each held content waits once in the queue
+		var open int
+		Db.QueryRow("SELECT count(*) FROM spam_holds WHERE target_kind = $1 AND target_id = $2 AND reviewed_at IS NULL", test.kind, id).Scan(&open)
+		if open != 1 {
+			t.Errorf("%s, edited: %d open holds, want 1", name, open)
+		}
+
+		item, err := HeldItemByUUID(test.kind, uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// content held when it was posted is announced once approved, even after an edit
+		if item.IsEdit() != test.shown {
+			t.Errorf("%s: held for an edit %v, want %v", name, item.IsEdit(), test.shown)
+		}
+		if err := item.Review(HoldApproved, moderator); err != nil {
+			t.Fatal(err)
+		}
+		if hidden, reason := hiddenState(t, test.kind, id); hidden != (test.approved != "") || reason != test.approved {
+			t.Errorf("%s, approved: hidden %v by %q, want %q", name, hidden, reason, test.approved)
+		}
+		checkNumPosts(t, name+", approved", thread.Id)
+	}
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tag is a free-form label put on threads, moderators can rename and merge them
+type Tag struct {
+	Id         int
+	Name       string
+	CreatedAt  time.Time
+	NumThreads int
+}
+
+// how many tags a thread may carry
+const MaxTagsPerThread = 5
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// NormalizeTag lowercases the name and joins words with dashes, "Go Lang" becomes "go-lang"
+func NormalizeTag(name string) (tag string, err error) {
+	tag = strings.Join(strings.Fields(strings.ToLower(name)), "-")
+	if len(tag) > 32 || !tagPattern.MatchString(tag) {
+		err = errors.New("tags may only contain letters, digits and dashes, up to 32 characters")
+	}
+	return
+}
+
+// ParseTags splits a comma separated list of tags, normalizing and removing duplicates
+func ParseTags(list string) (tags []string, err error) {
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		var tag string
+		if tag, err = NormalizeTag(name); err != nil {
+			return
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > MaxTagsPerThread {
+		err = errors.New("a thread can have at most 5 tags")
+	}
+	return
+}
+
+// Get the tags of the thread, alphabetically
+func (thread *Thread) Tags() (tags []Tag, err error) {
+	rows, err := Db.Query("SELECT tags.id, tags.name, tags.created_at FROM tags JOIN thread_tags ON thread_tags.tag_id = tags.id WHERE thread_tags.thread_id = $1 ORDER BY tags.name", thread.Id)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		tag := Tag{}
+		if err = rows.Scan(&tag.Id, &tag.Name, &tag.CreatedAt); err != nil {
+			rows.Close()
+			return
+		}
+		tags = append(tags, tag)
+	}
+	rows.Close()
+	return
+}
+
+// comma separated tag names, to fill in the edit form
+func (thread *Thread) TagList() string {
+	tags, _ := thread.Tags()
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Replace the tags of the thread, unknown tags are created
+func (thread *Thread) SetTags(names []string) (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("delete from thread_tags where thread_id = $1", thread.Id); err != nil {
+		return
+	}
+	for _, name := range names {
+		var id int
+		err = tx.QueryRow("SELECT id FROM tags WHERE name = $1", name).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow("insert into tags (name, created_at) values ($1, $2) returning id", name, time.Now()).Scan(&id)
+		}
+		if err != nil {
+			return
+		}
+		if _, err = tx.Exec("insert into thread_tags (thread_id, tag_id) values ($1, $2)", thread.Id, id); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// Get a tag by its name
+func TagByName(name string) (tag Tag, err error) {
+	err = Db.QueryRow("SELECT id, name, created_at FROM tags WHERE name = $1", name).Scan(&tag.Id, &tag.Name, &tag.CreatedAt)
+	return
+}
+
+// Get all tags with the number of threads using them, most used first
+func Tags() (tags []Tag, err error) {
+	rows, err := Db.Query(`SELECT tags.id, tags.name, tags.created_at, count(thread_tags.thread_id) FROM tags
+		LEFT JOIN thread_tags ON thread_tags.tag_id = tags.id GROUP BY tags.id, tags.name, tags.created_at ORDER BY count(thread_tags.thread_id) DESC, tags.name`)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		tag := Tag{}
+		if err = rows.Scan(&tag.Id, &tag.Name, &tag.CreatedAt, &tag.NumThreads); err != nil {
+			rows.Close()
+			return
+		}
+		tags = append(tags, tag)
+	}
+	rows.Close()
+	return
+}
+
+// Get the tags starting with the prefix, for autocompletion
+func TagsWithPrefix(prefix string, limit int) (names []string, err error) {
+	// escape the LIKE wildcards, tags never contain them but the prefix might
+	prefix = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := Db.Query(`SELECT name FROM tags WHERE name LIKE $1 ESCAPE '\' ORDER BY name LIMIT $2`, prefix+"%", limit)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	return
+}
+
+// Rename the tag, fails if the new name is already used (merge the tags instead)
+func (tag *Tag) Rename(name string) (err error) {
+	if name, err = NormalizeTag(name); err != nil {
+		return
+	}
+	if _, err = Db.Exec("update tags set name = $2 where id = $1", tag.Id, name); err != nil {
+		return
+	}
+	tag.Name = name
+	return
+}
+
+// Merge the tag into another one: its threads get the other tag and the tag is removed
+func (tag *Tag) MergeInto(into Tag) (err error) {
+	if tag.Id == into.Id {
+		return errors.New("cannot merge a tag into itself")
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// threads carrying both tags keep a single link
+	_, err = tx.Exec(`insert into thread_tags (thread_id, tag_id) select thread_id, $2 from thread_tags
+		where tag_id = $1 and thread_id not in (select thread_id from thread_tags where tag_id = $2)`, tag.Id, into.Id)
+	if err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from thread_tags where tag_id = $1", tag.Id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from tags where id = $1", tag.Id); err != nil {
+		return
+	}
+	return tx.Commit()
+}
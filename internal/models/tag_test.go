@@ -0,0 +1,115 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"go", "go", true},
+		{"Go Lang", "go-lang", true},
+		{"  web   dev  ", "web-dev", true},
+		{"go-1", "go-1", true},
+		{"", "", false},
+		{"c++", "", false},
+		{"-go", "", false},
+		{"go--lang", "", false},
+		{strings.Repeat("a", 33), "", false},
+	}
+	for _, test := range tests {
+		tag, err := NormalizeTag(test.name)
+		if (err == nil) != test.ok || (test.ok && tag != test.want) {
+			t.Errorf("NormalizeTag(%q) = %q, %v, want %q", test.name, tag, err, test.want)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+		ok   bool
+	}{
+		{"", nil, true},
+		{"go, Web Dev", []string{"go", "web-dev"}, true},
+		{"go, Go, GO ,", []string{"go"}, true},
+		{"a, b, c, d, e, a", []string{"a", "b", "c", "d", "e"}, true},
+		{"a, b, c, d, e, f", nil, false},
+		{"go, c++", nil, false},
+	}
+	for _, test := range tests {
+		tags, err := ParseTags(test.list)
+		if (err == nil) != test.ok || (test.ok && !slices.Equal(tags, test.want)) {
+			t.Errorf("ParseTags(%q) = %v, %v, want %v", test.list, tags, err, test.want)
+		}
+	}
+}
+
+// the names of the tags of the thread
+func tagNames(t *testing.T, thread Thread) (names []string) {
+	t.Helper()
+	tags, err := thread.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return
+}
+
+func TestRenameAndMergeTags(t *testing.T) {
+	setupDB(t)
+	author := createUser(t, "author")
+	threads := map[string]Thread{}
+	for topic, tags := range map[string][]string{"both": {"golang", "go"}, "golang": {"golang"}, "go": {"go"}} {
+		thread, err := author.CreateThread(Category{Id: 1}, topic, Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := thread.SetTags(tags); err != nil {
+			t.Fatal(err)
+		}
+		threads[topic] = thread
+	}
+
+	golang, _ := TagByName("golang")
+	goTag, _ := TagByName("go")
+	if err := golang.Rename("Go"); err == nil {
+		t.Error("renamed a tag to the name of another one")
+	}
+	if err := golang.Rename("bad name!"); err == nil {
+		t.Error("renamed a tag to an invalid name")
+	}
+	if err := golang.MergeInto(golang); err == nil {
+		t.Error("merged a tag into itself")
+	}
+	if err := golang.Rename("Go Lang"); err != nil || golang.Name != "go-lang" {
+		t.Fatalf("rename: %q, %v", golang.Name, err)
+	}
+	if names := tagNames(t, threads["golang"]); !slices.Equal(names, []string{"go-lang"}) {
+		t.Errorf("the renamed tag reads %v", names)
+	}
+
+	if err := golang.MergeInto(goTag); err != nil {
+		t.Fatal(err)
+	}
+	// the thread carrying both tags keeps a single one
+	for topic, thread := range threads {
+		if names := tagNames(t, thread); !slices.Equal(names, []string{"go"}) {
+			t.Errorf("%s: tags %v after the merge, want go", topic, names)
+		}
+	}
+	if _, err := TagByName("go-lang"); err == nil {
+		t.Error("the merged tag is still there")
+	}
+	tags, _ := Tags()
+	if len(tags) != 1 || tags[0].NumThreads != 3 {
+		t.Errorf("tags after the merge %+v, want go on 3 threads", tags)
+	}
+}
@@ -1,16 +1,31 @@
 package models
 
 import (
+	"database/sql"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Thread struct {
-	Id        int
-	Uuid      string
-	Topic     string
-	UserId    int
-	CreatedAt time.Time
+	Id         int
+	Uuid       string
+	Topic      string
+	UserId     int
+	CategoryId int
+	CreatedAt  time.Time
+	EditedAt   sql.NullTime
+	DeletedAt  sql.NullTime
+	PinnedAt   sql.NullTime
+	LockedAt   sql.NullTime
+	ArchivedAt sql.NullTime
+	// set by moderators or by enough reports, the thread shows a notice instead of its topic
+	HiddenAt sql.NullTime
+	// set when the spam checks held the thread for a moderator, it is hidden until approved
+	HeldAt sql.NullTime
+	// time of the latest post, the creation time until the first reply
+	LastPostAt time.Time
+	NumPosts   int
 }
 
 type Post struct {
@@ -20,6 +35,43 @@ type Post struct {
 	UserId    int
 	ThreadId  int
 	CreatedAt time.Time
+	EditedAt  sql.NullTime
+	DeletedAt sql.NullTime
+	// set by moderators or by enough reports, the post shows a notice instead of its body
+	HiddenAt sql.NullTime
+	// set when the spam checks held the post for a moderator, it is hidden until approved
+	HeldAt sql.NullTime
+}
+
+// shown in place of deleted threads and posts
+const Tombstone = "[deleted]"
+
+// shown in place of hidden threads and posts
+const HiddenNotice = "[hidden by the moderators]"
+
+// shown in place of threads and posts held by the spam checks
+const HeldNotice = "[waiting for a moderator]"
+
+// columns read by every thread and post query, in the order scanned below
+const threadColumns = "id, uuid, topic, user_id, category_id, created_at, edited_at, deleted_at, pinned_at, locked_at, archived_at, hidden_at, held_at, last_post_at, num_posts"
+const postColumns = "id, uuid, body, user_id, thread_id, created_at, edited_at, deleted_at, hidden_at, held_at"
+
+// both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (thread *Thread) scan(row scanner) error {
+	return row.Scan(&thread.Id, &thread.Uuid, &thread.Topic, &thread.UserId, &thread.CategoryId, &thread.CreatedAt, &thread.EditedAt, &thread.DeletedAt, &thread.PinnedAt, &thread.LockedAt, &thread.ArchivedAt, &thread.HiddenAt, &thread.HeldAt, &thread.LastPostAt, &thread.NumPosts)
+}
+
+func (post *Post) scan(row scanner) error {
+	return row.Scan(&post.Id, &post.Uuid, &post.Body, &post.UserId, &post.ThreadId, &post.CreatedAt, &post.EditedAt, &post.DeletedAt, &post.HiddenAt, &post.HeldAt)
+}
+
+// prefix every column with the table name, for queries joining several tables
+func qualified(table, columns string) string {
+	return table + "." + strings.ReplaceAll(columns, ", ", ", "+table+".")
 }
 
 // format the CreatedAt date to display nicely on the screen
@@ -27,81 +79,284 @@ func (thread *Thread) CreatedAtDate() string {
 	return thread.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
 }
 
+func (thread *Thread) LastPostAtDate() string {
+	return thread.LastPostAt.Format("Jan 2, 2006 at 3:04pm")
+}
+
 func (post *Post) CreatedAtDate() string {
 	return post.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
 }
 
+// check if the thread or post was soft deleted
+func (thread *Thread) IsDeleted() bool {
+	return thread.DeletedAt.Valid
+}
+
+func (post *Post) IsDeleted() bool {
+	return post.DeletedAt.Valid
+}
+
+// check if the thread or post was hidden, by moderators or by reports
+func (thread *Thread) IsHidden() bool {
+	return thread.HiddenAt.Valid
+}
+
+func (post *Post) IsHidden() bool {
+	return post.HiddenAt.Valid
+}
+
+// check if the thread or post waits for a moderator, held content is hidden as well
+func (thread *Thread) IsHeld() bool {
+	return thread.HeldAt.Valid
+}
+
+func (post *Post) IsHeld() bool {
+	return post.HeldAt.Valid
+}
+
+// check if the thread or post was changed after it was written
+func (thread *Thread) IsEdited() bool {
+	return thread.EditedAt.Valid
+}
+
+func (post *Post) IsEdited() bool {
+	return post.EditedAt.Valid
+}
+
+// the topic to display, deleted threads only leave a tombstone and hidden or held ones a notice
+func (thread *Thread) DisplayTopic() string {
+	if thread.IsDeleted() {
+		return Tombstone
+	}
+	if thread.IsHeld() {
+		return HeldNotice
+	}
+	if thread.IsHidden() {
+		return HiddenNotice
+	}
+	return thread.Topic
+}
+
+// the body to display, deleted posts only leave a tombstone and hidden or held ones a notice
+func (post *Post) DisplayBody() string {
+	if post.IsDeleted() {
+		return Tombstone
+	}
+	if post.IsHeld() {
+		return HeldNotice
+	}
+	if post.IsHidden() {
+		return HiddenNotice
+	}
+	return post.Body
+}
+
 // get the number of posts in a thread
 func (thread *Thread) NumReplies() (count int) {
-	rows, err := Db.Query("SELECT count(*) FROM posts where thread_id = $1", thread.Id)
+	return thread.NumPosts
+}
+func (thread *Thread) NumRepliesStr() string {
+	numReplies := thread.NumReplies()
+	return strconv.Itoa(numReplies)
+}
+
+// get posts to a thread, the oldest first
+func (thread *Thread) Posts() (posts []Post, err error) {
+	rows, err := Db.Query("SELECT "+postColumns+" FROM posts where thread_id = $1 ORDER BY id", thread.Id)
 	if err != nil {
 		return
 	}
 	for rows.Next() {
-		if err = rows.Scan(&count); err != nil {
+		post := Post{}
+		if err = post.scan(rows); err != nil {
+			rows.Close()
 			return
 		}
+		posts = append(posts, post)
 	}
 	rows.Close()
 	return
 }
-func (thread *Thread) NumRepliesStr() string {
-	numReplies := thread.NumReplies()
-	return strconv.Itoa(numReplies)
+
+// Create a new thread in the category, a held thread is hidden until a moderator approves it
+func (user *User) CreateThread(category Category, topic string, hold Hold) (conv Thread, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	held := sql.NullTime{Time: now, Valid: hold.Held}
+	statement := "insert into threads (uuid, topic, user_id, category_id, created_at, last_post_at, hot_score, hidden_at, held_at, hidden_reason) values ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9) returning " + threadColumns
+	// use QueryRow to return a row and scan the returned id into the Thread struct
+	if err = conv.scan(tx.QueryRow(statement, createUUID(), topic, user.Id, category.Id, now, hotScore(0, now), held, held, hold.hideReason())); err != nil {
+		return
+	}
+	if err = hold.save(tx, TargetThread, conv.Id, now); err != nil {
+		return
+	}
+	if err = addThreadRevision(tx, conv.Id, topic, user.Id, conv.CreatedAt); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
 }
 
-// get posts to a thread
-func (thread *Thread) Posts() (posts []Post, err error) {
-	rows, err := Db.Query("SELECT id, uuid, body, user_id, thread_id, created_at FROM posts where thread_id = $1", thread.Id)
+// Create a new post to a thread, a held post is hidden until a moderator approves it
+func (user *User) CreatePost(conv Thread, body string, hold Hold) (post Post, err error) {
+	tx, err := Db.Begin()
 	if err != nil {
 		return
 	}
-	for rows.Next() {
-		post := Post{}
-		if err = rows.Scan(&post.Id, &post.Uuid, &post.Body, &post.UserId, &post.ThreadId, &post.CreatedAt); err != nil {
+	defer tx.Rollback()
+
+	now := time.Now()
+	held := sql.NullTime{Time: now, Valid: hold.Held}
+	statement := "insert into posts (uuid, body, user_id, thread_id, created_at, hidden_at, held_at, hidden_reason) values ($1, $2, $3, $4, $5, $6, $7, $8) returning " + postColumns
+	// use QueryRow to return a row and scan the returned id into the Post struct
+	if err = post.scan(tx.QueryRow(statement, createUUID(), body, user.Id, conv.Id, now, held, held, hold.hideReason())); err != nil {
+		return
+	}
+	if err = hold.save(tx, TargetPost, post.Id, now); err != nil {
+		return
+	}
+	if err = addPostRevision(tx, post.Id, body, user.Id, post.CreatedAt); err != nil {
+		return
+	}
+	if err = saveMentions(tx, post.Id, body); err != nil {
+		return
+	}
+	// keep the activity counters and the hot score of the thread up to date, a held post
+	// only counts once it is approved
+	if !hold.Held {
+		if _, err = tx.Exec("update threads set last_post_at = $2 where id = $1", conv.Id, post.CreatedAt); err != nil {
+			return
+		}
+		if err = recountPosts(tx, conv.Id); err != nil {
 			return
 		}
-		posts = append(posts, post)
 	}
-	rows.Close()
+	err = tx.Commit()
 	return
 }
 
-// Create a new thread
-func (user *User) CreateThread(topic string) (conv Thread, err error) {
-	statement := "insert into threads (uuid, topic, user_id, created_at) values ($1, $2, $3, $4) returning id, uuid, topic, user_id, created_at"
-	stmt, err := Db.Prepare(statement)
+// Recount the posts of the thread after one was added, deleted, hidden or shown again, and
+// update its hot score: the deleted, hidden and held posts are not counted
+func recountPosts(tx *sql.Tx, threadId int) (err error) {
+	var numPosts int
+	var createdAt time.Time
+	err = tx.QueryRow(`update threads set num_posts = (select count(*) from posts where thread_id = $1 and deleted_at is null and hidden_at is null)
+		where id = $1 returning num_posts, created_at`, threadId).Scan(&numPosts, &createdAt)
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
-	// use QueryRow to return a row and scan the returned id into the Session struct
-	err = stmt.QueryRow(createUUID(), topic, user.Id, time.Now()).Scan(&conv.Id, &conv.Uuid, &conv.Topic, &conv.UserId, &conv.CreatedAt)
+	_, err = tx.Exec("update threads set hot_score = $2 where id = $1", threadId, hotScore(numPosts, createdAt))
 	return
 }
 
-// Create a new post to a thread
-func (user *User) CreatePost(conv Thread, body string) (post Post, err error) {
-	statement := "insert into posts (uuid, body, user_id, thread_id, created_at) values ($1, $2, $3, $4, $5) returning id, uuid, body, user_id, thread_id, created_at"
-	stmt, err := Db.Prepare(statement)
+// ThreadFilter narrows down the threads returned by Threads
+type ThreadFilter struct {
+	// only threads of these categories, nil means every category
+	CategoryIds []int
+	// only threads carrying these tags, how they combine depends on TagMode
+	Tags    []string
+	TagMode TagMode
+	// order of the threads after the pinned ones, newest first by default
+	Sort ThreadSort
+	// page of the threads, counted from 1, the pinned threads are all on the first page
+	Page int
+}
+
+// number of threads on a page, besides the pinned ones
+const ThreadsPerPage = 30
+
+// TagMode tells whether a thread needs all the filter tags or any of them
+type TagMode string
+
+const (
+	TagsAll TagMode = "all"
+	TagsAny TagMode = "any"
+)
+
+// Get a page of the threads matching the filter, and whether there are more pages. The
+// pinned threads come first on the first page, then the others in the filter order.
+func Threads(filter ThreadFilter) (threads []Thread, more bool, err error) {
+	if filter.CategoryIds != nil && len(filter.CategoryIds) == 0 {
+		return
+	}
+	pinned, others, args := threadQueries(filter)
+	if pinned != "" {
+		if threads, err = queryThreads(pinned, args...); err != nil {
+			return
+		}
+	}
+	page, err := queryThreads(others, args...)
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
-	// use QueryRow to return a row and scan the returned id into the Session struct
-	err = stmt.QueryRow(createUUID(), body, user.Id, conv.Id, time.Now()).Scan(&post.Id, &post.Uuid, &post.Body, &post.UserId, &post.ThreadId, &post.CreatedAt)
+	if len(page) > ThreadsPerPage {
+		page, more = page[:ThreadsPerPage], true
+	}
+	threads = append(threads, page...)
 	return
 }
 
-// Get all threads in the database and returns it
-func Threads() (threads []Thread, err error) {
-	rows, err := Db.Query("SELECT id, uuid, topic, user_id, created_at FROM threads ORDER BY created_at DESC")
+// the queries of the pinned threads, empty after the first page, and of a page of the other
+// threads matching the filter. The pinned threads are few, they are sorted apart so the others
+// are read in the order of an index.
+func threadQueries(filter ThreadFilter) (pinned, others string, args []interface{}) {
+	var where []string
+	if filter.CategoryIds != nil {
+		// the threads of a board are read from the index of the board and the sort order, the
+		// threads of several boards from the index of the sort order alone, keeping those of
+		// the boards: the unary plus stops the planner from merging the ranges of the boards
+		// and sorting them
+		column := "category_id"
+		if len(filter.CategoryIds) > 1 {
+			column = "+category_id"
+		}
+		where = append(where, column+" IN ("+placeholders(len(args)+1, len(filter.CategoryIds))+")")
+		for _, id := range filter.CategoryIds {
+			args = append(args, id)
+		}
+	}
+	if len(filter.Tags) > 0 {
+		tagged := "id IN (SELECT thread_tags.thread_id FROM thread_tags JOIN tags ON tags.id = thread_tags.tag_id WHERE tags.name IN (" +
+			placeholders(len(args)+1, len(filter.Tags)) + ")"
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		if filter.TagMode == TagsAny {
+			tagged += ")"
+		} else {
+			tagged += " GROUP BY thread_tags.thread_id HAVING count(*) = $" + strconv.Itoa(len(args)+1) + ")"
+			args = append(args, len(filter.Tags))
+		}
+		where = append(where, tagged)
+	}
+	page := max(filter.Page, 1)
+	if page == 1 {
+		pinned = "SELECT " + threadColumns + " FROM threads WHERE " + strings.Join(append(where, "pinned_at IS NOT NULL"), " AND ") +
+			" ORDER BY pinned_at DESC"
+	}
+	// one thread more than the page tells whether there is a next page
+	others = "SELECT " + threadColumns + " FROM threads WHERE " + strings.Join(append(where, "pinned_at IS NULL"), " AND ") +
+		" ORDER BY " + filter.Sort.orderBy() +
+		" LIMIT " + strconv.Itoa(ThreadsPerPage+1) + " OFFSET " + strconv.Itoa((page-1)*ThreadsPerPage)
+	return
+}
+
+// Get the threads returned by the query
+func queryThreads(query string, args ...interface{}) (threads []Thread, err error) {
+	rows, err := Db.Query(query, args...)
 	if err != nil {
 		return
 	}
 	for rows.Next() {
 		conv := Thread{}
-		if err = rows.Scan(&conv.Id, &conv.Uuid, &conv.Topic, &conv.UserId, &conv.CreatedAt); err != nil {
+		if err = conv.scan(rows); err != nil {
+			rows.Close()
 			return
 		}
 		threads = append(threads, conv)
@@ -110,19 +365,26 @@ func Threads() (threads []Thread, err error) {
 	return
 }
 
+// "$first, $first+1, ..." for n query arguments
+func placeholders(first, n int) string {
+	marks := make([]string, n)
+	for i := range marks {
+		marks[i] = "$" + strconv.Itoa(first+i)
+	}
+	return strings.Join(marks, ", ")
+}
+
 // Get a thread by the UUID
 func ThreadByUUID(uuid string) (conv Thread, err error) {
 	conv = Thread{}
-	err = Db.QueryRow("SELECT id, uuid, topic, user_id, created_at FROM threads WHERE uuid = $1", uuid).
-		Scan(&conv.Id, &conv.Uuid, &conv.Topic, &conv.UserId, &conv.CreatedAt)
+	err = conv.scan(Db.QueryRow("SELECT "+threadColumns+" FROM threads WHERE uuid = $1", uuid))
 	return
 }
 
 // Get the user who started this thread
 func (thread *Thread) User() (user User) {
 	user = User{}
-	Db.QueryRow("SELECT id, uuid, name, email, created_at FROM users WHERE id = $1", thread.UserId).
-		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.CreatedAt)
+	user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", thread.UserId))
 	return
 }
 
@@ -137,8 +399,7 @@ func (thread *Thread) UserName() string {
 // Get the user who wrote the post
 func (post *Post) User() (user User) {
 	user = User{}
-	Db.QueryRow("SELECT id, uuid, name, email, created_at FROM users WHERE id = $1", post.UserId).
-		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.CreatedAt)
+	user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", post.UserId))
 	return
 }
 
@@ -149,3 +410,64 @@ func (post *Post) UserName() string {
 		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.CreatedAt)
 	return user.Name
 }
+
+// Get a post by the UUID
+func PostByUUID(uuid string) (post Post, err error) {
+	post = Post{}
+	err = post.scan(Db.QueryRow("SELECT "+postColumns+" FROM posts WHERE uuid = $1", uuid))
+	return
+}
+
+// Get the most recent posts across all threads
+func RecentPosts(limit int) (posts []Post, err error) {
+	rows, err := Db.Query("SELECT "+postColumns+" FROM posts WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1", limit)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		post := Post{}
+		if err = post.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	return
+}
+
+// Get the thread the post belongs to
+func (post *Post) Thread() (conv Thread, err error) {
+	err = conv.scan(Db.QueryRow("SELECT "+threadColumns+" FROM threads WHERE id = $1", post.ThreadId))
+	return
+}
+
+// Soft delete the post, the row stays as a tombstone
+func (post *Post) Delete() (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("update posts set deleted_at = $2 where id = $1", post.Id, time.Now()); err != nil {
+		return
+	}
+	if err = recountPosts(tx, post.ThreadId); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Soft delete the thread, the row stays as a tombstone
+func (thread *Thread) Delete() (err error) {
+	statement := "update threads set deleted_at = $2 where id = $1"
+	stmt, err := Db.Prepare(statement)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(thread.Id, time.Now())
+	return
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// ThreadSort is the order of a thread list
+type ThreadSort string
+
+const (
+	// newest threads first
+	SortNewest ThreadSort = "newest"
+	// threads with the latest posts first
+	SortActive ThreadSort = "active"
+	// threads with the most posts first
+	SortReplies ThreadSort = "replies"
+	// threads with many recent posts first, see hotScore
+	SortHot ThreadSort = "hot"
+)
+
+// all the sort modes, in the order offered to the visitors
+func ThreadSorts() []ThreadSort {
+	return []ThreadSort{SortNewest, SortActive, SortReplies, SortHot}
+}
+
+// parse a sort mode coming from the query string, unknown modes sort by the newest threads
+func ParseThreadSort(name string) ThreadSort {
+	for _, sort := range ThreadSorts() {
+		if string(sort) == name {
+			return sort
+		}
+	}
+	return SortNewest
+}
+
+// the ORDER BY clause of the sort mode, for the threads that are not pinned. Each mode has an
+// index of its own and one leading with the board, so a page of a board or of every board is
+// read in order and stops at the LIMIT. A tag filter sorts the threads carrying the tags.
+func (sort ThreadSort) orderBy() string {
+	switch sort {
+	case SortActive:
+		return "last_post_at DESC"
+	case SortReplies:
+		return "num_posts DESC, last_post_at DESC"
+	case SortHot:
+		return "hot_score DESC"
+	default:
+		return "created_at DESC"
+	}
+}
+
+// seconds of age worth ten times the posts in the hot score
+const hotDecay = 45000
+
+// hotScore ranks threads by their number of posts, decayed by the age of the thread.
+// The age is counted as a bonus growing with the creation time rather than a penalty
+// growing with the current time, so the score only changes when a post is added and
+// can be stored and indexed: a thread needs ten times the posts to outrank one
+// started 12.5 hours later.
+func hotScore(numPosts int, createdAt time.Time) float64 {
+	return math.Log10(float64(numPosts+1)) + float64(createdAt.Unix())/hotDecay
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ThreadState is a flag moderators can put on a thread
+type ThreadState string
+
+const (
+	// pinned threads are listed before the others
+	StatePinned ThreadState = "pinned"
+	// locked threads refuse new replies
+	StateLocked ThreadState = "locked"
+	// archived threads refuse new replies, stale threads are archived automatically
+	StateArchived ThreadState = "archived"
+)
+
+// column holding the time the state was set, NULL when it is not
+var stateColumns = map[ThreadState]string{
+	StatePinned:   "pinned_at",
+	StateLocked:   "locked_at",
+	StateArchived: "archived_at",
+}
+
+var ErrStateUnchanged = errors.New("the thread already has this state")
+
+// threads without activity for this long are archived, zero disables archiving
+var ArchiveAfter time.Duration
+
+// StateChange records who set or cleared a thread state and when
+type StateChange struct {
+	Id       int
+	ThreadId int
+	State    ThreadState
+	Enabled  bool
+	// NULL when the change was made automatically
+	UserId    sql.NullInt64
+	CreatedAt time.Time
+}
+
+func (change *StateChange) CreatedAtDate() string {
+	return change.CreatedAt.Format("Jan 2, 2006 at 3:04pm")
+}
+
+// Get the name of the user who made the change
+func (change *StateChange) UserName() string {
+	if !change.UserId.Valid {
+		return "system"
+	}
+	var name string
+	Db.QueryRow("SELECT name FROM users WHERE id = $1", change.UserId.Int64).Scan(&name)
+	return name
+}
+
+func (thread *Thread) IsPinned() bool {
+	return thread.PinnedAt.Valid
+}
+
+func (thread *Thread) IsLocked() bool {
+	return thread.LockedAt.Valid
+}
+
+func (thread *Thread) IsArchived() bool {
+	return thread.ArchivedAt.Valid
+}
+
+// check if new replies can be posted to the thread
+func (thread *Thread) AcceptsReplies() bool {
+	return !thread.IsDeleted() && !thread.IsHidden() && !thread.IsLocked() && !thread.IsArchived()
+}
+
+// Set or clear a state of the thread, user is the zero User for automatic changes. Nothing is
+// recorded when the thread already has the state, the error is then ErrStateUnchanged.
+func (thread *Thread) SetState(state ThreadState, enabled bool, user User) (err error) {
+	column, ok := stateColumns[state]
+	if !ok {
+		return fmt.Errorf("unknown thread state %q", state)
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	at := sql.NullTime{Time: now, Valid: enabled}
+	// a state set again keeps its time, pinned threads keep their order
+	result, err := tx.Exec("update threads set "+column+" = $2 where id = $1 and ("+column+" is null) = $3", thread.Id, at, enabled)
+	if err != nil {
+		return
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrStateUnchanged
+	}
+	userId := sql.NullInt64{Int64: int64(user.Id), Valid: user.Id != 0}
+	_, err = tx.Exec("insert into thread_state_changes (thread_id, state, enabled, user_id, created_at) values ($1, $2, $3, $4, $5)",
+		thread.Id, state, enabled, userId, now)
+	if err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	switch state {
+	case StatePinned:
+		thread.PinnedAt = at
+	case StateLocked:
+		thread.LockedAt = at
+	case StateArchived:
+		thread.ArchivedAt = at
+	}
+	return
+}
+
+// Get the latest change of the state, to show who set it
+func (thread *Thread) LastStateChange(state ThreadState) (change StateChange, err error) {
+	err = Db.QueryRow("SELECT id, thread_id, state, enabled, user_id, created_at FROM thread_state_changes WHERE thread_id = $1 AND state = $2 ORDER BY id DESC LIMIT 1",
+		thread.Id, state).Scan(&change.Id, &change.ThreadId, &change.State, &change.Enabled, &change.UserId, &change.CreatedAt)
+	return
+}
+
+// Archive the threads without new posts since the ArchiveAfter period, pinned threads are kept open.
+// A thread a moderator reopened gets another period before it is archived again.
+func ArchiveStaleThreads() (count int, err error) {
+	if ArchiveAfter <= 0 {
+		return
+	}
+	before := time.Now().Add(-ArchiveAfter)
+	rows, err := Db.Query(`SELECT `+threadColumns+` FROM threads WHERE archived_at IS NULL AND pinned_at IS NULL AND deleted_at IS NULL
+		AND last_post_at < $1 AND NOT EXISTS (SELECT 1 FROM thread_state_changes WHERE thread_id = threads.id AND state = $2
+		AND enabled = $3 AND created_at >= $1)`, before, StateArchived, false)
+	if err != nil {
+		return
+	}
+	var threads []Thread
+	for rows.Next() {
+		thread := Thread{}
+		if err = thread.scan(rows); err != nil {
+			rows.Close()
+			return
+		}
+		threads = append(threads, thread)
+	}
+	rows.Close()
+	for _, thread := range threads {
+		// archived by a moderator in the meantime
+		if err = thread.SetState(StateArchived, true, User{}); err == ErrStateUnchanged {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		count++
+	}
+	return
+}
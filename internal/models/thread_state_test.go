@@ -0,0 +1,129 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// the changes recorded for the state of the thread
+func stateChanges(t *testing.T, thread Thread, state ThreadState) (count int) {
+	t.Helper()
+	if err := Db.QueryRow("SELECT count(*) FROM thread_state_changes WHERE thread_id = $1 AND state = $2", thread.Id, state).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSetState(t *testing.T) {
+	setupDB(t)
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+	thread, err := moderator.CreateThread(Category{Id: 1}, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    error
+		// changes recorded so far
+		changes int
+	}{
+		{"pin", true, nil, 1},
+		{"pin again", true, ErrStateUnchanged, 1},
+		{"unpin", false, nil, 2},
+		{"unpin again", false, ErrStateUnchanged, 2},
+		{"pin after the unpin", true, nil, 3},
+	}
+	for _, test := range tests {
+		pinnedAt := thread.PinnedAt
+		if err := thread.SetState(StatePinned, test.enabled, moderator); err != test.want {
+			t.Errorf("%s: %v, want %v", test.name, err, test.want)
+		}
+		if changes := stateChanges(t, thread, StatePinned); changes != test.changes {
+			t.Errorf("%s: %d changes recorded, want %d", test.name, changes, test.changes)
+		}
+		stored, _ := ThreadByUUID(thread.Uuid)
+		if stored.IsPinned() != test.enabled {
+			t.Errorf("%s: pinned %v", test.name, stored.IsPinned())
+		}
+		// the order of the pinned threads comes from the time of the pin
+		if test.want == ErrStateUnchanged && test.enabled && !stored.PinnedAt.Time.Equal(pinnedAt.Time) {
+			t.Errorf("%s: pinned at %v, was %v", test.name, stored.PinnedAt.Time, pinnedAt.Time)
+		}
+	}
+	if err := thread.SetState("sticky", true, moderator); err == nil {
+		t.Error("an unknown state was set")
+	}
+}
+
+func TestArchiveStaleThreads(t *testing.T) {
+	setupDB(t)
+	defer func(after time.Duration) { ArchiveAfter = after }(ArchiveAfter)
+	ArchiveAfter = 24 * time.Hour
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+	stale := time.Now().Add(-2 * ArchiveAfter)
+
+	tests := []struct {
+		name string
+		// brings the thread to its state
+		setup    func(thread *Thread)
+		archived bool
+	}{
+		{"active", func(thread *Thread) {}, false},
+		{"stale", func(thread *Thread) { setLastPost(t, thread, stale) }, true},
+		{"stale and pinned", func(thread *Thread) {
+			setLastPost(t, thread, stale)
+			thread.SetState(StatePinned, true, moderator)
+		}, false},
+		{"stale and reopened by a moderator", func(thread *Thread) {
+			setLastPost(t, thread, stale)
+			thread.SetState(StateArchived, true, User{})
+			thread.SetState(StateArchived, false, moderator)
+		}, false},
+		{"reopened a period ago", func(thread *Thread) {
+			setLastPost(t, thread, stale)
+			thread.SetState(StateArchived, true, User{})
+			thread.SetState(StateArchived, false, moderator)
+			Db.Exec("update thread_state_changes set created_at = $2 where thread_id = $1", thread.Id, stale)
+		}, true},
+	}
+	threads := make([]Thread, len(tests))
+	for i, test := range tests {
+		thread, err := moderator.CreateThread(Category{Id: 1}, test.name, Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.setup(&thread)
+		threads[i] = thread
+	}
+	count, err := ArchiveStaleThreads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for i, test := range tests {
+		stored, _ := ThreadByUUID(threads[i].Uuid)
+		if stored.IsArchived() != test.archived {
+			t.Errorf("%s: archived %v, want %v", test.name, stored.IsArchived(), test.archived)
+		}
+		if test.archived {
+			want++
+		}
+	}
+	if count != want {
+		t.Errorf("archived %d threads, want %d", count, want)
+	}
+	// the next run finds nothing left to archive
+	if count, err := ArchiveStaleThreads(); count != 0 || err != nil {
+		t.Errorf("the second run archived %d threads, %v", count, err)
+	}
+}
+
+// the thread without posts since the time
+func setLastPost(t *testing.T, thread *Thread, at time.Time) {
+	t.Helper()
+	if _, err := Db.Exec("update threads set last_post_at = $2 where id = $1", thread.Id, at); err != nil {
+		t.Fatal(err)
+	}
+}
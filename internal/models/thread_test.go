@@ -0,0 +1,185 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThreadQueriesReadAnIndexInOrder(t *testing.T) {
+	setupDB(t)
+	tests := []struct {
+		name   string
+		filter ThreadFilter
+	}{
+		{"every board, newest", ThreadFilter{}},
+		{"a board, newest", ThreadFilter{CategoryIds: []int{1}}},
+		{"boards, newest", ThreadFilter{CategoryIds: []int{1, 2, 3}}},
+		{"boards, second page", ThreadFilter{CategoryIds: []int{1, 2, 3}, Page: 2}},
+		{"a board, active", ThreadFilter{CategoryIds: []int{1}, Sort: SortActive}},
+		{"boards, active", ThreadFilter{CategoryIds: []int{1, 2}, Sort: SortActive}},
+		{"a board, replies", ThreadFilter{CategoryIds: []int{1}, Sort: SortReplies}},
+		{"boards, replies", ThreadFilter{CategoryIds: []int{1, 2}, Sort: SortReplies}},
+		{"a board, hot", ThreadFilter{CategoryIds: []int{1}, Sort: SortHot}},
+		{"boards, hot", ThreadFilter{CategoryIds: []int{1, 2}, Sort: SortHot}},
+	}
+	for _, test := range tests {
+		pinned, others, args := threadQueries(test.filter)
+		for _, query := range []string{pinned, others} {
+			if query == "" {
+				continue
+			}
+			rows, err := Db.Query("EXPLAIN QUERY PLAN "+query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+					rows.Close()
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+			}
+			rows.Close()
+			if joined := strings.Join(plan, "; "); strings.Contains(joined, "TEMP B-TREE") {
+				t.Errorf("%s: %s\nsorts the threads: %s", test.name, query, joined)
+			}
+		}
+	}
+}
+
+func TestThreadsPages(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "author")
+	cat := createCategory(t, Category{Slug: "board", Name: "Board"})
+	var created []Thread
+	for i := 0; i < ThreadsPerPage+5; i++ {
+		thread, err := user.CreateThread(cat, "Thread", Hold{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, thread)
+	}
+	// the oldest thread is pinned, it comes first
+	if err := created[0].SetState(StatePinned, true, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page  int
+		first int
+		count int
+		more  bool
+	}{
+		{1, created[0].Id, ThreadsPerPage + 1, true},
+		{2, created[4].Id, 4, false},
+		{3, 0, 0, false},
+	}
+	for _, test := range tests {
+		threads, more, err := Threads(ThreadFilter{CategoryIds: []int{cat.Id}, Page: test.page})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(threads) != test.count || more != test.more {
+			t.Errorf("page %d: %d threads, more %v, want %d, %v", test.page, len(threads), more, test.count, test.more)
+			continue
+		}
+		if test.count > 0 && threads[0].Id != test.first {
+			t.Errorf("page %d starts with thread %d, want %d", test.page, threads[0].Id, test.first)
+		}
+	}
+	if threads, _, _ := Threads(ThreadFilter{CategoryIds: []int{}}); len(threads) != 0 {
+		t.Errorf("no boards gave %d threads", len(threads))
+	}
+}
+
+func TestNumPostsCountsVisiblePosts(t *testing.T) {
+	setupDB(t)
+	ReportHideThreshold = 2
+	t.Cleanup(func() { ReportHideThreshold = 3 })
+	author := createUser(t, "author")
+	moderator := createUserWithRole(t, "moderator", RoleModerator)
+	cat := createCategory(t, Category{Slug: "board", Name: "Board"})
+	thread, err := author.CreateThread(cat, "Thread", Hold{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(hold Hold) Post {
+		post, err := author.CreatePost(thread, "a post", hold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	first, second, reported, held := post(Hold{}), post(Hold{}), post(Hold{}), post(Hold{Held: true, Reasons: "links"})
+
+	tests := []struct {
+		name   string
+		change func() error
+		want   int
+	}{
+		{"held posts are not counted", func() error { return nil }, 3},
+		{"deleted", first.Delete, 2},
+		{"restored", first.Restore, 3},
+		{"hidden by reports", func() error {
+			for _, handle := range []string{"one", "two"} {
+				reporter := createUser(t, handle)
+				if _, err := reporter.ReportPost(reported, ReasonSpam, ""); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, 2},
+		{"shown again", func() error {
+			item, err := ReportedItemByUUID(TargetPost, reported.Uuid)
+			if err != nil {
+				return err
+			}
+			return item.Resolve(ResolveDismiss, moderator, "")
+		}, 3},
+		{"held post approved", func() error {
+			item, err := HeldItemByUUID(TargetPost, held.Uuid)
+			if err != nil {
+				return err
+			}
+			return item.Review(HoldApproved, moderator)
+		}, 4},
+		{"deleted by a moderator", func() error {
+			if _, err := moderator.ReportPost(second, ReasonSpam, ""); err != nil {
+				return err
+			}
+			item, err := ReportedItemByUUID(TargetPost, second.Uuid)
+			if err != nil {
+				return err
+			}
+			return item.Resolve(ResolveDelete, moderator, "")
+		}, 3},
+	}
+	for _, test := range tests {
+		if err := test.change(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got, err := ThreadByUUID(thread.Uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.NumPosts != test.want {
+			t.Errorf("%s: %d posts, want %d", test.name, got.NumPosts, test.want)
+		}
+		var score float64
+		if err := Db.QueryRow("SELECT hot_score FROM threads WHERE id = $1", thread.Id).Scan(&score); err != nil {
+			t.Fatal(err)
+		}
+		if score != hotScore(test.want, got.CreatedAt) {
+			t.Errorf("%s: hot score %v, want the score of %d posts", test.name, score, test.want)
+		}
+	}
+	// the approved post is the latest activity of the thread
+	got, _ := ThreadByUUID(thread.Uuid)
+	if !got.LastPostAt.Round(time.Millisecond).Equal(held.CreatedAt.Round(time.Millisecond)) {
+		t.Errorf("last post at %v, want the approved post at %v", got.LastPostAt, held.CreatedAt)
+	}
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/totp"
+)
+
+// recovery codes handed out when 2FA is turned on, each works once
+const RecoveryCodeCount = 10
+
+// how long a partial session waits for the second step of the login
+var TwoFactorTimeout = 10 * time.Minute
+
+var (
+	ErrInvalidTwoFactorCode = errors.New("The code is not correct")
+	ErrNoTwoFactorSetup     = errors.New("Two-factor authentication was not set up")
+)
+
+// A user has at most one user_totp row: without confirmed_at it is an enrollment waiting
+// for its first code, with it the login asks for a code. last_step is the time step of the
+// last code accepted, so a code seen by someone else cannot be used a second time.
+
+// check if the login of the user asks for a code
+func (user *User) HasTwoFactor() bool {
+	var count int
+	Db.QueryRow("SELECT count(*) FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL", user.Id).Scan(&count)
+	return count > 0
+}
+
+// Start enrolling an authenticator app, a new secret replaces an unconfirmed one
+func (user *User) BeginTwoFactor() (secret string, err error) {
+	if user.HasTwoFactor() {
+		return "", errors.New("Two-factor authentication is already on")
+	}
+	secret = totp.NewSecret()
+	_, err = Db.Exec(`insert into user_totp (user_id, secret, created_at) values ($1, $2, $3)
+		on conflict (user_id) do update set secret = excluded.secret, created_at = excluded.created_at`, user.Id, secret, time.Now())
+	return
+}
+
+// Get the secret being enrolled, empty if there is none
+func (user *User) PendingTwoFactorSecret() (secret string) {
+	Db.QueryRow("SELECT secret FROM user_totp WHERE user_id = $1 AND confirmed_at IS NULL", user.Id).Scan(&secret)
+	return
+}
+
+// the link encoded in the QR code of the enrollment
+func (user *User) TwoFactorURI(secret string) string {
+	return totp.URI("ChitChat", user.Email, secret)
+}
+
+// Turn 2FA on once the app shows a correct code, the recovery codes are returned in clear only now
+func (user *User) ConfirmTwoFactor(code string) (codes []string, err error) {
+	secret := user.PendingTwoFactorSecret()
+	if secret == "" {
+		return nil, ErrNoTwoFactorSetup
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("update user_totp set confirmed_at = $2, last_step = $3 where user_id = $1", user.Id, time.Now(), step); err != nil {
+		return
+	}
+	if codes, err = replaceRecoveryCodes(tx, user.Id); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// Check a code of the app for the login, each code is accepted once
+func (user *User) VerifyTwoFactor(code string) (err error) {
+	var secret string
+	var lastStep sql.NullInt64
+	err = Db.QueryRow("SELECT secret, last_step FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL", user.Id).Scan(&secret, &lastStep)
+	if err != nil {
+		return ErrNoTwoFactorSetup
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || (lastStep.Valid && step <= lastStep.Int64) {
+		return ErrInvalidTwoFactorCode
+	}
+	// the condition makes two requests racing with the same code accept only one
+	res, err := Db.Exec("update user_totp set last_step = $2 where user_id = $1 and (last_step is null or last_step < $2)", user.Id, step)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return
+}
+
+// Turn 2FA off, used by the user or by an admin when the user lost the app and the codes
+func (user *User) ResetTwoFactor() (err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("delete from user_totp where user_id = $1", user.Id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("delete from recovery_codes where user_id = $1", user.Id); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Recovery codes are stored hashed like the reset tokens, they are as good as a password.
+
+// create a code easy to type, like "k3j9x-2mwqa"
+func newRecoveryCode() string {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:]
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// replace the recovery codes of the user with new ones within the transaction
+func replaceRecoveryCodes(tx *sql.Tx, userId int) (codes []string, err error) {
+	if _, err = tx.Exec("delete from recovery_codes where user_id = $1", userId); err != nil {
+		return
+	}
+	now := time.Now()
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code := newRecoveryCode()
+		if _, err = tx.Exec("insert into recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)", userId, hashToken(code), now); err != nil {
+			return
+		}
+		codes = append(codes, code)
+	}
+	return
+}
+
+// Create new recovery codes, the old ones stop working
+func (user *User) RegenerateRecoveryCodes() (codes []string, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if codes, err = replaceRecoveryCodes(tx, user.Id); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// Get the number of recovery codes not used yet
+func (user *User) RecoveryCodesLeft() (count int) {
+	Db.QueryRow("SELECT count(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", user.Id).Scan(&count)
+	return
+}
+
+// Log in with a recovery code instead of a code of the app, the code is used up
+func (user *User) UseRecoveryCode(code string) (err error) {
+	res, err := Db.Exec("update recovery_codes set used_at = $3 where user_id = $1 and code_hash = $2 and used_at is null",
+		user.Id, hashToken(normalizeRecoveryCode(code)), time.Now())
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return
+}
+
+// A partial session is created when the password of a user with 2FA is correct. It is not
+// accepted by Session.Check, it only lets the user send the code to get a full session.
+
+// Create a partial session for the second step of the login
+func (user *User) CreatePartialSession(userAgent, ip string) (session Session, err error) {
+	err = session.scan(Db.QueryRow("insert into sessions (uuid, email, user_id, created_at, user_agent, ip, last_seen_at, partial) values ($1, $2, $3, $4, $5, $6, $7, true) returning "+sessionColumns,
+		createUUID(), user.Email, user.Id, time.Now(), userAgent, ip, time.Now()))
+	return
+}
+
+// Get a partial session that has not timed out
+func PartialSession(uuid string) (session Session, err error) {
+	err = session.scan(Db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE uuid = $1 AND partial AND created_at > $2",
+		uuid, time.Now().Add(-TwoFactorTimeout)))
+	return
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice")
+	code := func(secret string, offset int64) string {
+		code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	if err := user.VerifyTwoFactor("000000"); err != ErrNoTwoFactorSetup {
+		t.Errorf("VerifyTwoFactor before the setup: %v, want ErrNoTwoFactorSetup", err)
+	}
+	secret, err := user.BeginTwoFactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.HasTwoFactor() {
+		t.Error("2FA is on before the first code")
+	}
+	if _, err := user.ConfirmTwoFactor(code(secret, 10)); err != ErrInvalidTwoFactorCode {
+		t.Errorf("ConfirmTwoFactor with the code of five minutes later: %v", err)
+	}
+	// the code confirming the app is the last one accepted
+	confirmed := code(secret, -1)
+	codes, err := user.ConfirmTwoFactor(confirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.HasTwoFactor() || len(codes) != RecoveryCodeCount || user.RecoveryCodesLeft() != RecoveryCodeCount {
+		t.Fatalf("2FA on %v with %d codes, %d left", user.HasTwoFactor(), len(codes), user.RecoveryCodesLeft())
+	}
+	if _, err := user.BeginTwoFactor(); err == nil {
+		t.Error("a second enrollment replaced the confirmed one")
+	}
+
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"code used to confirm", confirmed, ErrInvalidTwoFactorCode},
+		{"wrong code", "12345", ErrInvalidTwoFactorCode},
+		{"current code", code(secret, 0), nil},
+		{"current code again", code(secret, 0), ErrInvalidTwoFactorCode},
+		{"older code after a newer one", code(secret, -1), ErrInvalidTwoFactorCode},
+		{"next code", code(secret, 1), nil},
+	}
+	for _, test := range tests {
+		if err := user.VerifyTwoFactor(test.code); err != test.err {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice")
+	other := createUser(t, "bob")
+	secret, err := user.BeginTwoFactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := totp.Code(secret, totp.Step(time.Now()))
+	codes, err := user.ConfirmTwoFactor(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the codes are never stored, only their hash
+	var stored int
+	Db.QueryRow("SELECT count(*) FROM recovery_codes WHERE code_hash = $1", codes[0]).Scan(&stored)
+	if stored != 0 {
+		t.Error("a recovery code is stored as it is")
+	}
+
+	tests := []struct {
+		name string
+		user User
+		code string
+		err  error
+	}{
+		{"code of another user", other, codes[0], ErrInvalidTwoFactorCode},
+		{"unknown code", user, "aaaaa-bbbbb", ErrInvalidTwoFactorCode},
+		{"code", user, codes[0], nil},
+		{"code used twice", user, codes[0], ErrInvalidTwoFactorCode},
+		{"code typed in upper case with spaces", user, " " + strings.ToUpper(codes[1]) + " ", nil},
+	}
+	for _, test := range tests {
+		if err := test.user.UseRecoveryCode(test.code); err != test.err {
+			t.Errorf("%s: %v, want %v", test.name, err, test.err)
+		}
+	}
+	if left := user.RecoveryCodesLeft(); left != RecoveryCodeCount-2 {
+		t.Errorf("%d codes left, want %d", left, RecoveryCodeCount-2)
+	}
+
+	// new codes replace the old ones
+	fresh, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.UseRecoveryCode(codes[2]); err != ErrInvalidTwoFactorCode {
+		t.Errorf("an old code still works after regenerating: %v", err)
+	}
+	if err := user.UseRecoveryCode(fresh[0]); err != nil {
+		t.Errorf("a new code: %v", err)
+	}
+
+	// turning 2FA off removes the secret and the codes
+	if err := user.ResetTwoFactor(); err != nil {
+		t.Fatal(err)
+	}
+	if user.HasTwoFactor() || user.RecoveryCodesLeft() != 0 {
+		t.Errorf("after the reset 2FA is on %v with %d codes", user.HasTwoFactor(), user.RecoveryCodesLeft())
+	}
+}
+
+func TestPartialSession(t *testing.T) {
+	setupDB(t)
+	user := createUser(t, "alice")
+	partial, err := user.CreatePartialSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, _ := partial.Check(); valid {
+		t.Error("a partial session is accepted as a login")
+	}
+	if _, err := PartialSession(partial.Uuid); err != nil {
+		t.Errorf("PartialSession: %v", err)
+	}
+	if _, err := Db.Exec("update sessions set created_at = $2 where uuid = $1", partial.Uuid, time.Now().Add(-TwoFactorTimeout-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PartialSession(partial.Uuid); err == nil {
+		t.Error("a timed out partial session is still accepted")
+	}
+	full, err := user.CreateSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PartialSession(full.Uuid); err == nil {
+		t.Error("a full session is accepted as a partial one")
+	}
+}
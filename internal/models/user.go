@@ -1,16 +1,47 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 )
 
 type User struct {
-	Id        int
-	Uuid      string
-	Name      string
+	Id   int
+	Uuid string
+	Name string
+	// unique lowercase username used in @mentions and profile URLs
+	Handle    string
 	Email     string
 	Password  string
+	Role      Role
 	CreatedAt time.Time
+	// when the user confirmed owning the email, not set until then
+	EmailVerifiedAt sql.NullTime
+	// shown on the public profile
+	Bio string
+	// storage key of the avatar image, empty when the user has none
+	AvatarKey string
+	// IANA name of the zone the dates are shown in, empty for the server zone
+	Timezone string
+	// when the user asked to delete the account, and what happens to the content
+	DeletionRequestedAt sql.NullTime
+	DeletionMode        DeletionMode
+	// when the account was purged, the row stays anonymized so content keeps an author
+	DeletedAt sql.NullTime
+	// suspended users may log in again once the time has passed, banned users never
+	SuspendedUntil sql.NullTime
+	BannedAt       sql.NullTime
+	// why the admin suspended or banned the user, shown to them at login
+	SanctionReason string
+}
+
+// columns read by every user query, in the order scanned below
+const userColumns = "id, uuid, name, handle, email, password, role, created_at, email_verified_at, bio, avatar_key, timezone, deletion_requested_at, deletion_mode, deleted_at, suspended_until, banned_at, sanction_reason"
+
+func (user *User) scan(row scanner) error {
+	return row.Scan(&user.Id, &user.Uuid, &user.Name, &user.Handle, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.EmailVerifiedAt,
+		&user.Bio, &user.AvatarKey, &user.Timezone, &user.DeletionRequestedAt, &user.DeletionMode, &user.DeletedAt,
+		&user.SuspendedUntil, &user.BannedAt, &user.SanctionReason)
 }
 
 type Session struct {
@@ -19,33 +50,46 @@ type Session struct {
 	Email     string
 	UserId    int
 	CreatedAt time.Time
+	// the browser and the address the session was started from
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time
+	// sent back with every form and HTMX request of the session, see handlers.CSRF
+	CSRFToken string
+}
+
+// columns read by every session query, in the order scanned below
+const sessionColumns = "id, uuid, email, user_id, created_at, user_agent, ip, last_seen_at, csrf_token"
+
+func (session *Session) scan(row scanner) error {
+	return row.Scan(&session.Id, &session.Uuid, &session.Email, &session.UserId, &session.CreatedAt,
+		&session.UserAgent, &session.IP, &session.LastSeenAt, &session.CSRFToken)
 }
 
 // Create a new session for an existing user
-func (user *User) CreateSession() (session Session, err error) {
-	statement := "insert into sessions (uuid, email, user_id, created_at) values ($1, $2, $3, $4) returning id, uuid, email, user_id, created_at"
+func (user *User) CreateSession(userAgent, ip string) (session Session, err error) {
+	statement := "insert into sessions (uuid, email, user_id, created_at, user_agent, ip, last_seen_at, csrf_token) values ($1, $2, $3, $4, $5, $6, $7, $8) returning " + sessionColumns
 	stmt, err := Db.Prepare(statement)
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
 	// use QueryRow to return a row and scan the returned id into the Session struct
-	err = stmt.QueryRow(createUUID(), user.Email, user.Id, time.Now()).Scan(&session.Id, &session.Uuid, &session.Email, &session.UserId, &session.CreatedAt)
+	now := time.Now()
+	err = session.scan(stmt.QueryRow(createUUID(), user.Email, user.Id, now, userAgent, ip, now, createToken()))
 	return
 }
 
 // Get the session for an existing user
 func (user *User) Session() (session Session, err error) {
 	session = Session{}
-	err = Db.QueryRow("SELECT id, uuid, email, user_id, created_at FROM sessions WHERE user_id = $1", user.Id).
-		Scan(&session.Id, &session.Uuid, &session.Email, &session.UserId, &session.CreatedAt)
+	err = session.scan(Db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1", user.Id))
 	return
 }
 
-// Check if session is valid in the database
+// Check if session is valid in the database, partial sessions waiting for a 2FA code are not
 func (session *Session) Check() (valid bool, err error) {
-	err = Db.QueryRow("SELECT id, uuid, email, user_id, created_at FROM sessions WHERE uuid = $1", session.Uuid).
-		Scan(&session.Id, &session.Uuid, &session.Email, &session.UserId, &session.CreatedAt)
+	err = session.scan(Db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE uuid = $1 AND NOT partial", session.Uuid))
 	if err != nil {
 		valid = false
 		return
@@ -72,8 +116,7 @@ func (session *Session) DeleteByUUID() (err error) {
 // Get the user from the session
 func (session *Session) User() (user User, err error) {
 	user = User{}
-	err = Db.QueryRow("SELECT id, uuid, name, email, created_at FROM users WHERE id = $1", session.UserId).
-		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.CreatedAt)
+	err = user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", session.UserId))
 	return
 }
 
@@ -89,7 +132,10 @@ func (user *User) Create() (err error) {
 	// Postgres does not automatically return the last insert id, because it would be wrong to assume
 	// you're always using a sequence.You need to use the RETURNING keyword in your insert to get this
 	// information from postgres.
-	statement := "insert into users (uuid, name, email, password, created_at) values ($1, $2, $3, $4, $5) returning id, uuid, created_at"
+	if user.Handle, err = user.pickHandle(); err != nil {
+		return
+	}
+	statement := "insert into users (uuid, name, handle, email, password, role, created_at) values ($1, $2, $3, $4, $5, $6, $7) returning id, uuid, role, created_at"
 	stmt, err := Db.Prepare(statement)
 	if err != nil {
 		return
@@ -97,7 +143,10 @@ func (user *User) Create() (err error) {
 	defer stmt.Close()
 
 	// use QueryRow to return a row and scan the returned id into the User struct
-	err = stmt.QueryRow(createUUID(), user.Name, user.Email, Encrypt(user.Password), time.Now()).Scan(&user.Id, &user.Uuid, &user.CreatedAt)
+	if user.Role == "" {
+		user.Role = RoleMember
+	}
+	err = stmt.QueryRow(createUUID(), user.Name, user.Handle, user.Email, Encrypt(user.Password), user.Role, time.Now()).Scan(&user.Id, &user.Uuid, &user.Role, &user.CreatedAt)
 	return
 }
 
@@ -114,16 +163,20 @@ func (user *User) Delete() (err error) {
 	return
 }
 
-// Update user information in the database
+// Update user information in the database, the email only changes once the new
+// address is confirmed, see CreateEmailVerification
 func (user *User) Update() (err error) {
-	statement := "update users set name = $2, email = $3 where id = $1"
+	if err = user.validateProfile(); err != nil {
+		return
+	}
+	statement := "update users set name = $2, bio = $3, timezone = $4 where id = $1"
 	stmt, err := Db.Prepare(statement)
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(user.Id, user.Name, user.Email)
+	_, err = stmt.Exec(user.Id, user.Name, user.Bio, user.Timezone)
 	return
 }
 
@@ -136,13 +189,14 @@ func UserDeleteAll() (err error) {
 
 // Get all users in the database and returns it
 func Users() (users []User, err error) {
-	rows, err := Db.Query("SELECT id, uuid, name, email, password, created_at FROM users")
+	rows, err := Db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return
 	}
 	for rows.Next() {
 		user := User{}
-		if err = rows.Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.Password, &user.CreatedAt); err != nil {
+		if err = user.scan(rows); err != nil {
+			rows.Close()
 			return
 		}
 		users = append(users, user)
@@ -154,15 +208,20 @@ func Users() (users []User, err error) {
 // Get a single user given the email
 func UserByEmail(email string) (user User, err error) {
 	user = User{}
-	err = Db.QueryRow("SELECT id, uuid, name, email, password, created_at FROM users WHERE email = $1", email).
-		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.Password, &user.CreatedAt)
+	err = user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1", email))
 	return
 }
 
 // Get a single user given the UUID
 func UserByUUID(uuid string) (user User, err error) {
 	user = User{}
-	err = Db.QueryRow("SELECT id, uuid, name, email, password, created_at FROM users WHERE uuid = $1", uuid).
-		Scan(&user.Id, &user.Uuid, &user.Name, &user.Email, &user.Password, &user.CreatedAt)
+	err = user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE uuid = $1", uuid))
+	return
+}
+
+// Get a single user given the id
+func UserById(id int) (user User, err error) {
+	user = User{}
+	err = user.scan(Db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
 	return
 }
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// how long a verification link works, and how many links a user may get per hour
+var (
+	EmailVerificationTTL = 24 * time.Hour
+	MaxVerificationMails = 3
+)
+
+var (
+	ErrTooManyVerifications  = errors.New("Too many verification emails sent, please try again later")
+	ErrInvalidVerification   = errors.New("This verification link is invalid or has expired")
+	ErrEmailTaken            = errors.New("This email address is already used by another account")
+	ErrEmailAlreadyConfirmed = errors.New("This email address is already verified")
+)
+
+// The same table verifies the address given on signup and the new address of an email change:
+// the row holds the address being confirmed, and the user's email only changes once it is.
+
+// check if the user confirmed owning the email
+func (user *User) IsVerified() bool {
+	return user.EmailVerifiedAt.Valid
+}
+
+// Mark the email of the user as verified without sending a link
+func (user *User) MarkVerified() (err error) {
+	now := time.Now()
+	if _, err = Db.Exec("update users set email_verified_at = $2 where id = $1", user.Id, now); err == nil {
+		user.EmailVerifiedAt.Time, user.EmailVerifiedAt.Valid = now, true
+	}
+	return
+}
+
+// Create a token confirming the email for the user, either the current unverified
+// email or the address the user wants to change to
+func (user *User) CreateEmailVerification(email string) (token string, err error) {
+	if email == user.Email && user.IsVerified() {
+		return "", ErrEmailAlreadyConfirmed
+	}
+	if email != user.Email {
+		var count int
+		if err = Db.QueryRow("SELECT count(*) FROM users WHERE email = $1", email).Scan(&count); err != nil {
+			return
+		}
+		if count > 0 {
+			return "", ErrEmailTaken
+		}
+	}
+	now := time.Now()
+	var count int
+	err = Db.QueryRow("SELECT count(*) FROM email_verifications WHERE user_id = $1 AND created_at > $2", user.Id, now.Add(-time.Hour)).Scan(&count)
+	if err != nil {
+		return
+	}
+	if count >= MaxVerificationMails {
+		return "", ErrTooManyVerifications
+	}
+	token = createToken()
+	_, err = Db.Exec("insert into email_verifications (user_id, email, token_hash, created_at, expires_at) values ($1, $2, $3, $4, $5)",
+		user.Id, email, hashToken(token), now, now.Add(EmailVerificationTTL))
+	return
+}
+
+// Get the address the user asked to change to and has not confirmed yet, empty if none
+func (user *User) PendingEmail() (email string) {
+	Db.QueryRow(`SELECT email FROM email_verifications WHERE user_id = $1 AND email <> $2 AND used_at IS NULL AND expires_at > $3
+		ORDER BY id DESC LIMIT 1`, user.Id, user.Email, time.Now()).Scan(&email)
+	return
+}
+
+// Confirm the address of the token, an email change is applied now.
+// The previous address is returned when it changed, so its owner can be told.
+func VerifyEmail(token string) (user User, oldEmail string, err error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userId int
+	var email, current string
+	err = tx.QueryRow("SELECT user_id, email FROM email_verifications WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2",
+		hashToken(token), now).Scan(&userId, &email)
+	if err != nil {
+		return user, "", ErrInvalidVerification
+	}
+	if err = tx.QueryRow("SELECT email FROM users WHERE id = $1", userId).Scan(&current); err != nil {
+		return
+	}
+	if email != current {
+		var count int
+		if err = tx.QueryRow("SELECT count(*) FROM users WHERE email = $1", email).Scan(&count); err != nil {
+			return
+		}
+		if count > 0 {
+			return user, "", ErrEmailTaken
+		}
+		if _, err = tx.Exec("update sessions set email = $2 where user_id = $1", userId, email); err != nil {
+			return
+		}
+		oldEmail = current
+	}
+	if _, err = tx.Exec("update users set email = $2, email_verified_at = $3 where id = $1", userId, email, now); err != nil {
+		return
+	}
+	// links for the old address, or other pending changes, are stale now
+	if _, err = tx.Exec("update email_verifications set used_at = $2 where user_id = $1 and used_at is null", userId, now); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	user, err = UserById(userId)
+	return
+}
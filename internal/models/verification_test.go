@@ -0,0 +1,135 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// a user who has not confirmed the email of the signup yet
+func createUnverifiedUser(t *testing.T, handle string) User {
+	t.Helper()
+	user := User{Name: handle, Handle: handle, Email: handle + "@example.com", Password: "password"}
+	if err := user.Create(); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestVerifyEmail(t *testing.T) {
+	setupDB(t)
+	user := createUnverifiedUser(t, "alice")
+	verification := func(user User, email string) string {
+		t.Helper()
+		token, err := user.CreateEmailVerification(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid, sibling := verification(user, user.Email), verification(user, user.Email)
+	expired := verification(user, user.Email)
+	if _, err := Db.Exec("update email_verifications set expires_at = $2 where token_hash = $1", hashToken(expired), time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var stored int
+	Db.QueryRow("SELECT count(*) FROM email_verifications WHERE token_hash = $1", valid).Scan(&stored)
+	if stored != 0 {
+		t.Error("the token is stored as it is")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+		err   error
+	}{
+		{"unknown token", "not-a-token", 0, ErrInvalidVerification},
+		{"expired token", expired, 0, ErrInvalidVerification},
+		{"valid token", valid, user.Id, nil},
+		{"used token", valid, 0, ErrInvalidVerification},
+		{"other token of the user, used up by the verification", sibling, 0, ErrInvalidVerification},
+	}
+	for _, test := range tests {
+		got, oldEmail, err := VerifyEmail(test.token)
+		if err != test.err || got.Id != test.want || oldEmail != "" {
+			t.Errorf("%s: user %d, %q, %v, want %d, %v", test.name, got.Id, oldEmail, err, test.want, test.err)
+		}
+	}
+	user, _ = UserById(user.Id)
+	if !user.IsVerified() || user.Email != "alice@example.com" {
+		t.Errorf("verified %v as %s", user.IsVerified(), user.Email)
+	}
+	if _, err := user.CreateEmailVerification(user.Email); err != ErrEmailAlreadyConfirmed {
+		t.Errorf("a link for the verified email: %v", err)
+	}
+}
+
+func TestVerificationsAreLimited(t *testing.T) {
+	setupDB(t)
+	user := createUnverifiedUser(t, "alice")
+	for i := 0; i < MaxVerificationMails; i++ {
+		if _, err := user.CreateEmailVerification(user.Email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := user.CreateEmailVerification(user.Email); err != ErrTooManyVerifications {
+		t.Errorf("a link over the limit: %v", err)
+	}
+	// the links of another hour do not count
+	Db.Exec("update email_verifications set created_at = $2 where user_id = $1", user.Id, time.Now().Add(-2*time.Hour))
+	if _, err := user.CreateEmailVerification(user.Email); err != nil {
+		t.Errorf("a link the next hour: %v", err)
+	}
+}
+
+// the email only changes once the new address is confirmed
+func TestEmailChange(t *testing.T) {
+	setupDB(t)
+	user, other := createUser(t, "alice"), createUser(t, "bob")
+	session, err := user.CreateSession("test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.CreateEmailVerification(other.Email); err != ErrEmailTaken {
+		t.Errorf("a change to the email of another user: %v", err)
+	}
+	token, err := user.CreateEmailVerification("alice@new.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := user.PendingEmail(); pending != "alice@new.example" {
+		t.Errorf("pending %q", pending)
+	}
+	if stored, _ := UserById(user.Id); stored.Email != user.Email || !stored.IsVerified() {
+		t.Errorf("the email changed to %s before it was confirmed", stored.Email)
+	}
+
+	changed, oldEmail, err := VerifyEmail(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Email != "alice@new.example" || oldEmail != "alice@example.com" || !changed.IsVerified() {
+		t.Errorf("changed to %s from %s", changed.Email, oldEmail)
+	}
+	if pending := changed.PendingEmail(); pending != "" {
+		t.Errorf("still pending %q", pending)
+	}
+	var email string
+	Db.QueryRow("SELECT email FROM sessions WHERE uuid = $1", session.Uuid).Scan(&email)
+	if email != changed.Email {
+		t.Errorf("the session holds %s", email)
+	}
+
+	// the address was taken by someone else while the change waited
+	token, err = other.CreateEmailVerification("taken@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, "taken")
+	if _, _, err := VerifyEmail(token); err != ErrEmailTaken {
+		t.Errorf("a change to an address taken meanwhile: %v", err)
+	}
+	if stored, _ := UserById(other.Id); stored.Email != "bob@example.com" {
+		t.Errorf("changed to %s", stored.Email)
+	}
+}
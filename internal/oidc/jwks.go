@@ -0,0 +1,184 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// the keys the provider signs ID tokens with, by key id
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// a key is fetched again at most this often when a token names an unknown one
+const refetchAfter = time.Minute
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC key is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// get the key of the id, the key set is fetched again when it does not know it,
+// since providers rotate their keys
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil {
+		if key, ok := p.keys.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(p.keys.fetchedAt) < refetchAfter {
+			return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+		}
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc: fetching keys: %w", err)
+	}
+	keys := &keySet{keys: map[string]crypto.PublicKey{}, fetchedAt: time.Now()}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys.keys[k.Kid] = key
+		}
+	}
+	p.keys = keys
+	key, ok := keys.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// verifySignature checks the JWS signature of the token and returns its payload.
+// Only asymmetric algorithms are accepted, a token signed with "none" or with the
+// client secret is refused.
+func (p *Provider) verifySignature(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed ID token")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("oidc: malformed ID token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, errors.New("oidc: malformed ID token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("oidc: malformed ID token signature")
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "RS256", "RS384", "RS512":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("oidc: key does not match the algorithm")
+		}
+		hash, digest := hashFor(header.Alg, signed)
+		if err := rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature); err != nil {
+			return nil, errors.New("oidc: invalid ID token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, errors.New("oidc: key does not match the algorithm")
+		}
+		digest := sha256.Sum256(signed)
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return nil, errors.New("oidc: invalid ID token signature")
+		}
+	default:
+		return nil, fmt.Errorf("oidc: unsupported signing algorithm %q", header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("oidc: malformed ID token payload")
+	}
+	return payload, nil
+}
+
+func hashFor(alg string, data []byte) (crypto.Hash, []byte) {
+	switch alg {
+	case "RS384":
+		sum := sha512.Sum384(data)
+		return crypto.SHA384, sum[:]
+	case "RS512":
+		sum := sha512.Sum512(data)
+		return crypto.SHA512, sum[:]
+	}
+	sum := sha256.Sum256(data)
+	return crypto.SHA256, sum[:]
+}
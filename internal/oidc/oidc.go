@@ -0,0 +1,261 @@
+// Package oidc is a small OpenID Connect relying party: it discovers the provider, sends
+// the user to it with PKCE, and checks the ID token it gets back for the code.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is an identity provider the users can log in with
+type Provider struct {
+	// short name used in URLs, like "google" or "corp"
+	Name string
+	// shown on the login button
+	Label        string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// the scopes asked for, openid is always added
+	Scopes      []string
+	RedirectURL string
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      *keySet
+}
+
+// the fields of the discovery document used here
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are what the ID token says about the user
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// aud is a string or a list of strings
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*aud = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*aud = many
+	return nil
+}
+
+func (aud audience) contains(id string) bool {
+	for _, a := range aud {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// clock skew tolerated on exp and iat
+const leeway = time.Minute
+
+func NewProvider(name, label, issuer, clientID, clientSecret string, scopes []string, redirectURL string) *Provider {
+	return &Provider{Name: name, Label: label, Issuer: strings.TrimSuffix(issuer, "/"), ClientID: clientID,
+		ClientSecret: clientSecret, Scopes: scopes, RedirectURL: redirectURL}
+}
+
+// fetch the discovery document once, it is kept for the life of the process
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d discovery
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("oidc: discovery of %s: %w", p.Issuer, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery of %s returned the issuer %s", p.Issuer, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document misses an endpoint")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// Random values of a login attempt: state ties the callback to the attempt, the nonce ties
+// the ID token to it, and the verifier proves the code is redeemed by who asked for it (PKCE)
+type Attempt struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewAttempt() Attempt {
+	return Attempt{State: random(), Nonce: random(), Verifier: random()}
+}
+
+func random() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// AuthURL is where the user is sent to log in at the provider
+func (p *Provider) AuthURL(ctx context.Context, attempt Attempt) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(attempt.Verifier))
+	values := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {attempt.State},
+		"nonce":                 {attempt.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, s := range p.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// Exchange redeems the code of the callback and returns the checked claims of the ID token
+func (p *Provider) Exchange(ctx context.Context, code string, attempt Attempt) (claims Claims, err error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {attempt.Verifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return
+	}
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return claims, fmt.Errorf("oidc: token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK || token.Error != "" {
+		return claims, fmt.Errorf("oidc: token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return claims, errors.New("oidc: no ID token in the token response")
+	}
+	return p.verify(ctx, token.IDToken, attempt.Nonce)
+}
+
+// check the signature and the claims of the ID token
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (claims Claims, err error) {
+	payload, err := p.verifySignature(ctx, idToken)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("oidc: ID token claims: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.Issuer:
+		err = fmt.Errorf("oidc: ID token issued by %s", claims.Issuer)
+	case !claims.Audience.contains(p.ClientID):
+		err = errors.New("oidc: ID token is not meant for this client")
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != p.ClientID:
+		err = errors.New("oidc: ID token is authorized for another client")
+	case now.After(time.Unix(claims.Expiry, 0).Add(leeway)):
+		err = errors.New("oidc: ID token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(leeway)):
+		err = errors.New("oidc: ID token issued in the future")
+	case claims.Nonce != nonce:
+		err = errors.New("oidc: ID token nonce does not match")
+	case claims.Subject == "":
+		err = errors.New("oidc: ID token has no subject")
+	}
+	return
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(v)
+}
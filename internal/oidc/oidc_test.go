@@ -0,0 +1,166 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	server, err := oidctest.NewServer("chitchat", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	p := NewProvider("test", "Test", server.URL+"/", "chitchat", "secret", []string{"email", "openid"}, "https://chitchat.example/auth/test/callback")
+	return p, server
+}
+
+func TestLogin(t *testing.T) {
+	p, server := newTestProvider(t)
+	ctx := context.Background()
+	attempt := NewAttempt()
+	authURL, err := p.AuthURL(ctx, attempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authURL, "scope=openid+email&") {
+		t.Errorf("scopes of %s, want openid once and first", authURL)
+	}
+	callback, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Query().Get("state") != attempt.State {
+		t.Errorf("state %q came back, want %q", callback.Query().Get("state"), attempt.State)
+	}
+	server.SetClaims(map[string]interface{}{"email": "alice@example.com", "email_verified": true, "name": "Alice"})
+	claims, err := p.Exchange(ctx, callback.Query().Get("code"), attempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Errorf("claims = %+v", claims)
+	}
+	// a code is redeemed once
+	if _, err := p.Exchange(ctx, callback.Query().Get("code"), attempt); err == nil {
+		t.Error("the code was redeemed twice")
+	}
+}
+
+func TestExchangeChecksTheAttempt(t *testing.T) {
+	p, server := newTestProvider(t)
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		change func(attempt *Attempt)
+	}{
+		{"PKCE verifier of another attempt", func(attempt *Attempt) { attempt.Verifier = NewAttempt().Verifier }},
+		{"no PKCE verifier", func(attempt *Attempt) { attempt.Verifier = "" }},
+		{"nonce of another attempt", func(attempt *Attempt) { attempt.Nonce = NewAttempt().Nonce }},
+	}
+	for _, test := range tests {
+		attempt := NewAttempt()
+		authURL, err := p.AuthURL(ctx, attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		callback, err := server.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.change(&attempt)
+		if claims, err := p.Exchange(ctx, callback.Query().Get("code"), attempt); err == nil {
+			t.Errorf("%s: accepted with %+v", test.name, claims)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p, server := newTestProvider(t)
+	ctx := context.Background()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := server.Claims("subject-1", "nonce")
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	// a token with its payload replaced after signing
+	tampered := func() string {
+		parts := strings.Split(server.Sign(claims(nil)), ".")
+		payload := strings.Replace(string(mustDecode(t, parts[1])), "subject-1", "subject-2", 1)
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + parts[2]
+	}
+	unsigned := func() string {
+		parts := strings.Split(server.Sign(claims(nil)), ".")
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"test-key"}`))
+		return header + "." + parts[1] + "."
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", server.Sign(claims(nil)), true},
+		{"several audiences authorized for the client", server.Sign(claims(map[string]interface{}{"aud": []string{"chitchat", "other"}, "azp": "chitchat"})), true},
+		{"expired within the leeway", server.Sign(claims(map[string]interface{}{"exp": now.Add(-leeway / 2).Unix()})), true},
+		{"signed with another key", oidctest.SignRS256(otherKey, server.KeyID, claims(nil)), false},
+		{"signed with an unknown key", oidctest.SignRS256(otherKey, "other-key", claims(nil)), false},
+		{"tampered payload", tampered(), false},
+		{"unsigned", unsigned(), false},
+		{"malformed", "not.a-token", false},
+		{"other audience", server.Sign(claims(map[string]interface{}{"aud": "other"})), false},
+		{"several audiences authorized for another client", server.Sign(claims(map[string]interface{}{"aud": []string{"chitchat", "other"}, "azp": "other"})), false},
+		{"other issuer", server.Sign(claims(map[string]interface{}{"iss": "https://evil.example"})), false},
+		{"expired", server.Sign(claims(map[string]interface{}{"exp": now.Add(-2 * leeway).Unix()})), false},
+		{"issued in the future", server.Sign(claims(map[string]interface{}{"iat": now.Add(2 * leeway).Unix()})), false},
+		{"other nonce", server.Sign(claims(map[string]interface{}{"nonce": "other"})), false},
+		{"no nonce", server.Sign(claims(map[string]interface{}{"nonce": nil})), false},
+		{"no subject", server.Sign(claims(map[string]interface{}{"sub": nil})), false},
+	}
+	for _, test := range tests {
+		got, err := p.verify(ctx, test.token, "nonce")
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: accepted with %+v", test.name, got)
+		}
+	}
+}
+
+func TestDiscoveryChecksTheIssuer(t *testing.T) {
+	_, server := newTestProvider(t)
+	// the discovery document of the server names its own URL as the issuer
+	p := NewProvider("test", "Test", server.URL+"/other", "chitchat", "secret", nil, "https://chitchat.example/callback")
+	if _, err := p.AuthURL(context.Background(), NewAttempt()); err == nil {
+		t.Error("a provider announcing another issuer was accepted")
+	}
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,207 @@
+// Package oidctest runs an OpenID Connect provider in the process for the tests of the login
+// with a provider: discovery, keys, authorization with PKCE and the token endpoint.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a provider with a single client and a single RSA signing key
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+	KeyID        string
+
+	mu sync.Mutex
+	// claims added to the next ID tokens, a nil value removes the claim
+	claims map[string]interface{}
+	grants map[string]grant
+}
+
+// what the authorization endpoint was asked for a code
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewServer starts a provider for the client, its issuer is the URL of the server
+func NewServer(clientID, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ClientID: clientID, ClientSecret: clientSecret, Key: key, KeyID: "test-key", grants: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+// SetClaims sets claims of the next ID tokens over the ones of a valid token for the login
+func (s *Server) SetClaims(claims map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = claims
+}
+
+// Claims are the claims of a valid ID token for the client
+func (s *Server) Claims(subject, nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   s.URL,
+		"sub":   subject,
+		"aud":   s.ClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": nonce,
+	}
+}
+
+// Sign encodes the claims as an ID token signed with the key of the server
+func (s *Server) Sign(claims map[string]interface{}) string {
+	return SignRS256(s.Key, s.KeyID, claims)
+}
+
+// SignRS256 encodes the claims as a JWT signed with the key, for tokens the server would not issue
+func SignRS256(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Authorize follows the link to the provider as a user who accepts the login, and returns
+// the URL the provider sends the browser back to, with the code and the state
+func (s *Server) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		return nil, errors.New("authorization refused: " + response.Status)
+	}
+	return url.Parse(response.Header.Get("Location"))
+}
+
+func (s *Server) discovery(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(writer http.ResponseWriter, request *http.Request) {
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kid": s.KeyID,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   encode(s.Key.N),
+		"e":   encode(big.NewInt(int64(s.Key.E))),
+	}}})
+}
+
+// the user accepts right away, the code remembers the PKCE challenge and the nonce
+func (s *Server) authorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("response_type") != "code" ||
+		!strings.Contains(" "+query.Get("scope")+" ", " openid ") {
+		http.Error(writer, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(writer, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	code := random()
+	s.mu.Lock()
+	s.grants[code] = grant{redirectURI: query.Get("redirect_uri"), challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	s.mu.Unlock()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(writer, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(writer, request, redirect.String(), http.StatusFound)
+}
+
+// redeems a code once, for the client that proves it holds the PKCE verifier
+func (s *Server) token(writer http.ResponseWriter, request *http.Request) {
+	// the client id and secret are form encoded before going in the header
+	id, secret, ok := request.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(writer, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := request.PostFormValue("code")
+	s.mu.Lock()
+	grant, found := s.grants[code]
+	delete(s.grants, code)
+	extra := s.claims
+	s.mu.Unlock()
+	verifier := sha256.Sum256([]byte(request.PostFormValue("code_verifier")))
+	switch {
+	case request.PostFormValue("grant_type") != "authorization_code" || !found:
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+	case request.PostFormValue("redirect_uri") != grant.redirectURI:
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri does not match"})
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge:
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier does not match"})
+	default:
+		claims := s.Claims("subject-1", grant.nonce)
+		for name, value := range extra {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		writeJSON(writer, http.StatusOK, map[string]string{"access_token": random(), "token_type": "Bearer", "id_token": s.Sign(claims)})
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, v interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(v)
+}
+
+func random() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory keeps the buckets in the process, they are lost on restart
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// when the bucket is full again and can be forgotten
+	full time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+func (m *Memory) Take(key string, rate Rate) (ok bool, retryAfter time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(rate.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens, ok, retryAfter = take(b.tokens, b.updated, now, rate)
+	b.updated = now
+	b.full = now.Add(rate.refillTime())
+	return
+}
+
+// forget the full buckets once a minute, so the map does not grow with every address seen
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
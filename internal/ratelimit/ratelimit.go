@@ -0,0 +1,46 @@
+// Package ratelimit keeps token buckets: a bucket holds up to Burst tokens, each request
+// takes one, and one token comes back every Every. Buckets are kept in memory for a single
+// server, or in the database when several servers share the limits.
+package ratelimit
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Rate lets Burst requests through at once, then one more every Every
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// Store takes tokens from the buckets it keeps, by key
+type Store interface {
+	// Take takes a token from the bucket of the key, when the bucket is empty it
+	// returns false and how long until the next token
+	Take(key string, rate Rate) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Key joins the parts of a bucket key, like Key("login", "ip", "10.0.0.1")
+func Key(parts ...string) string {
+	return strings.Join(parts, ":")
+}
+
+// refill the bucket for the time elapsed since it was last used, then take a token
+func take(tokens float64, updated, now time.Time, rate Rate) (left float64, ok bool, retryAfter time.Duration) {
+	elapsed := now.Sub(updated)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens = math.Min(float64(rate.Burst), tokens+float64(elapsed)/float64(rate.Every))
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) * float64(rate.Every))
+}
+
+// a bucket is full again after this long, and does not need to be kept
+func (rate Rate) refillTime() time.Duration {
+	return time.Duration(rate.Burst) * rate.Every
+}
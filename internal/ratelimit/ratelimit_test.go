@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taewony/go-fullstack-webapp/internal/models"
+)
+
+func TestTake(t *testing.T) {
+	rate := Rate{Burst: 3, Every: 10 * time.Second}
+	now := time.Now()
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		left       float64
+		ok         bool
+		retryAfter time.Duration
+	}{
+		{"full", 3, 0, 2, true, 0},
+		{"last token", 1, 0, 0, true, 0},
+		{"empty", 0, 0, 0, false, 10 * time.Second},
+		{"half a token back", 0, 5 * time.Second, 0.5, false, 5 * time.Second},
+		{"a token back", 0, 10 * time.Second, 0, true, 0},
+		{"refilled up to the burst only", 0, time.Hour, 2, true, 0},
+		{"clock going back", 0.5, -time.Minute, 0.5, false, 5 * time.Second},
+	}
+	for _, test := range tests {
+		left, ok, retryAfter := take(test.tokens, now.Add(-test.elapsed), now, rate)
+		if left != test.left || ok != test.ok || retryAfter != test.retryAfter {
+			t.Errorf("%s: take = %v, %v, %v, want %v, %v, %v", test.name, left, ok, retryAfter, test.left, test.ok, test.retryAfter)
+		}
+	}
+}
+
+// testStore runs the behaviour every store shares
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	rate := Rate{Burst: 3, Every: time.Hour}
+	for i := 0; i < rate.Burst; i++ {
+		if ok, _, err := store.Take("a", rate); !ok || err != nil {
+			t.Fatalf("take %d of the burst: %v, %v", i+1, ok, err)
+		}
+	}
+	ok, retryAfter, err := store.Take("a", rate)
+	if ok || err != nil || retryAfter <= 59*time.Minute || retryAfter > time.Hour {
+		t.Errorf("take past the burst: %v, %v, %v, want a refusal for about an hour", ok, retryAfter, err)
+	}
+	// a refusal takes nothing
+	if _, again, _ := store.Take("a", rate); again > retryAfter {
+		t.Errorf("the wait grew from %v to %v with a refused take", retryAfter, again)
+	}
+	if ok, _, err := store.Take("b", rate); !ok || err != nil {
+		t.Errorf("the bucket of another key is empty: %v, %v", ok, err)
+	}
+
+	// the tokens come back with time
+	fast := Rate{Burst: 1, Every: 50 * time.Millisecond}
+	if ok, _, _ := store.Take("c", fast); !ok {
+		t.Fatal("first take refused")
+	}
+	if ok, _, _ := store.Take("c", fast); ok {
+		t.Error("second take allowed right away")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if ok, _, _ := store.Take("c", fast); !ok {
+		t.Error("the token did not come back")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestSQL(t *testing.T) {
+	models.InitDB()
+	defer models.Db.Close()
+	store := NewSQL(models.Db.DB)
+	testStore(t, store)
+
+	// the full buckets are swept
+	if _, err := models.Db.Exec("update rate_limits set expires_at = $1 where key = 'b'", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	models.Db.QueryRow("SELECT count(*) FROM rate_limits WHERE key = 'b'").Scan(&count)
+	if count != 0 {
+		t.Error("the full bucket was not swept")
+	}
+}
+
+// servers sharing a database take from a bucket at once, each token is taken once
+func TestSQLConcurrentTakes(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "limits.db")+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the rate_limits table of models.InitDB
+	_, err = db.Exec(`CREATE TABLE rate_limits (
+		key          VARCHAR(255) PRIMARY KEY,
+		tokens       REAL NOT NULL,
+		updated_unix REAL NOT NULL,
+		expires_at   TIMESTAMP NOT NULL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSQL(db)
+	rate := Rate{Burst: 10, Every: time.Hour}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := store.Take("shared", rate)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != rate.Burst {
+		t.Errorf("%d tokens taken, want %d", taken, rate.Burst)
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQL keeps the buckets in the rate_limits table, shared by every server using the database.
+// The time of a bucket is kept in seconds since the epoch so the statements can refill it.
+type SQL struct {
+	db *sql.DB
+}
+
+func NewSQL(db *sql.DB) *SQL {
+	return &SQL{db: db}
+}
+
+// the tokens of the bucket refilled up to now ($2), at most the burst ($3), with a token
+// coming back every $4 seconds. A clock of another server running behind refills nothing.
+const refilled = `CASE
+	WHEN $2 <= updated_unix THEN tokens
+	WHEN tokens + ($2 - updated_unix) / $4 >= $3 THEN $3
+	ELSE tokens + ($2 - updated_unix) / $4 END`
+
+// Take takes the token with a single statement, so servers taking from the same bucket at
+// once cannot both take its last token
+func (s *SQL) Take(key string, rate Rate) (ok bool, retryAfter time.Duration, err error) {
+	now := time.Now()
+	unix, burst, every := float64(now.UnixNano())/1e9, float64(rate.Burst), rate.Every.Seconds()
+	expires := now.Add(rate.refillTime())
+
+	// a new bucket starts full
+	var taken string
+	err = s.db.QueryRow(`insert into rate_limits (key, tokens, updated_unix, expires_at) values ($1, $2, $3, $4)
+		on conflict (key) do nothing returning key`, key, burst-1, unix, expires).Scan(&taken)
+	if err == nil {
+		return true, 0, nil
+	}
+	if err != sql.ErrNoRows {
+		return
+	}
+	// the bucket only changes when it has a token to take
+	err = s.db.QueryRow(`update rate_limits set tokens = `+refilled+` - 1, updated_unix = $2, expires_at = $5
+		where key = $1 and `+refilled+` >= 1 returning key`, key, unix, burst, every, expires).Scan(&taken)
+	if err == nil {
+		return true, 0, nil
+	}
+	if err != sql.ErrNoRows {
+		return
+	}
+	// empty, the wait is computed from what the bucket holds now
+	var tokens, updated float64
+	err = s.db.QueryRow("SELECT tokens, updated_unix FROM rate_limits WHERE key = $1", key).Scan(&tokens, &updated)
+	if err == sql.ErrNoRows {
+		// swept in between, it is full again
+		return true, 0, nil
+	}
+	if err != nil {
+		return
+	}
+	_, _, retryAfter = take(tokens, time.Unix(0, int64(updated*1e9)), now, rate)
+	return
+}
+
+// Sweep removes the buckets that are full again
+func (s *SQL) Sweep() (err error) {
+	_, err = s.db.Exec("delete from rate_limits where expires_at < $1", time.Now())
+	return
+}
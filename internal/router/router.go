@@ -4,9 +4,10 @@ import (
 	"net/http"
 
 	handlers "github.com/taewony/go-fullstack-webapp/internal/handlers"
+	"github.com/taewony/go-fullstack-webapp/internal/models"
 )
 
-func NewRouter() *http.ServeMux {
+func NewRouter() http.Handler {
 	r := http.NewServeMux()
 
 	r.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("public"))))
@@ -15,19 +16,136 @@ func NewRouter() *http.ServeMux {
 	r.HandleFunc("/", handlers.HomeHandler)
 	r.HandleFunc("/index", handlers.IndexHandler)
 	r.HandleFunc("GET /err", handlers.ErrorHandler)
+	r.HandleFunc("POST /threads/read", handlers.MarkAllReadHandler)
 
 	// user handlers
 	r.HandleFunc("GET /login", handlers.LoginHandler)
-	r.HandleFunc("GET /logout", handlers.LogoutHandler)
+	r.HandleFunc("POST /logout", handlers.LogoutHandler)
 	r.HandleFunc("GET /signup", handlers.SignupHandler)
-	r.HandleFunc("POST /signup", handlers.SignupAccountHandler)
-	r.HandleFunc("POST /authenticate", handlers.AuthenticateHandler)
+	r.HandleFunc("POST /signup", handlers.RateLimit("signup", handlers.SignupRate, handlers.SignupAccountHandler))
+	r.HandleFunc("POST /authenticate", handlers.RateLimit("login", handlers.LoginRate, handlers.AuthenticateHandler))
+	r.HandleFunc("GET /login/2fa", handlers.TwoFactorLoginHandler)
+	r.HandleFunc("POST /login/2fa", handlers.RateLimit("2fa", handlers.TwoFactorRate, handlers.VerifyTwoFactorLoginHandler))
+	r.HandleFunc("GET /auth/{provider}/login", handlers.ProviderLoginHandler)
+	r.HandleFunc("GET /auth/{provider}/callback", handlers.ProviderCallbackHandler)
+	r.HandleFunc("GET /password/forgot", handlers.ForgotPasswordHandler)
+	r.HandleFunc("POST /password/forgot", handlers.RateLimit("forgot", handlers.ForgotRate, handlers.SendPasswordResetHandler))
+	r.HandleFunc("GET /password/reset/{token}", handlers.ResetPasswordHandler)
+	r.HandleFunc("POST /password/reset/{token}", handlers.RateLimit("reset", handlers.ResetRate, handlers.UpdatePasswordHandler))
+	r.HandleFunc("GET /email/verify/{token}", handlers.VerifyEmailHandler)
+	r.HandleFunc("GET /account/profile", handlers.AccountProfileHandler)
+	r.HandleFunc("POST /account/profile", handlers.UpdateProfileHandler)
+	r.HandleFunc("POST /account/avatar", handlers.UploadAvatarHandler)
+	r.HandleFunc("POST /account/avatar/delete", handlers.DeleteAvatarHandler)
+	r.HandleFunc("GET /account/password", handlers.AccountPasswordHandler)
+	r.HandleFunc("POST /account/password", handlers.ChangePasswordHandler)
+	r.HandleFunc("GET /account/email", handlers.AccountEmailHandler)
+	r.HandleFunc("POST /account/email", handlers.ChangeEmailHandler)
+	r.HandleFunc("POST /account/email/resend", handlers.ResendVerificationHandler)
+	r.HandleFunc("GET /account/2fa", handlers.TwoFactorHandler)
+	r.HandleFunc("POST /account/2fa/setup", handlers.SetupTwoFactorHandler)
+	r.HandleFunc("GET /account/2fa/qr.png", handlers.TwoFactorQRHandler)
+	r.HandleFunc("POST /account/2fa/confirm", handlers.ConfirmTwoFactorHandler)
+	r.HandleFunc("POST /account/2fa/recovery-codes", handlers.RegenerateRecoveryCodesHandler)
+	r.HandleFunc("POST /account/2fa/disable", handlers.DisableTwoFactorHandler)
+	r.HandleFunc("GET /account/logins", handlers.AccountLoginsHandler)
+	r.HandleFunc("POST /account/logins/{provider}/link", handlers.LinkProviderHandler)
+	r.HandleFunc("POST /account/logins/{id}/unlink", handlers.UnlinkProviderHandler)
+	r.HandleFunc("GET /account/sessions", handlers.AccountSessionsHandler)
+	r.HandleFunc("POST /account/sessions/{id}/revoke", handlers.RevokeSessionHandler)
+	r.HandleFunc("POST /account/sessions/revoke-others", handlers.RevokeOtherSessionsHandler)
+	r.HandleFunc("GET /account/delete", handlers.AccountDataHandler)
+	r.HandleFunc("POST /account/delete", handlers.RequestDeletionHandler)
+	r.HandleFunc("POST /account/delete/cancel", handlers.CancelDeletionHandler)
+	r.HandleFunc("GET /account/export", handlers.ExportHandler)
+
+	// profile handlers
+	r.HandleFunc("GET /u/{handle}", handlers.ProfileHandler)
+	r.HandleFunc("GET /u/{handle}/avatar", handlers.AvatarHandler)
+	r.HandleFunc("GET /users/{id}", handlers.UserLinkHandler)
+	r.HandleFunc("GET /mentions/suggest", handlers.SuggestMentionsHandler)
+	r.HandleFunc("POST /mentions/complete", handlers.CompleteMentionHandler)
+
+	// category handlers
+	r.HandleFunc("GET /c/{slug}", handlers.CategoryHandler)
+
+	// tag handlers
+	r.HandleFunc("GET /tag/{names}", handlers.TagHandler)
+	r.HandleFunc("GET /tags/suggest", handlers.SuggestTagsHandler)
 
 	// thread handlers
 	r.HandleFunc("GET /thread/new", handlers.NewThreadHandler)
 	r.HandleFunc("POST /thread/create", handlers.CreateThreadHandler)
 	r.HandleFunc("GET /thread/{id}", handlers.GetAThreadHandler)
 	r.HandleFunc("POST /thread/post", handlers.CreatePostHandler)
+	r.HandleFunc("GET /thread/{id}/edit", handlers.EditThreadHandler)
+	r.HandleFunc("POST /thread/{id}/edit", handlers.UpdateThreadHandler)
+	r.HandleFunc("POST /thread/{id}/delete", handlers.DeleteThreadHandler)
+	r.HandleFunc("GET /thread/{id}/revisions", handlers.ThreadRevisionsHandler)
+	r.HandleFunc("GET /thread/{id}/report", handlers.ReportThreadFormHandler)
+	r.HandleFunc("POST /thread/{id}/report", handlers.ReportThreadHandler)
+	r.HandleFunc("POST /thread/{id}/watch", handlers.WatchThreadHandler)
+	r.HandleFunc("POST /thread/{id}/unwatch", handlers.UnwatchThreadHandler)
+	r.HandleFunc("POST /thread/{id}/state", handlers.RequireRole(models.RoleModerator, handlers.ThreadStateHandler))
+
+	// post handlers
+	r.HandleFunc("POST /post/preview", handlers.PreviewPostHandler)
+	r.HandleFunc("GET /post/{id}/edit", handlers.EditPostHandler)
+	r.HandleFunc("POST /post/{id}/edit", handlers.UpdatePostHandler)
+	r.HandleFunc("POST /post/{id}/delete", handlers.DeletePostHandler)
+	r.HandleFunc("GET /post/{id}/revisions", handlers.PostRevisionsHandler)
+	r.HandleFunc("GET /post/{id}/report", handlers.ReportPostFormHandler)
+	r.HandleFunc("POST /post/{id}/report", handlers.ReportPostHandler)
+
+	// notification handlers
+	r.HandleFunc("GET /notifications", handlers.NotificationsHandler)
+	r.HandleFunc("GET /notifications/count", handlers.NotificationCountHandler)
+	r.HandleFunc("GET /notifications/preferences", handlers.NotificationPreferencesHandler)
+	r.HandleFunc("POST /notifications/preferences", handlers.UpdateNotificationPreferencesHandler)
+	r.HandleFunc("POST /notifications/read", handlers.ReadAllNotificationsHandler)
+	r.HandleFunc("GET /notifications/{id}", handlers.OpenNotificationHandler)
+	r.HandleFunc("POST /notifications/{id}/read", handlers.ReadNotificationHandler)
+
+	// attachment handlers
+	r.HandleFunc("GET /attachments/{id}", handlers.GetAttachmentHandler)
+	r.HandleFunc("GET /attachments/{id}/thumb", handlers.GetAttachmentThumbHandler)
+
+	// moderation handlers
+	r.HandleFunc("GET /mod", handlers.RequireRole(models.RoleModerator, handlers.ModerationHandler))
+	r.HandleFunc("GET /mod/reports", handlers.RequireRole(models.RoleModerator, handlers.ReportQueueHandler))
+	r.HandleFunc("POST /mod/reports/{kind}/{id}/resolve", handlers.RequireRole(models.RoleModerator, handlers.ResolveReportsHandler))
+	r.HandleFunc("GET /mod/held", handlers.RequireRole(models.RoleModerator, handlers.HeldQueueHandler))
+	r.HandleFunc("POST /mod/held/{kind}/{id}/review", handlers.RequireRole(models.RoleModerator, handlers.ReviewHeldHandler))
+	r.HandleFunc("GET /mod/tags", handlers.RequireRole(models.RoleModerator, handlers.ModerateTagsHandler))
+	r.HandleFunc("POST /mod/tags/{name}/rename", handlers.RequireRole(models.RoleModerator, handlers.RenameTagHandler))
+	r.HandleFunc("POST /mod/tags/{name}/merge", handlers.RequireRole(models.RoleModerator, handlers.MergeTagHandler))
+
+	// development mailbox, lists the outbox instead of a real inbox
+	if handlers.DevMailbox {
+		r.HandleFunc("GET /dev/mailbox", handlers.MailboxHandler)
+		r.HandleFunc("GET /dev/mailbox/{id}", handlers.MailHandler)
+		r.HandleFunc("POST /dev/mailbox/test", handlers.TestMailHandler)
+	}
+
+	// admin handlers
+	r.HandleFunc("GET /admin", handlers.RequireRole(models.RoleAdmin, handlers.AdminDashboardHandler))
+	r.HandleFunc("GET /admin/config", handlers.RequireRole(models.RoleAdmin, handlers.AdminConfigHandler))
+	r.HandleFunc("GET /admin/users", handlers.RequireRole(models.RoleAdmin, handlers.AdminUsersHandler))
+	r.HandleFunc("POST /admin/users/{id}/role", handlers.RequireRole(models.RoleAdmin, handlers.UpdateUserRoleHandler))
+	r.HandleFunc("POST /admin/users/{id}/suspend", handlers.RequireRole(models.RoleAdmin, handlers.SuspendUserHandler))
+	r.HandleFunc("POST /admin/users/{id}/ban", handlers.RequireRole(models.RoleAdmin, handlers.BanUserHandler))
+	r.HandleFunc("POST /admin/users/{id}/reinstate", handlers.RequireRole(models.RoleAdmin, handlers.ReinstateUserHandler))
+	r.HandleFunc("POST /admin/users/{id}/2fa/reset", handlers.RequireRole(models.RoleAdmin, handlers.ResetTwoFactorHandler))
+	r.HandleFunc("POST /admin/users/{id}/sessions/revoke", handlers.RequireRole(models.RoleAdmin, handlers.RevokeUserSessionsHandler))
+	r.HandleFunc("GET /admin/sessions", handlers.RequireRole(models.RoleAdmin, handlers.AdminSessionsHandler))
+	r.HandleFunc("POST /admin/sessions/{id}/revoke", handlers.RequireRole(models.RoleAdmin, handlers.AdminRevokeSessionHandler))
+	r.HandleFunc("GET /admin/audit", handlers.RequireRole(models.RoleAdmin, handlers.AdminAuditHandler))
+	r.HandleFunc("GET /admin/audit/export", handlers.RequireRole(models.RoleAdmin, handlers.AuditExportHandler))
+	r.HandleFunc("GET /admin/content", handlers.RequireRole(models.RoleAdmin, handlers.AdminContentHandler))
+	r.HandleFunc("POST /admin/threads/bulk", handlers.RequireRole(models.RoleAdmin, handlers.BulkThreadsHandler))
+	r.HandleFunc("POST /admin/posts/bulk", handlers.RequireRole(models.RoleAdmin, handlers.BulkPostsHandler))
+	r.HandleFunc("GET /admin/categories", handlers.RequireRole(models.RoleAdmin, handlers.AdminCategoriesHandler))
+	r.HandleFunc("POST /admin/categories", handlers.RequireRole(models.RoleAdmin, handlers.CreateCategoryHandler))
 
-	return r
+	return handlers.RequestID(handlers.LocalTime(handlers.CSRF(r)))
 }
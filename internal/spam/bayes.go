@@ -0,0 +1,101 @@
+package spam
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Count is how many spam and ham (clean) documents a token was seen in
+type Count struct {
+	Spam int
+	Ham  int
+}
+
+// Corpus keeps what the classifier learned
+type Corpus interface {
+	// Counts returns the documents learned of each class and the counts of the tokens,
+	// tokens never seen are left out
+	Counts(tokens []string) (spamDocs, hamDocs int, counts map[string]Count, err error)
+	// Learn adds a document of the class
+	Learn(tokens []string, spam bool) error
+}
+
+// most tokens of a document looked at, long texts do not make longer queries
+const maxTokens = 300
+
+// the lowercased words of the text, of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Tokenize the text for the classifier: each word of 3 to 24 characters and each host
+// linked to, once
+func Tokenize(text string) (tokens []string) {
+	seen := map[string]bool{}
+	add := func(token string) {
+		if !seen[token] && len(tokens) < maxTokens {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	for _, host := range linkHosts(text) {
+		add("host:" + host)
+	}
+	for _, word := range words(text) {
+		if length := len([]rune(word)); length >= 3 && length <= 24 {
+			add(word)
+		}
+	}
+	return
+}
+
+// Bayes is a naive Bayes classifier learning from what the moderators decided. It learns
+// spam from each held or reported text removed as spam, but ham only from the ones approved
+// or dismissed, so it sees far more spam than the site gets: the share of each class says
+// nothing about new content and both get the same prior, only the words score. Until it
+// learned MinDocuments texts of each class it scores nothing, the other checks hold alone.
+type Bayes struct {
+	Corpus Corpus
+	// documents of each class learned before the classifier scores anything
+	MinDocuments int
+}
+
+func (*Bayes) Name() string { return "bayes" }
+
+// the score is the probability that the content is spam, from the tokens seen before
+func (bayes *Bayes) Check(content Content) (score float64, reason string, err error) {
+	tokens := Tokenize(content.Text)
+	if len(tokens) == 0 {
+		return
+	}
+	spamDocs, hamDocs, counts, err := bayes.Corpus.Counts(tokens)
+	if err != nil || spamDocs < bayes.MinDocuments || hamDocs < bayes.MinDocuments || spamDocs == 0 || hamDocs == 0 {
+		return
+	}
+	// log odds of spam from even odds, with add-one smoothing of the token counts
+	odds := 0.0
+	for _, count := range counts {
+		inSpam := (float64(count.Spam) + 1) / (float64(spamDocs) + 2)
+		inHam := (float64(count.Ham) + 1) / (float64(hamDocs) + 2)
+		odds += math.Log(inSpam / inHam)
+	}
+	score = 1 / (1 + math.Exp(-math.Max(-50, math.Min(50, odds))))
+	if score <= 0.5 {
+		return 0, "", nil
+	}
+	reason = strconv.Itoa(len(counts)) + " known words, " + strconv.Itoa(int(score*100)) + "% spam"
+	return
+}
+
+// Learn from a moderator decision about the text
+func (bayes *Bayes) Learn(text string, spam bool) error {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	return bayes.Corpus.Learn(tokens, spam)
+}
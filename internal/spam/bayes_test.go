@@ -0,0 +1,93 @@
+package spam
+
+import (
+	"strconv"
+	"testing"
+)
+
+// a corpus kept in memory
+type memoryCorpus struct {
+	spamDocs, hamDocs int
+	counts            map[string]Count
+}
+
+func (corpus *memoryCorpus) Counts(tokens []string) (spamDocs, hamDocs int, counts map[string]Count, err error) {
+	counts = map[string]Count{}
+	for _, token := range tokens {
+		if count, ok := corpus.counts[token]; ok {
+			counts[token] = count
+		}
+	}
+	return corpus.spamDocs, corpus.hamDocs, counts, nil
+}
+
+func (corpus *memoryCorpus) Learn(tokens []string, spam bool) error {
+	if spam {
+		corpus.spamDocs++
+	} else {
+		corpus.hamDocs++
+	}
+	for _, token := range tokens {
+		count := corpus.counts[token]
+		if spam {
+			count.Spam++
+		} else {
+			count.Ham++
+		}
+		corpus.counts[token] = count
+	}
+	return nil
+}
+
+// the classifier after learning the texts, numbered so that each one is a new document
+func trained(spam, ham int) *Bayes {
+	bayes := &Bayes{Corpus: &memoryCorpus{counts: map[string]Count{}}, MinDocuments: 5}
+	for i := 0; i < spam; i++ {
+		bayes.Learn("cheap pills for the casino bonus winner offer"+strconv.Itoa(i), true)
+	}
+	for i := 0; i < ham; i++ {
+		bayes.Learn("thanks for the answer about the compiler error"+strconv.Itoa(i), false)
+	}
+	return bayes
+}
+
+func TestBayes(t *testing.T) {
+	const (
+		spammy  = "casino bonus for the winner"
+		hammy   = "thanks, the compiler error is gone"
+		unknown = "quantum chromodynamics lattice"
+	)
+	tests := []struct {
+		name      string
+		spam, ham int
+		text      string
+		scored    bool
+	}{
+		// the cold start: nothing is scored before both classes have MinDocuments texts
+		{"nothing learned", 0, 0, spammy, false},
+		{"only spam learned", 50, 0, spammy, false},
+		{"too little ham", 50, 4, spammy, false},
+		{"too little spam", 4, 50, spammy, false},
+		{"enough of both, spam", 5, 5, spammy, true},
+		{"enough of both, ham", 5, 5, hammy, false},
+		// far more spam is learned than ham, that alone does not make text spam
+		{"mostly spam learned, ham", 200, 5, hammy, false},
+		{"mostly spam learned, unknown words", 200, 5, unknown, false},
+		{"mostly spam learned, spam", 200, 5, spammy, true},
+		{"mostly ham learned, spam", 5, 200, spammy, true},
+		{"empty text", 50, 50, "", false},
+	}
+	for _, test := range tests {
+		score, reason, err := trained(test.spam, test.ham).Check(Content{Text: test.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the classifier scores nothing at or under even odds
+		if scored := score > 0; scored != test.scored {
+			t.Errorf("%s: score %.2f (%s), want scored %v", test.name, score, reason, test.scored)
+		}
+		if score == 0 && reason != "" {
+			t.Errorf("%s: a reason without a score: %s", test.name, reason)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package spam
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// links written out or in markdown, the host is the first group
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)([a-z0-9][a-z0-9.-]*[a-z0-9])`)
+
+// the hosts of the links of the text, lowercased and without www.
+func linkHosts(text string) (hosts []string) {
+	for _, match := range linkPattern.FindAllStringSubmatch(text, -1) {
+		hosts = append(hosts, strings.TrimPrefix(strings.ToLower(match[1]), "www."))
+	}
+	return
+}
+
+// Honeypot catches the bots filling in the hidden field of the forms
+type Honeypot struct{}
+
+func (Honeypot) Name() string { return "honeypot" }
+
+func (Honeypot) Check(content Content) (score float64, reason string, err error) {
+	if content.Honeypot != "" {
+		return 1, "hidden field filled in", nil
+	}
+	return
+}
+
+// Links scores content with more links than people usually write, each link over Allowed
+// halves the odds that the content is clean
+type Links struct {
+	Allowed int
+}
+
+func (Links) Name() string { return "links" }
+
+func (links Links) Check(content Content) (score float64, reason string, err error) {
+	count := len(linkHosts(content.Text))
+	if count <= links.Allowed {
+		return
+	}
+	score = 1 - math.Pow(0.5, float64(count-links.Allowed))
+	reason = strconv.Itoa(count) + " links, " + strconv.Itoa(links.Allowed) + " allowed"
+	return
+}
+
+// Blocklist scores content with blocked words, or links to blocked domains or their subdomains
+type Blocklist struct {
+	words   map[string]bool
+	domains []string
+}
+
+// each blocked word found lowers the odds that the content is clean by this much
+const blockedWordScore = 0.6
+
+// a link to a blocked domain is nearly certainly spam
+const blockedDomainScore = 0.95
+
+// Make a blocklist, words are matched as whole words whatever their case
+func NewBlocklist(words []string, domains []string) *Blocklist {
+	blocklist := &Blocklist{words: map[string]bool{}}
+	for _, word := range words {
+		blocklist.words[strings.ToLower(strings.TrimSpace(word))] = true
+	}
+	for _, domain := range domains {
+		blocklist.domains = append(blocklist.domains, strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www."))
+	}
+	return blocklist
+}
+
+func (*Blocklist) Name() string { return "blocklist" }
+
+func (blocklist *Blocklist) Check(content Content) (score float64, reason string, err error) {
+	var found []string
+	seen := map[string]bool{}
+	clean := 1.0
+	for _, word := range words(content.Text) {
+		if blocklist.words[word] && !seen[word] {
+			seen[word] = true
+			found = append(found, word)
+			clean *= 1 - blockedWordScore
+		}
+	}
+	for _, host := range linkHosts(content.Text) {
+		if seen[host] {
+			continue
+		}
+		for _, domain := range blocklist.domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				seen[host] = true
+				found = append(found, host)
+				clean *= 1 - blockedDomainScore
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	return 1 - clean, "blocked " + strings.Join(found, ", "), nil
+}
@@ -0,0 +1,81 @@
+// Package spam scores new threads and posts before they are saved. A Pipeline runs its
+// Checks, each scores the content from 0 (clean) to 1 (certainly spam), and the scores add up
+// like independent odds: two checks at 0.5 make 0.75. Content scoring the threshold or more
+// is held until a moderator looks at it.
+package spam
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// HoneypotField is the form field hidden from people, bots fill it in
+const HoneypotField = "website"
+
+// Content is what the checks look at
+type Content struct {
+	// the topic of a thread or the body of a post
+	Text string
+	// the value of the honeypot field of the form
+	Honeypot string
+}
+
+// Check scores content, the reason tells the moderators why when the score is not zero
+type Check interface {
+	Name() string
+	Check(content Content) (score float64, reason string, err error)
+}
+
+// Result is what one check of the pipeline found
+type Result struct {
+	Check  string
+	Score  float64
+	Reason string
+}
+
+// Verdict is the combined score of the checks
+type Verdict struct {
+	Score   float64
+	Held    bool
+	Results []Result
+}
+
+// the reasons of the checks that scored, like "links: 6 links (2 allowed)"
+func (verdict Verdict) Reasons() string {
+	var reasons []string
+	for _, result := range verdict.Results {
+		if result.Score > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s: %s (%.2f)", result.Check, result.Reason, result.Score))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Pipeline runs the checks on new content, more checks are added by implementing Check
+type Pipeline struct {
+	// score from which content is held, zero never holds
+	Threshold float64
+	Checks    []Check
+}
+
+// Run every check on the content. A failing check does not count, the others still decide
+// and the first error is returned with the verdict.
+func (pipeline *Pipeline) Run(content Content) (verdict Verdict, err error) {
+	clean := 1.0
+	for _, check := range pipeline.Checks {
+		score, reason, checkErr := check.Check(content)
+		if checkErr != nil {
+			if err == nil {
+				err = fmt.Errorf("spam check %s: %w", check.Name(), checkErr)
+			}
+			continue
+		}
+		score = math.Max(0, math.Min(1, score))
+		verdict.Results = append(verdict.Results, Result{Check: check.Name(), Score: score, Reason: reason})
+		clean *= 1 - score
+	}
+	verdict.Score = 1 - clean
+	verdict.Held = pipeline.Threshold > 0 && verdict.Score >= pipeline.Threshold
+	return
+}
@@ -0,0 +1,101 @@
+package spam
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// SQL keeps the corpus of the classifier in the spam_tokens and spam_documents tables
+type SQL struct {
+	db *sql.DB
+}
+
+func NewSQL(db *sql.DB) *SQL {
+	return &SQL{db: db}
+}
+
+// the class of the documents, as kept in spam_documents
+func class(spam bool) string {
+	if spam {
+		return "spam"
+	}
+	return "ham"
+}
+
+func (s *SQL) Counts(tokens []string) (spamDocs, hamDocs int, counts map[string]Count, err error) {
+	rows, err := s.db.Query("SELECT class, count FROM spam_documents")
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var name string
+		var count int
+		if err = rows.Scan(&name, &count); err != nil {
+			rows.Close()
+			return
+		}
+		if name == class(true) {
+			spamDocs = count
+		} else {
+			hamDocs = count
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	counts = map[string]Count{}
+	if len(tokens) == 0 {
+		return
+	}
+	marks := make([]string, len(tokens))
+	args := make([]interface{}, len(tokens))
+	for i, token := range tokens {
+		marks[i] = "$" + strconv.Itoa(i+1)
+		args[i] = token
+	}
+	rows, err = s.db.Query("SELECT token, spam, ham FROM spam_tokens WHERE token IN ("+strings.Join(marks, ", ")+")", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token string
+		var count Count
+		if err = rows.Scan(&token, &count.Spam, &count.Ham); err != nil {
+			return
+		}
+		counts[token] = count
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *SQL) Learn(tokens []string, spam bool) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	inSpam, inHam := 0, 1
+	if spam {
+		inSpam, inHam = 1, 0
+	}
+	for _, token := range tokens {
+		_, err = tx.Exec(`insert into spam_tokens (token, spam, ham) values ($1, $2, $3)
+			on conflict (token) do update set spam = spam_tokens.spam + excluded.spam, ham = spam_tokens.ham + excluded.ham`,
+			token, inSpam, inHam)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec(`insert into spam_documents (class, count) values ($1, 1)
+		on conflict (class) do update set count = spam_documents.count + 1`, class(spam))
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
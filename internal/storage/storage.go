@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no object is stored under the key
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage keeps uploaded files, objects are addressed by an opaque key
+type Storage interface {
+	// Put stores the data under the key, replacing any previous object
+	Put(key string, data []byte, contentType string) error
+	// Get opens the object stored under the key, the caller must close it
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object, deleting a missing key is not an error
+	Delete(key string) error
+}
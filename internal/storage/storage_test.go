@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStorage runs the behaviour every backend shares
+func testStorage(t *testing.T, s Storage, prefix string) {
+	t.Helper()
+	key := prefix + "attachments/abc/photo.png"
+	read := func(key string) ([]byte, error) {
+		body, err := s.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	if _, err := s.Get(key); err != ErrNotFound {
+		t.Fatalf("Get of a missing key: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Put(key, []byte("first"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(key, []byte("second"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("Get = %q, want the replaced object %q", data, "second")
+	}
+	if err := s.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(key); err != ErrNotFound {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(key); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, local, "")
+
+	for _, key := range []string{"../escape", "/etc/passwd", "a/../../b", ""} {
+		if err := local.Put(key, []byte("x"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) escaped the directory", key)
+		}
+	}
+}
+
+// fakeS3 keeps the objects of one bucket in memory, and checks the requests are path-style
+// and signed for the bucket region
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	auth := request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/"+time.Now().UTC().Format("20060102")+"/eu-west-1/s3/aws4_request") ||
+		!strings.Contains(auth, "Signature=") || request.Header.Get("X-Amz-Date") == "" {
+		f.t.Errorf("unsigned request %s %s: %q", request.Method, request.URL.Path, auth)
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key, found := strings.CutPrefix(request.URL.Path, "/"+f.bucket+"/")
+	if !found {
+		f.t.Errorf("request outside the bucket: %s", request.URL.Path)
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch request.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(request.Body)
+		if sum := request.Header.Get("X-Amz-Content-Sha256"); sum != sha256Hex(data) {
+			f.t.Errorf("payload hash %s does not match the body", sum)
+		}
+		f.objects[key] = data
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		writer.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{t: t, bucket: "chitchat", objects: map[string][]byte{}})
+	defer server.Close()
+	testStorage(t, NewS3(server.URL+"/", "eu-west-1", "chitchat", "access", "secret"), "")
+}
+
+func TestS3Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusForbidden)
+		writer.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer server.Close()
+	s := NewS3(server.URL, "", "chitchat", "access", "wrong")
+	err := s.Put("key", []byte("x"), "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put: err = %v, want the AccessDenied answer", err)
+	}
+	if _, err := s.Get("key"); err == nil || err == ErrNotFound {
+		t.Errorf("Get: err = %v, want the AccessDenied answer", err)
+	}
+}
+
+// Runs against a real S3 compatible service when STORAGE_TEST_S3_ENDPOINT is set, like a
+// local MinIO: STORAGE_TEST_S3_ENDPOINT=http://localhost:9000 STORAGE_TEST_S3_BUCKET=chitchat
+// STORAGE_TEST_S3_ACCESS_KEY=minioadmin STORAGE_TEST_S3_SECRET_KEY=minioadmin go test ./internal/storage
+func TestS3Service(t *testing.T) {
+	endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("STORAGE_TEST_S3_ENDPOINT is not set")
+	}
+	s := NewS3(endpoint, os.Getenv("STORAGE_TEST_S3_REGION"), os.Getenv("STORAGE_TEST_S3_BUCKET"),
+		os.Getenv("STORAGE_TEST_S3_ACCESS_KEY"), os.Getenv("STORAGE_TEST_S3_SECRET_KEY"))
+	// each run uses its own keys, the bucket may be shared
+	testStorage(t, s, "test-"+strconv.FormatInt(time.Now().UnixNano(), 36)+"/")
+
+	// a large object goes through in one piece
+	data := bytes.Repeat([]byte("0123456789"), 1<<19)
+	if err := s.Put("large", data, "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete("large")
+	body, err := s.Get("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	got, _ := io.ReadAll(body)
+	if !bytes.Equal(got, data) {
+		t.Errorf("large object came back with %d bytes, want %d", len(got), len(data))
+	}
+}
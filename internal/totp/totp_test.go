@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the SHA-1 key of the test vectors of RFC 6238, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// the last six digits of the eight digit values of RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil || got != test.want {
+			t.Errorf("Code at %d = %q, %v, want %q", test.unix, got, err, test.want)
+		}
+	}
+	if got, err := Code(rfcSecret[:10]+"1", 1); err == nil {
+		t.Errorf("Code with a secret that is not base32 = %q", got)
+	}
+	// apps may show the secret in lower case
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1); got == "" {
+		t.Error("a lower case secret is refused")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		step   int64
+		ok     bool
+	}{
+		{"current step", rfcSecret, code(step), step, true},
+		{"previous step", rfcSecret, code(step - 1), step - 1, true},
+		{"next step", rfcSecret, code(step + 1), step + 1, true},
+		{"two steps ago", rfcSecret, code(step - 2), 0, false},
+		{"two steps ahead", rfcSecret, code(step + 2), 0, false},
+		{"typed with spaces", rfcSecret, " 005 924 ", step, true},
+		{"wrong code", rfcSecret, "123456", 0, false},
+		{"too short", rfcSecret, "00592", 0, false},
+		{"too long", rfcSecret, "0059240", 0, false},
+		{"empty", rfcSecret, "", 0, false},
+		{"other secret", NewSecret(), code(step), 0, false},
+		{"invalid secret", "not base32!", code(step), 0, false},
+	}
+	for _, test := range tests {
+		got, ok := Validate(test.secret, test.code, now)
+		if ok != test.ok || got != test.step {
+			t.Errorf("%s: Validate = %d, %v, want %d, %v", test.name, got, ok, test.step, test.ok)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, b := NewSecret(), NewSecret()
+	if a == b {
+		t.Error("two secrets are the same")
+	}
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v, want 20", a, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("ChitChat", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/ChitChat:alice@example.com" ||
+		query.Get("secret") != rfcSecret || query.Get("issuer") != "ChitChat" ||
+		query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("URI = %s", uri)
+	}
+}
@@ -1,17 +1,139 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/taewony/go-fullstack-webapp/internal/captcha"
+	"github.com/taewony/go-fullstack-webapp/internal/handlers"
+	"github.com/taewony/go-fullstack-webapp/internal/mail"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
+	"github.com/taewony/go-fullstack-webapp/internal/oidc"
+	"github.com/taewony/go-fullstack-webapp/internal/ratelimit"
 	"github.com/taewony/go-fullstack-webapp/internal/router"
+	"github.com/taewony/go-fullstack-webapp/internal/spam"
+	"github.com/taewony/go-fullstack-webapp/internal/storage"
 )
 
 func main() {
+	adminEmail := flag.String("admin-email", config.AdminEmail, "email of the initial admin account")
+	adminPassword := flag.String("admin-password", config.AdminPassword, "password of the initial admin account")
+	flag.Parse()
+
+	if config.EditWindowMinutes > 0 {
+		models.EditWindow = time.Duration(config.EditWindowMinutes) * time.Minute
+	}
+	models.ArchiveAfter = time.Duration(config.ArchiveAfterDays) * 24 * time.Hour
+	if config.AccountDeletionGraceDays > 0 {
+		models.AccountDeletionGrace = time.Duration(config.AccountDeletionGraceDays) * 24 * time.Hour
+	}
+	models.ReportHideThreshold = config.ReportHideThreshold
+
+	// Set up where attachments are stored
+	switch config.Storage {
+	case "s3":
+		handlers.Storage = storage.NewS3(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey)
+	default:
+		local, err := storage.NewLocal(config.UploadDir)
+		if err != nil {
+			log.Fatalln("Cannot create upload directory", err)
+		}
+		handlers.Storage = local
+	}
+	if config.MaxUploadMB > 0 {
+		handlers.MaxUploadSize = config.MaxUploadMB << 20
+	}
+
+	// Set up how mails are delivered
+	var mailer mail.Mailer
+	switch config.MailMode {
+	case "smtp":
+		mailer = mail.NewSMTP(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	default:
+		dir, err := mail.NewDir(config.MailDir, config.MailFrom)
+		if err != nil {
+			log.Fatalln("Cannot create mail directory", err)
+		}
+		mailer = dir
+		handlers.DevMailbox = true
+	}
+	if config.BaseURL != "" {
+		handlers.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	}
+
+	// Set up the identity providers, each is discovered on its first login
+	for _, p := range config.OIDCProviders {
+		scopes := p.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+		callback := handlers.BaseURL + "/auth/" + p.Name + "/callback"
+		handlers.Providers = append(handlers.Providers, oidc.NewProvider(p.Name, p.Label, p.Issuer, p.ClientID, p.ClientSecret, scopes, callback))
+		handlers.OpenSignup[p.Name] = p.AllowSignup
+	}
+
 	// Initialize the in-memory SQLite3 database connection
 	models.InitDB()
 	// models.InsertInitialDB()
+	if err := models.SeedCategories(); err != nil {
+		log.Fatalln("Cannot seed categories", err)
+	}
+
+	// Seed the initial admin account
+	if *adminEmail != "" {
+		if err := models.SeedAdmin(config.AdminName, *adminEmail, *adminPassword); err != nil {
+			log.Fatalln("Cannot seed admin account", err)
+		}
+		info("Seeded admin account", *adminEmail)
+	}
+
+	// Keep the rate limits in the database when several servers share it
+	if config.RateLimitStore == "sql" {
+		store := ratelimit.NewSQL(models.Db.DB)
+		handlers.Limits = store
+		go sweepRateLimits(store, time.Hour)
+	}
+
+	// Ask bots for proof of work on signup and after failed logins
+	if config.CaptchaSignup || config.CaptchaLoginFailures > 0 {
+		handlers.Captcha = captcha.New(config.CaptchaSecret, config.CaptchaDifficulty, 10*time.Minute)
+		handlers.Captcha.Bypass = config.CaptchaBypass
+		handlers.CaptchaSignup = config.CaptchaSignup
+		handlers.CaptchaLoginFailures = config.CaptchaLoginFailures
+		if config.CaptchaBypass != "" {
+			warning("Challenges accept the bypass solution, never do this in production")
+		}
+	}
+
+	// Check new threads and posts for spam, the classifier learns from the moderators
+	handlers.Classifier = &spam.Bayes{Corpus: spam.NewSQL(models.Db.DB), MinDocuments: config.SpamMinDocuments}
+	handlers.ContentChecks = &spam.Pipeline{
+		Threshold: config.SpamThreshold,
+		Checks: []spam.Check{
+			spam.Honeypot{},
+			spam.Links{Allowed: config.SpamAllowedLinks},
+			spam.NewBlocklist(config.SpamBlockedWords, config.SpamBlockedDomains),
+			handlers.Classifier,
+		},
+	}
+
+	// Archive stale threads in the background
+	if models.ArchiveAfter > 0 {
+		go archiveStaleThreads(time.Hour)
+	}
+
+	// Purge the accounts whose deletion grace period is over
+	go purgeDeletedAccounts(time.Hour)
+
+	// Deliver queued mails in the background
+	go deliverMail(mailer, 10*time.Second)
+
+	// Show the configuration on the admin pages
+	handlers.Settings = config.settings()
+	handlers.Version = version()
 
 	// Initialize the router
 	r := router.NewRouter()
@@ -20,3 +142,52 @@ func main() {
 	log.Println("Starting server on :8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
+
+// archive the threads without activity at every tick, the first run happens right away
+func archiveStaleThreads(every time.Duration) {
+	for {
+		count, err := models.ArchiveStaleThreads()
+		if err != nil {
+			danger(err, "Cannot archive stale threads")
+		} else if count > 0 {
+			info("Archived", count, "stale threads")
+		}
+		time.Sleep(every)
+	}
+}
+
+// purge the deleted accounts at every tick, the first run happens right away
+func purgeDeletedAccounts(every time.Duration) {
+	for {
+		count, err := handlers.PurgeDeletedAccounts()
+		if err != nil {
+			danger(err, "Cannot purge deleted accounts")
+		} else if count > 0 {
+			info("Purged", count, "deleted accounts")
+		}
+		time.Sleep(every)
+	}
+}
+
+// send the queued mails at every tick, failed ones wait for their next attempt
+func deliverMail(mailer mail.Mailer, every time.Duration) {
+	for {
+		sent, err := models.DeliverOutbox(mailer)
+		if err != nil {
+			danger(err, "Cannot deliver mails")
+		} else if sent > 0 {
+			info("Delivered", sent, "mails")
+		}
+		time.Sleep(every)
+	}
+}
+
+// remove the buckets that have filled up again at every tick
+func sweepRateLimits(store *ratelimit.SQL, every time.Duration) {
+	for {
+		if err := store.Sweep(); err != nil {
+			danger(err, "Cannot sweep rate limits")
+		}
+		time.Sleep(every)
+	}
+}
@@ -0,0 +1,87 @@
+// Solves the proof-of-work challenges of the forms: finds a nonce whose SHA-256 hash with
+// the challenge starts with enough zero bits. The submit buttons of the form are disabled
+// until it is found. The script runs again with each form HTMX swaps in, and starts the
+// challenges not started yet.
+(function () {
+  var K = [
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+  ];
+  var W = new Array(64);
+
+  // the first word of the SHA-256 hash of an ASCII string, enough to count up to 32 zero bits
+  function firstWord(text) {
+    var length = text.length, blocks = ((length + 8) >> 6) + 1, words = new Array(blocks * 16), i;
+    for (i = 0; i < words.length; i++) words[i] = 0;
+    for (i = 0; i < length; i++) words[i >> 2] |= (text.charCodeAt(i) & 0xff) << (24 - (i % 4) * 8);
+    words[length >> 2] |= 0x80 << (24 - (length % 4) * 8);
+    words[words.length - 1] = length * 8;
+    var h0 = 0x6a09e667, h1 = 0xbb67ae85, h2 = 0x3c6ef372, h3 = 0xa54ff53a,
+        h4 = 0x510e527f, h5 = 0x9b05688c, h6 = 0x1f83d9ab, h7 = 0x5be0cd19;
+    for (var block = 0; block < words.length; block += 16) {
+      var a = h0, b = h1, c = h2, d = h3, e = h4, f = h5, g = h6, h = h7, t;
+      for (i = 0; i < 64; i++) {
+        if (i < 16) {
+          W[i] = words[block + i];
+        } else {
+          var x = W[i - 15], y = W[i - 2];
+          W[i] = (((x >>> 7) | (x << 25)) ^ ((x >>> 18) | (x << 14)) ^ (x >>> 3)) +
+            (((y >>> 17) | (y << 15)) ^ ((y >>> 19) | (y << 13)) ^ (y >>> 10)) + W[i - 7] + W[i - 16] | 0;
+        }
+        t = h + (((e >>> 6) | (e << 26)) ^ ((e >>> 11) | (e << 21)) ^ ((e >>> 25) | (e << 7))) +
+          ((e & f) ^ (~e & g)) + K[i] + W[i] | 0;
+        var u = (((a >>> 2) | (a << 30)) ^ ((a >>> 13) | (a << 19)) ^ ((a >>> 22) | (a << 10))) +
+          ((a & b) ^ (a & c) ^ (b & c)) | 0;
+        h = g; g = f; f = e; e = d + t | 0; d = c; c = b; b = a; a = t + u | 0;
+      }
+      h0 = h0 + a | 0; h1 = h1 + b | 0; h2 = h2 + c | 0; h3 = h3 + d | 0;
+      h4 = h4 + e | 0; h5 = h5 + f | 0; h6 = h6 + g | 0; h7 = h7 + h | 0;
+    }
+    return h0 >>> 0;
+  }
+
+  function solves(token, nonce, difficulty) {
+    var word = firstWord(token + ":" + nonce);
+    return difficulty <= 0 || (difficulty <= 32 && word >>> (32 - difficulty) === 0);
+  }
+
+  function start(widget) {
+    widget.setAttribute("data-captcha-started", "true");
+    var form = widget.closest("form");
+    var buttons = form ? form.querySelectorAll("button[type=submit], input[type=submit]") : [];
+    var status = widget.querySelector(".captcha-status");
+    var token = widget.getAttribute("data-captcha");
+    var difficulty = parseInt(widget.getAttribute("data-difficulty"), 10) || 0;
+    var nonce = 0;
+    for (var i = 0; i < buttons.length; i++) buttons[i].disabled = true;
+    // hash in slices so the page stays responsive
+    (function work() {
+      for (var end = nonce + 5000; nonce < end; nonce++) {
+        if (solves(token, nonce, difficulty)) {
+          widget.querySelector("input[name=captcha_solution]").value = String(nonce);
+          if (status) status.textContent = "Checked, you can go on.";
+          for (var i = 0; i < buttons.length; i++) buttons[i].disabled = false;
+          return;
+        }
+      }
+      setTimeout(work, 0);
+    })();
+  }
+
+  function startAll() {
+    var widgets = document.querySelectorAll("[data-captcha]:not([data-captcha-started])");
+    for (var i = 0; i < widgets.length; i++) start(widgets[i]);
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", startAll);
+  } else {
+    startAll();
+  }
+})();
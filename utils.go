@@ -9,16 +9,84 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 
+	"github.com/taewony/go-fullstack-webapp/internal/components"
 	"github.com/taewony/go-fullstack-webapp/internal/models"
 )
 
 type Configuration struct {
-	Address      string
-	ReadTimeout  int64
-	WriteTimeout int64
-	Static       string
+	Address       string
+	ReadTimeout   int64
+	WriteTimeout  int64
+	Static        string
+	AdminName     string
+	AdminEmail    string
+	AdminPassword string
+	// minutes during which authors may edit or delete their own threads and posts
+	EditWindowMinutes int64
+	// attachments are kept on the local disk ("local") or in an S3 compatible bucket ("s3")
+	Storage     string
+	UploadDir   string
+	MaxUploadMB int64
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	// days without new posts before a thread is archived, 0 never archives
+	ArchiveAfterDays int64
+	// days during which a deleted account can be restored before it is purged
+	AccountDeletionGraceDays int64
+	// reports from different users that hide a thread or post until a moderator decides, 0 never hides
+	ReportHideThreshold int
+	// spam score from 0 to 1 from which new threads and posts are held for a moderator, 0 never holds
+	SpamThreshold float64
+	// links a thread or post may have before they count towards its spam score
+	SpamAllowedLinks int
+	// words, and domains of links with their subdomains, that count towards the spam score
+	SpamBlockedWords   []string
+	SpamBlockedDomains []string
+	// spam and clean decisions of the moderators the classifier learns before it scores anything
+	SpamMinDocuments int
+	// address of the site, used for the links in emails
+	BaseURL string
+	// mails are written to MailDir and listed on /dev/mailbox ("dev") or sent through an SMTP server ("smtp")
+	MailMode     string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// rate limit buckets are kept in memory ("memory") or in the database, shared by the servers ("sql")
+	RateLimitStore string
+	// ask for a proof-of-work challenge on signup, and on login after CaptchaLoginFailures failed
+	// logins of the email in a row, 0 never asks on login
+	CaptchaSignup        bool
+	CaptchaLoginFailures int
+	// zero bits the hash of a solution starts with, each one doubles the work of the browser
+	CaptchaDifficulty int
+	// key signing the challenges, shared by the servers, a random one is made at start when empty
+	CaptchaSecret string
+	// a solution accepted for any challenge without work, for tests, leave it empty in production
+	CaptchaBypass string
+	// OpenID Connect providers users can log in with
+	OIDCProviders []OIDCProvider
+}
+
+// an identity provider, its callback is BaseURL + "/auth/" + Name + "/callback"
+type OIDCProvider struct {
+	Name         string
+	Label        string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// create an account on the first login of someone without one
+	AllowSignup bool
 }
 
 var config Configuration
@@ -26,7 +94,7 @@ var logger *log.Logger
 
 // Convenience function for printing to stdout
 func p(a ...interface{}) {
-	fmt.Println(a)
+	fmt.Println(a...)
 }
 
 func init() {
@@ -51,6 +119,52 @@ func loadConfig() {
 	}
 }
 
+// the configuration as a list for the admin pages, the values of secrets are masked
+func (config Configuration) settings() (settings []components.Setting) {
+	addSettings(&settings, "", reflect.ValueOf(config))
+	return
+}
+
+// add the fields of structs and the items of lists under their own name, like OIDCProviders[0].Issuer
+func addSettings(settings *[]components.Setting, name string, value reflect.Value) {
+	switch {
+	case value.Kind() == reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i).Name
+			if name != "" {
+				field = name + "." + field
+			}
+			addSettings(settings, field, value.Field(i))
+		}
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+		if value.Len() == 0 {
+			*settings = append(*settings, components.Setting{Name: name})
+		}
+		for i := 0; i < value.Len(); i++ {
+			addSettings(settings, name+"["+strconv.Itoa(i)+"]", value.Index(i))
+		}
+	default:
+		text := fmt.Sprint(value.Interface())
+		if value.Kind() == reflect.Slice {
+			text = strings.Trim(text, "[]")
+		}
+		if text != "" && isSecret(name) {
+			text = "********"
+		}
+		*settings = append(*settings, components.Setting{Name: name, Value: text})
+	}
+}
+
+// passwords, secrets and keys are never shown
+func isSecret(name string) bool {
+	for _, suffix := range []string{"Password", "Secret", "Key"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 // Convenience function to redirect to the error message page
 func error_message(writer http.ResponseWriter, request *http.Request, msg string) {
 	url := []string{"/err?msg=", msg}